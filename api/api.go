@@ -0,0 +1,9 @@
+// Package api embeds the OpenAPI definition of the service, so that it is served by, and enforced on, the binary it describes.
+package api
+
+import _ "embed"
+
+// Spec is the OpenAPI 3 definition of the REST API, api.yml.
+//
+//go:embed api.yml
+var Spec []byte
@@ -0,0 +1,98 @@
+// Package awserrors tells apart the errors of the AWS services used by the service that callers handle differently.
+package awserrors
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// ErrorKind tells apart the errors of AWS that callers handle differently.
+type ErrorKind int
+
+const (
+	KindUnknown ErrorKind = iota
+	// KindThrottled errors are raised when the capacity of the table or the publishing quota of the account is exceeded,
+	// and are worth retrying later.
+	KindThrottled
+	// KindAccessDenied errors are raised when the client is not allowed to use the table or topic, or has no credentials or region.
+	KindAccessDenied
+	// KindValidation errors are raised when AWS rejects a request, e.g. an item larger than 400KB or a message larger than 256KB.
+	KindValidation
+	// KindNotFound errors are raised when the table or topic does not exist.
+	KindNotFound
+	// KindTimeout errors are raised when AWS did not respond in time.
+	KindTimeout
+)
+
+// The services errors are raised by.
+const (
+	ServiceDynamoDB = "dynamodb"
+	ServiceSNS      = "sns"
+)
+
+var timeoutCodes = map[string]bool{
+	request.CanceledErrorCode:      true,
+	request.ErrCodeResponseTimeout: true,
+	"RequestTimeout":               true,
+}
+
+// Error is an error of an AWS service of a known kind.
+type Error struct {
+	Kind ErrorKind
+	// Service is the service that raised the error, e.g. ServiceDynamoDB.
+	Service string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of an error of AWS, KindUnknown when it is not an Error.
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindUnknown
+}
+
+// ServiceOf returns the service that raised an error of AWS, empty when it is not an Error.
+func ServiceOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Service
+	}
+	return ""
+}
+
+// Classify returns the errors of a service of a known kind as an Error, and any other error as it is.
+// Throttling and timeouts are recognised for every service, other kinds by the error codes of the service.
+func Classify(service string, err error, codes map[string]ErrorKind) error {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+	kind, found := codes[awsErr.Code()]
+	switch {
+	case request.IsErrorThrottle(err):
+		kind = KindThrottled
+	case found:
+	case timeoutCodes[awsErr.Code()] || isTimeout(awsErr.OrigErr()):
+		kind = KindTimeout
+	default:
+		return err
+	}
+	return &Error{Kind: kind, Service: service, Err: err}
+}
+
+func isTimeout(err error) bool {
+	timeout, ok := err.(interface{ Timeout() bool })
+	return ok && timeout.Timeout()
+}
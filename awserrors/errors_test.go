@@ -0,0 +1,59 @@
+package awserrors
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+func TestClassify(t *testing.T) {
+	codes := map[string]ErrorKind{"ValidationException": KindValidation}
+	testCases := []struct {
+		description  string
+		err          error
+		expectedKind ErrorKind
+	}{
+		{"Throttling", awserr.New("ThrottlingException", "rate exceeded", nil), KindThrottled},
+		{"Code of the service", awserr.New("ValidationException", "invalid request", nil), KindValidation},
+		{"Cancelled", awserr.New(request.CanceledErrorCode, "request context canceled", nil), KindTimeout},
+		{"Response timeout", awserr.New(request.ErrCodeResponseTimeout, "read on body has reached the timeout limit", nil), KindTimeout},
+		{"Network timeout", awserr.New(request.ErrCodeRequestError, "send request failed", &url.Error{Op: "Post", URL: "https://aws", Err: timeoutError{}}), KindTimeout},
+		{"Other code", awserr.New("InternalFailure", "internal error", nil), KindUnknown},
+		{"Other error", errors.New("not an AWS error"), KindUnknown},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			err := Classify(ServiceSNS, testCase.err, codes)
+
+			assert.Equal(t, testCase.expectedKind, KindOf(err))
+			assert.Equal(t, testCase.err.Error(), err.Error())
+			if testCase.expectedKind == KindUnknown {
+				assert.Equal(t, testCase.err, err, "Errors of unknown kind should be returned as they are")
+				assert.Empty(t, ServiceOf(err))
+			} else {
+				assert.Equal(t, ServiceSNS, ServiceOf(err))
+				assert.Equal(t, testCase.err, errors.Unwrap(err))
+			}
+		})
+	}
+}
+
+func TestKindOf_WrappedError(t *testing.T) {
+	err := fmt.Errorf("unable to write: %w", &Error{Kind: KindThrottled, Service: ServiceDynamoDB, Err: assert.AnError})
+
+	assert.Equal(t, KindThrottled, KindOf(err))
+	assert.Equal(t, ServiceDynamoDB, ServiceOf(err))
+	assert.Equal(t, KindUnknown, KindOf(nil))
+	assert.Empty(t, ServiceOf(nil))
+}
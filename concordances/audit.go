@@ -0,0 +1,316 @@
+package concordances
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	log "github.com/sirupsen/logrus"
+)
+
+const auditPath = "/__audit"
+
+// AuditFinding is a problematic value found in the concordance record of a concept.
+type AuditFinding struct {
+	UUID  string `json:"uuid"`
+	Value string `json:"value"`
+}
+
+// AuditReport lists the data problems found by scanning every concordance record of a table.
+type AuditReport struct {
+	Tenant         string              `json:"tenant"`
+	StartedAt      time.Time           `json:"startedAt"`
+	FinishedAt     time.Time           `json:"finishedAt"`
+	RecordsScanned int                 `json:"recordsScanned"`
+	Error          string              `json:"error,omitempty"`
+	SelfReferences []string            `json:"selfReferences"`
+	DuplicateIds   []AuditFinding      `json:"duplicateIds"`
+	MalformedUUIDs []AuditFinding      `json:"malformedUuids"`
+	EmptyLists     []string            `json:"emptyLists"`
+	MultipleOwners map[string][]string `json:"multipleOwners"`
+	Cycles         [][]string          `json:"cycles"`
+}
+
+// Problems returns the number of data problems in the report.
+func (r AuditReport) Problems() int {
+	return len(r.SelfReferences) + len(r.DuplicateIds) + len(r.MalformedUUIDs) + len(r.EmptyLists) + len(r.MultipleOwners) + len(r.Cycles)
+}
+
+// Auditor scans the tables of the default service and of every tenant for data problems, and keeps the last report of each.
+type Auditor struct {
+	tables    map[string]db.Clienter
+	reportDir string
+
+	sync.RWMutex
+	reports map[string]AuditReport
+}
+
+// NewAuditor creates an auditor of the default service and the tenant services. Reports are also written to reportDir, unless it is empty.
+func NewAuditor(srv Service, tenants map[string]Service, reportDir string) *Auditor {
+	tables := map[string]db.Clienter{DefaultTenant: srv.getDBClient()}
+	for name, tenant := range tenants {
+		tables[name] = tenant.getDBClient()
+	}
+	return &Auditor{tables: tables, reportDir: reportDir, reports: map[string]AuditReport{}}
+}
+
+// NewTableAuditor creates an auditor of the tables of the default service and the tenants, read through plain clients
+// of their primary tables so that auditing starts none of the background work of the services.
+func NewTableAuditor(conf AppConfig) *Auditor {
+	tables := map[string]db.Clienter{DefaultTenant: db.NewDynamoDBClient(conf.DynamoDbTableName, conf.AWSRegion)}
+	for _, t := range conf.Tenants {
+		tables[t.Name] = db.NewDynamoDBClient(t.DynamoDbTableName, conf.AWSRegion)
+	}
+	return &Auditor{tables: tables, reports: map[string]AuditReport{}}
+}
+
+// Schedule audits every table at the given interval in the background, until the returned function is called.
+// Every instance with a schedule scans every table, so only one instance of a deployment should schedule audits.
+func (a *Auditor) Schedule(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.AuditAll()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// AuditAll audits the tables of the default service and every tenant, one after the other.
+func (a *Auditor) AuditAll() map[string]AuditReport {
+	names := make([]string, 0, len(a.tables))
+	for name := range a.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reports := map[string]AuditReport{}
+	for _, name := range names {
+		reports[name] = a.Audit(name)
+	}
+	return reports
+}
+
+// Audit scans the table of a tenant and reports its data problems.
+func (a *Auditor) Audit(tenant string) AuditReport {
+	log.WithField("tenant", tenant).Info("Starting concordances audit")
+	report := auditTable(tenant, a.tables[tenant])
+
+	a.Lock()
+	a.reports[tenant] = report
+	a.Unlock()
+
+	logEntry := log.WithFields(log.Fields{"tenant": tenant, "records": report.RecordsScanned, "problems": report.Problems()})
+	if report.Error != "" {
+		logEntry.WithField("error", report.Error).Error("Concordances audit failed")
+	} else {
+		logEntry.Info("Finished concordances audit")
+	}
+
+	if a.reportDir != "" {
+		if err := writeAuditReport(filepath.Join(a.reportDir, fmt.Sprintf("audit-%s-%s.json", tenant, report.StartedAt.UTC().Format("20060102T150405Z"))), report); err != nil {
+			log.WithError(err).WithField("tenant", tenant).Error("Error writing concordances audit report")
+		}
+	}
+	return report
+}
+
+// Reports returns the last report of every table audited so far.
+func (a *Auditor) Reports() map[string]AuditReport {
+	a.RLock()
+	defer a.RUnlock()
+	reports := map[string]AuditReport{}
+	for name, report := range a.reports {
+		reports[name] = report
+	}
+	return reports
+}
+
+func (h *Handler) HandleAudit(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", ContentTypeJson)
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(h.auditor.Reports())
+}
+
+func writeAuditReport(path string, report interface{}) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// WriteAuditReports writes the given reports as one JSON document, to stdout if path is "-".
+func WriteAuditReports(path string, reports map[string]AuditReport) error {
+	if path == "-" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	}
+	return writeAuditReport(path, reports)
+}
+
+func auditTable(tenant string, client db.Clienter) AuditReport {
+	report := AuditReport{
+		Tenant:         tenant,
+		StartedAt:      time.Now(),
+		SelfReferences: []string{},
+		DuplicateIds:   []AuditFinding{},
+		MalformedUUIDs: []AuditFinding{},
+		EmptyLists:     []string{},
+		MultipleOwners: map[string][]string{},
+		Cycles:         [][]string{},
+	}
+	scanner, ok := client.(db.Scanner)
+	if !ok {
+		report.Error = "table cannot be scanned"
+		report.FinishedAt = time.Now()
+		return report
+	}
+
+	owners := map[string][]string{}
+	graph := map[string][]string{}
+	err := scanner.Scan(func(m db.ConcordancesModel) error {
+		report.RecordsScanned++
+		auditRecord(&report, m, owners, graph)
+		return nil
+	})
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	for id, primaries := range owners {
+		if len(primaries) > 1 {
+			sort.Strings(primaries)
+			report.MultipleOwners[id] = primaries
+		}
+	}
+	report.Cycles = findCycles(graph)
+
+	sort.Strings(report.SelfReferences)
+	sort.Strings(report.EmptyLists)
+	sortFindings(report.DuplicateIds)
+	sortFindings(report.MalformedUUIDs)
+	report.FinishedAt = time.Now()
+	return report
+}
+
+func auditRecord(report *AuditReport, m db.ConcordancesModel, owners map[string][]string, graph map[string][]string) {
+	if !uuidRegex.MatchString(m.UUID) {
+		report.MalformedUUIDs = append(report.MalformedUUIDs, AuditFinding{UUID: m.UUID, Value: m.UUID})
+	}
+	if len(m.ConcordedIds) == 0 {
+		report.EmptyLists = append(report.EmptyLists, m.UUID)
+		return
+	}
+
+	seen := map[string]bool{}
+	selfReference := false
+	for _, id := range m.ConcordedIds {
+		if seen[id] {
+			report.DuplicateIds = append(report.DuplicateIds, AuditFinding{UUID: m.UUID, Value: id})
+			continue
+		}
+		seen[id] = true
+
+		if !uuidRegex.MatchString(id) {
+			report.MalformedUUIDs = append(report.MalformedUUIDs, AuditFinding{UUID: m.UUID, Value: id})
+		}
+		if id == m.UUID {
+			selfReference = true
+			continue
+		}
+		owners[id] = append(owners[id], m.UUID)
+		graph[m.UUID] = append(graph[m.UUID], id)
+	}
+	if selfReference {
+		report.SelfReferences = append(report.SelfReferences, m.UUID)
+	}
+}
+
+// findCycles returns the groups of concepts that are concorded to each other in a cycle, e.g. A to B and B to A,
+// as the strongly connected components of the concordances graph that have more than one concept.
+func findCycles(graph map[string][]string) [][]string {
+	index := 0
+	indices := map[string]int{}
+	lowLinks := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+	cycles := [][]string{}
+
+	var connect func(node string)
+	connect = func(node string) {
+		indices[node] = index
+		lowLinks[node] = index
+		index++
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, next := range graph[node] {
+			if _, visited := indices[next]; !visited {
+				connect(next)
+				if lowLinks[next] < lowLinks[node] {
+					lowLinks[node] = lowLinks[next]
+				}
+			} else if onStack[next] && indices[next] < lowLinks[node] {
+				lowLinks[node] = indices[next]
+			}
+		}
+
+		if lowLinks[node] != indices[node] {
+			return
+		}
+		component := []string{}
+		for {
+			last := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[last] = false
+			component = append(component, last)
+			if last == node {
+				break
+			}
+		}
+		if len(component) > 1 {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+
+	nodes := make([]string, 0, len(graph))
+	for node := range graph {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		if _, visited := indices[node]; !visited {
+			connect(node)
+		}
+	}
+
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+func sortFindings(findings []AuditFinding) {
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].UUID != findings[j].UUID {
+			return findings[i].UUID < findings[j].UUID
+		}
+		return findings[i].Value < findings[j].Value
+	})
+}
@@ -0,0 +1,150 @@
+package concordances
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	UuidA = "aaaaaaaa-6c50-4693-b835-02f70d3f3bc0"
+	UuidB = "bbbbbbbb-6c50-4693-b835-02f70d3f3bc0"
+	UuidC = "cccccccc-6c50-4693-b835-02f70d3f3bc0"
+	UuidD = "dddddddd-6c50-4693-b835-02f70d3f3bc0"
+	UuidE = "eeeeeeee-6c50-4693-b835-02f70d3f3bc0"
+)
+
+type MockScanningDynamoDBClient struct {
+	MockDynamoDBClient
+	records []db.ConcordancesModel
+	err     error
+	scans   int32
+}
+
+func (ddb *MockScanningDynamoDBClient) Scan(fn func(db.ConcordancesModel) error) error {
+	atomic.AddInt32(&ddb.scans, 1)
+	for _, m := range ddb.records {
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return ddb.err
+}
+
+func auditService(records ...db.ConcordancesModel) *ConcordancesRwService {
+	srv := createService(&MockScanningDynamoDBClient{MockDynamoDBClient: MockDynamoDBClient{Happy: true}, records: records}, &MockSNSClient{Happy: true})
+	return &srv
+}
+
+func TestAudit_CleanTable(t *testing.T) {
+	auditor := NewAuditor(auditService(
+		db.ConcordancesModel{UUID: UuidA, ConcordedIds: []string{UuidB, UuidC}},
+		db.ConcordancesModel{UUID: UuidD, ConcordedIds: []string{UuidE}},
+	), nil, "")
+
+	report := auditor.Audit(DefaultTenant)
+
+	assert.Empty(t, report.Error)
+	assert.Equal(t, 2, report.RecordsScanned)
+	assert.Equal(t, 0, report.Problems(), "Clean table reported problems")
+}
+
+func TestAudit_ReportsEveryProblem(t *testing.T) {
+	auditor := NewAuditor(auditService(
+		db.ConcordancesModel{UUID: UuidA, ConcordedIds: []string{UuidB, UuidA, UuidB}},
+		db.ConcordancesModel{UUID: UuidB, ConcordedIds: []string{UuidC, "TME-123 "}},
+		db.ConcordancesModel{UUID: UuidC, ConcordedIds: []string{UuidA}},
+		db.ConcordancesModel{UUID: UuidD, ConcordedIds: []string{UuidC}},
+		db.ConcordancesModel{UUID: UuidE, ConcordedIds: []string{}},
+	), nil, "")
+
+	report := auditor.Audit(DefaultTenant)
+
+	assert.Empty(t, report.Error)
+	assert.Equal(t, 5, report.RecordsScanned)
+	assert.Equal(t, []string{UuidA}, report.SelfReferences)
+	assert.Equal(t, []AuditFinding{{UUID: UuidA, Value: UuidB}}, report.DuplicateIds)
+	assert.Equal(t, []AuditFinding{{UUID: UuidB, Value: "TME-123 "}}, report.MalformedUUIDs)
+	assert.Equal(t, []string{UuidE}, report.EmptyLists)
+	assert.Equal(t, map[string][]string{UuidC: {UuidB, UuidD}}, report.MultipleOwners)
+	assert.Equal(t, [][]string{{UuidA, UuidB, UuidC}}, report.Cycles)
+	assert.Equal(t, 6, report.Problems())
+}
+
+func TestAudit_ScanError(t *testing.T) {
+	srv := createService(&MockScanningDynamoDBClient{err: errors.New(DDB_ERROR)}, &MockSNSClient{Happy: true})
+	auditor := NewAuditor(&srv, nil, "")
+
+	report := auditor.Audit(DefaultTenant)
+
+	assert.Equal(t, DDB_ERROR, report.Error)
+}
+
+func TestAudit_TableCannotBeScanned(t *testing.T) {
+	auditor := NewAuditor(&MockService{}, nil, "")
+
+	report := auditor.Audit(DefaultTenant)
+
+	assert.Equal(t, "table cannot be scanned", report.Error)
+}
+
+func TestAudit_WritesReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	auditor := NewAuditor(auditService(db.ConcordancesModel{UUID: UuidA, ConcordedIds: []string{UuidA}}), nil, dir)
+
+	auditor.Audit(DefaultTenant)
+
+	files, err := filepath.Glob(filepath.Join(dir, "audit-default-*.json"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "Audit report was not written")
+	data, err := ioutil.ReadFile(files[0])
+	assert.NoError(t, err)
+	report := AuditReport{}
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, []string{UuidA}, report.SelfReferences)
+}
+
+func TestAudit_ScheduleStops(t *testing.T) {
+	table := &MockScanningDynamoDBClient{MockDynamoDBClient: MockDynamoDBClient{Happy: true}}
+	srv := createService(table, &MockSNSClient{Happy: true})
+	auditor := NewAuditor(&srv, nil, "")
+
+	stop := auditor.Schedule(10 * time.Millisecond)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&table.scans) > 1 }, time.Second, 5*time.Millisecond, "Tables should be audited at every interval")
+	stop()
+	time.Sleep(20 * time.Millisecond)
+	scans := atomic.LoadInt32(&table.scans)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, scans, atomic.LoadInt32(&table.scans), "Audits should no longer be scheduled once stopped")
+	stop()
+}
+
+func TestHandler_Audit(t *testing.T) {
+	router := mux.NewRouter()
+	handler := NewHandler(router, AppConfig{}, auditService(db.ConcordancesModel{UUID: UuidA, ConcordedIds: []string{}}), map[string]Service{"factset": auditService()})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("GET", auditPath, ""))
+	assert.Equal(t, 200, rec.Result().StatusCode, "Response code incorrect.")
+	assert.Equal(t, "{}\n", rec.Body.String(), "No audit should have been reported before one has run")
+
+	handler.auditor.AuditAll()
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("GET", auditPath, ""))
+	reports := map[string]AuditReport{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&reports))
+	assert.Len(t, reports, 2, "Expected the last audit of the default service and every tenant")
+	assert.Equal(t, []string{UuidA}, reports[DefaultTenant].EmptyLists)
+}
@@ -0,0 +1,271 @@
+package concordances
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const deadLettersPath = "/__dead-letters"
+
+// DeadLetter is a notification that could not be delivered, kept so that it can be inspected and delivered again.
+type DeadLetter struct {
+	ID            string    `json:"id"`
+	Tenant        string    `json:"tenant"`
+	TransactionID string    `json:"transactionId"`
+	Event         sns.Event `json:"event"`
+	// Authorities are kept apart from the event, as they are only sent as a message attribute.
+	Authorities   []string  `json:"authorities,omitempty"`
+	Error         string    `json:"error"`
+	Attempts      int       `json:"attempts"`
+	FailedAt      time.Time `json:"failedAt"`
+	LastAttemptAt time.Time `json:"lastAttemptAt"`
+}
+
+// DeadLetterStore keeps the notifications that could not be delivered, in memory and, when it has a directory,
+// as one JSON file per notification, so that they survive a restart.
+type DeadLetterStore struct {
+	dir string
+
+	sync.Mutex
+	letters map[string]DeadLetter
+}
+
+// NewDeadLetterStore creates a store, loading the notifications kept in dir unless it is empty.
+func NewDeadLetterStore(dir string) (*DeadLetterStore, error) {
+	store := &DeadLetterStore{dir: dir, letters: map[string]DeadLetter{}}
+	if dir == "" {
+		return store, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		letter := DeadLetter{}
+		if err := json.Unmarshal(data, &letter); err != nil {
+			return nil, fmt.Errorf("dead letter %s is not valid JSON: %v", file, err)
+		}
+		store.letters[letter.ID] = letter
+	}
+	return store, nil
+}
+
+// Add keeps a notification that failed to be delivered.
+func (s *DeadLetterStore) Add(tenant string, event sns.Event, cause error) (DeadLetter, error) {
+	id, err := newDeadLetterID()
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	now := time.Now()
+	letter := DeadLetter{
+		ID:            id,
+		Tenant:        tenant,
+		TransactionID: event.TransactionID,
+		Event:         event,
+		Authorities:   event.Authorities,
+		Error:         cause.Error(),
+		Attempts:      1,
+		FailedAt:      now,
+		LastAttemptAt: now,
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if err := s.save(letter); err != nil {
+		return letter, err
+	}
+	s.letters[id] = letter
+	return letter, nil
+}
+
+// List returns the kept notifications, oldest first.
+func (s *DeadLetterStore) List() []DeadLetter {
+	s.Lock()
+	defer s.Unlock()
+	letters := []DeadLetter{}
+	for _, letter := range s.letters {
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if letters[i].FailedAt.Equal(letters[j].FailedAt) {
+			return letters[i].ID < letters[j].ID
+		}
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+	return letters
+}
+
+func (s *DeadLetterStore) Get(id string) (DeadLetter, bool) {
+	s.Lock()
+	defer s.Unlock()
+	letter, found := s.letters[id]
+	return letter, found
+}
+
+// Retry delivers a kept notification again with the given notifier, and forgets it once it has been delivered.
+func (s *DeadLetterStore) Retry(letter DeadLetter, notifier Notifier) (DeadLetter, error) {
+	event := letter.Event
+	event.Authorities = letter.Authorities
+	sendErr := notifier.SendMessage(event)
+
+	s.Lock()
+	defer s.Unlock()
+	if _, found := s.letters[letter.ID]; !found {
+		// Delivered by a concurrent retry.
+		return letter, sendErr
+	}
+	letter.Attempts++
+	letter.LastAttemptAt = time.Now()
+	if sendErr == nil {
+		delete(s.letters, letter.ID)
+		return letter, s.remove(letter.ID)
+	}
+	letter.Error = sendErr.Error()
+	s.letters[letter.ID] = letter
+	if err := s.save(letter); err != nil {
+		log.WithError(err).WithField("transaction_id", letter.TransactionID).Error("Error saving dead letter")
+	}
+	return letter, sendErr
+}
+
+func (s *DeadLetterStore) save(letter DeadLetter) error {
+	if s.dir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(letter, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written to a temporary file first, so that a crash does not leave a truncated letter behind.
+	tmp := filepath.Join(s.dir, letter.ID+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, letter.ID+".json"))
+}
+
+func (s *DeadLetterStore) remove(id string) error {
+	if s.dir == "" {
+		return nil
+	}
+	err := os.Remove(filepath.Join(s.dir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func newDeadLetterID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type retryResult struct {
+	Retried   int          `json:"retried"`
+	Delivered int          `json:"delivered"`
+	Failed    []DeadLetter `json:"failed"`
+}
+
+func (h *Handler) HandleDeadLetters(rw http.ResponseWriter, r *http.Request) {
+	letters := h.deadLetters.List()
+	if tenant := r.URL.Query().Get(Tenant_Param); tenant != "" {
+		filtered := []DeadLetter{}
+		for _, letter := range letters {
+			if letter.Tenant == tenant {
+				filtered = append(filtered, letter)
+			}
+		}
+		letters = filtered
+	}
+	rw.Header().Set("Content-Type", ContentTypeJson)
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(letters)
+}
+
+func (h *Handler) HandleDeadLetterRetry(rw http.ResponseWriter, r *http.Request) {
+	letter, found := h.deadLetters.Get(mux.Vars(r)[ID_Param])
+	//404
+	if !found {
+		writeProblem(rw, Problem{Status: http.StatusNotFound, Code: CodeDeadLetterNotFound, Detail: "Unable to find dead letter", TransactionID: transactionidutils.GetTransactionIDFromRequest(r)})
+		return
+	}
+
+	letter, err := h.retryDeadLetter(letter)
+	//503
+	if err != nil {
+		writeProblem(rw, Problem{Status: http.StatusServiceUnavailable, Code: CodeDeliveryFailed, Detail: "Error delivering dead letter", TransactionID: letter.TransactionID, UUID: letter.Event.UUID})
+		return
+	}
+	//200
+	rw.Header().Set("Content-Type", ContentTypeJson)
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(letter)
+}
+
+// HandleDeadLettersRetry delivers every kept notification again, or those of the tenant given as a query parameter.
+func (h *Handler) HandleDeadLettersRetry(rw http.ResponseWriter, r *http.Request) {
+	tenant := r.URL.Query().Get(Tenant_Param)
+	result := retryResult{Failed: []DeadLetter{}}
+	for _, letter := range h.deadLetters.List() {
+		if tenant != "" && letter.Tenant != tenant {
+			continue
+		}
+		result.Retried++
+		if letter, err := h.retryDeadLetter(letter); err != nil {
+			result.Failed = append(result.Failed, letter)
+		} else {
+			result.Delivered++
+		}
+	}
+	log.WithFields(log.Fields{"tenant": tenant, "retried": result.Retried, "delivered": result.Delivered}).Info("Retried dead letters")
+
+	rw.Header().Set("Content-Type", ContentTypeJson)
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(result)
+}
+
+func (h *Handler) retryDeadLetter(letter DeadLetter) (DeadLetter, error) {
+	srv := h.srv
+	if letter.Tenant != DefaultTenant {
+		tenant, found := h.tenants[letter.Tenant]
+		if !found {
+			err := fmt.Errorf("Unknown tenant (%s)", letter.Tenant)
+			log.WithError(err).WithField("transaction_id", letter.TransactionID).Error("Unable to retry dead letter")
+			return letter, err
+		}
+		srv = tenant
+	}
+
+	letter, err := h.deadLetters.Retry(letter, srv.getNotifier())
+	logEntry := log.WithFields(log.Fields{"UUID": letter.Event.UUID, "transaction_id": letter.TransactionID, "dead_letter": letter.ID, "attempts": letter.Attempts})
+	if err != nil {
+		logEntry.WithError(err).Error("Error delivering dead letter")
+	} else {
+		logEntry.Info("Delivered dead letter")
+	}
+	return letter, err
+}
@@ -0,0 +1,152 @@
+package concordances
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterStore_Persists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dead-letters")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewDeadLetterStore(dir)
+	assert.NoError(t, err)
+	event := sns.NewEvent(sns.EventCreated, UuidA, "tid_1", nil, []string{UuidB})
+	event.Authorities = []string{"TME"}
+	letter, err := store.Add("factset", event, errors.New(SNS_ERROR))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, letter.Attempts)
+	assert.Equal(t, "tid_1", letter.TransactionID)
+	assert.Equal(t, SNS_ERROR, letter.Error)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.Len(t, files, 1, "Dead letter should be written to the directory")
+
+	reloaded, err := NewDeadLetterStore(dir)
+	assert.NoError(t, err)
+	letters := reloaded.List()
+	assert.Len(t, letters, 1, "Dead letters should survive a restart")
+	assert.Equal(t, letter.ID, letters[0].ID)
+	assert.Equal(t, "factset", letters[0].Tenant)
+	assert.Equal(t, UuidA, letters[0].Event.UUID)
+	assert.Equal(t, []string{"TME"}, letters[0].Authorities)
+
+	snsClient := &MockSNSClient{Happy: false}
+	retried, err := reloaded.Retry(letters[0], snsClient)
+	assert.Error(t, err)
+	assert.Equal(t, 2, retried.Attempts)
+	stored, _ := reloaded.Get(letter.ID)
+	assert.Equal(t, 2, stored.Attempts, "Failed retry should be counted")
+
+	snsClient.Happy = true
+	_, err = reloaded.Retry(stored, snsClient)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"TME"}, snsClient.events[1].Authorities, "Authorities should be sent again")
+	assert.Empty(t, reloaded.List(), "Delivered dead letter should be forgotten")
+	files, _ = filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.Empty(t, files, "Delivered dead letter should be removed from the directory")
+}
+
+func TestDeadLetterStore_InvalidLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dead-letters")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0644))
+
+	_, err = NewDeadLetterStore(dir)
+	assert.Error(t, err)
+}
+
+func TestService_KeepsDeadLetters(t *testing.T) {
+	store, _ := NewDeadLetterStore("")
+	srv := createService(&MockDynamoDBClient{Happy: true}, &MockSNSClient{Happy: false})
+	srv.deadLetters = store
+	srv.tenant = "factset"
+
+	status, err := srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "tid_write")
+	assert.NoError(t, err, "Write whose notification was kept should not be retried by the client")
+	assert.Equal(t, db.CONCORDANCE_CREATED, status)
+	status, err = srv.Delete(EXPECTED_UUID, "tid_delete")
+	assert.NoError(t, err, "Delete whose notification was kept should not be retried by the client")
+	assert.Equal(t, db.CONCORDANCE_DELETED, status)
+
+	letters := store.List()
+	assert.Len(t, letters, 2, "Failed notifications should be kept")
+	assert.Equal(t, sns.EventCreated, letters[0].Event.Type)
+	assert.Equal(t, "tid_write", letters[0].TransactionID)
+	assert.Equal(t, sns.EventDeleted, letters[1].Event.Type)
+	assert.Equal(t, "factset", letters[1].Tenant)
+}
+
+func TestService_FailsWithoutDeadLetters(t *testing.T) {
+	srv := createService(&MockDynamoDBClient{Happy: true}, &MockSNSClient{Happy: false})
+
+	status, err := srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "tid_write")
+	assert.Error(t, err, "Write whose notification was not kept should fail for the client to retry it")
+	assert.Equal(t, db.CONCORDANCE_ERROR, status)
+}
+
+func TestHandler_DeadLetters(t *testing.T) {
+	store, _ := NewDeadLetterStore("")
+	defaultSNS := &MockSNSClient{Happy: true}
+	tenantSNS := &MockSNSClient{Happy: false}
+	srv := createService(&MockDynamoDBClient{Happy: true}, defaultSNS)
+	tenant := createService(&MockDynamoDBClient{Happy: true}, tenantSNS)
+	router := mux.NewRouter()
+	NewHandler(router, AppConfig{DeadLetters: store}, &srv, map[string]Service{"factset": &tenant})
+
+	first, _ := store.Add(DefaultTenant, sns.NewEvent(sns.EventCreated, UuidA, "tid_1", nil, []string{UuidB}), errors.New(SNS_ERROR))
+	store.Add("factset", sns.NewEvent(sns.EventCreated, UuidC, "tid_2", nil, []string{UuidD}), errors.New(SNS_ERROR))
+	store.Add(DefaultTenant, sns.NewEvent(sns.EventDeleted, UuidE, "tid_3", []string{UuidB}, nil), errors.New(SNS_ERROR))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("GET", deadLettersPath, ""))
+	assert.Equal(t, 200, rec.Result().StatusCode)
+	letters := []DeadLetter{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&letters))
+	assert.Len(t, letters, 3)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("GET", deadLettersPath+"?tenant=factset", ""))
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&letters))
+	assert.Len(t, letters, 1, "Dead letters should be filtered by tenant")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("POST", deadLettersPath+"/"+first.ID+"/retry", ""))
+	assert.Equal(t, 200, rec.Result().StatusCode)
+	assert.Equal(t, UuidA, defaultSNS.events[0].UUID, "Dead letter should be sent by the notifier of its tenant")
+	assert.Len(t, store.List(), 2)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("POST", deadLettersPath+"/"+first.ID+"/retry", ""))
+	assert.Equal(t, 404, rec.Result().StatusCode, "Delivered dead letter should be gone")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("POST", deadLettersPath+"/retry", ""))
+	assert.Equal(t, 200, rec.Result().StatusCode)
+	result := retryResult{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	assert.Equal(t, 2, result.Retried)
+	assert.Equal(t, 1, result.Delivered)
+	assert.Len(t, result.Failed, 1)
+	assert.Equal(t, "factset", result.Failed[0].Tenant)
+	assert.Equal(t, 2, result.Failed[0].Attempts)
+	assert.Len(t, tenantSNS.events, 1)
+
+	remaining := store.List()
+	assert.Len(t, remaining, 1)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("POST", deadLettersPath+"/"+remaining[0].ID+"/retry", ""))
+	assert.Equal(t, 503, rec.Result().StatusCode, "Failed retry should be reported")
+}
@@ -0,0 +1,43 @@
+package concordances
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// etag identifies the body of a response, so that a client can ask for a concordance only if it has changed since
+// it last read it. Identical concordances have the same ETag whichever instance of the service serves them.
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified reports whether the client already has the representation of a concordance, according to
+// If-None-Match, or to If-Modified-Since when the request has no If-None-Match and the concordance has a modification time.
+func notModified(r *http.Request, etag string, lastModified *time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return etagMatches(match, etag)
+	}
+	if lastModified == nil {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// etagMatches compares the ETags of If-None-Match with the weak comparison, e.g. W/"abc" matches "abc".
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package concordances
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTable holds the items of a DynamoDB table in memory, applying the SET and REMOVE clauses of plain updates.
+type fakeTable struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (f *fakeTable) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.items[*input.Key[db.TableHashKey].S]}, nil
+}
+
+func (f *fakeTable) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	key := input.Key[db.TableHashKey]
+	old := f.items[*key.S]
+	item := map[string]*dynamodb.AttributeValue{db.TableHashKey: key}
+	for name, value := range old {
+		item[name] = value
+	}
+	name := func(name string) string {
+		if alias, ok := input.ExpressionAttributeNames[name]; ok {
+			return *alias
+		}
+		return name
+	}
+	set, remove, _ := strings.Cut(strings.TrimPrefix(*input.UpdateExpression, "SET "), " REMOVE ")
+	for _, clause := range strings.Split(set, ", ") {
+		attribute, value, _ := strings.Cut(clause, " = ")
+		item[name(attribute)] = input.ExpressionAttributeValues[value]
+	}
+	if remove != "" {
+		for _, attribute := range strings.Split(remove, ", ") {
+			delete(item, name(attribute))
+		}
+	}
+	f.items[*key.S] = item
+	return &dynamodb.UpdateItemOutput{Attributes: old}, nil
+}
+
+func getWithHeaders(method string, url string, headers map[string]string) *httptest.ResponseRecorder {
+	req := newRequest(method, url, "")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_GetETag(t *testing.T) {
+	h.srv = &MockService{model: db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2}}}
+
+	rec := getWithHeaders("GET", Path, nil)
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, GoodBody, rec.Body.String())
+	tag := rec.Header().Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, tag)
+	assert.Empty(t, rec.Header().Get("Last-Modified"), "Concordances without a modification time should have no Last-Modified")
+
+	again := getWithHeaders("GET", Path, nil)
+	assert.Equal(t, tag, again.Header().Get("ETag"), "ETag should be stable")
+
+	filtered := getWithHeaders("GET", Path+"?authority=TME", nil)
+	assert.Equal(t, 404, filtered.Code)
+
+	h.srv = &MockService{model: db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1}}}
+	changed := getWithHeaders("GET", Path, nil)
+	assert.NotEqual(t, tag, changed.Header().Get("ETag"), "ETag should change with the concordance")
+}
+
+func TestHandler_GetIfNoneMatch(t *testing.T) {
+	h.srv = &MockService{model: db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2}}}
+	tag := getWithHeaders("GET", Path, nil).Header().Get("ETag")
+
+	testCases := []struct {
+		description          string
+		ifNoneMatch          string
+		expectedResponseCode int
+	}{
+		{"Matching ETag", tag, 304},
+		{"Weak matching ETag", "W/" + tag, 304},
+		{"One of several ETags", `"other", ` + tag, 304},
+		{"Any ETag", "*", 304},
+		{"Other ETag", `"other"`, 200},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			rec := getWithHeaders("GET", Path, map[string]string{"If-None-Match": testCase.ifNoneMatch})
+
+			assert.Equal(t, testCase.expectedResponseCode, rec.Code, "Response code incorrect.")
+			assert.Equal(t, tag, rec.Header().Get("ETag"))
+			if testCase.expectedResponseCode == 304 {
+				assert.Empty(t, rec.Body.String(), "Not modified responses should have no body")
+			}
+		})
+	}
+}
+
+func TestHandler_GetLastModified(t *testing.T) {
+	lastModified := time.Date(2017, 11, 1, 12, 0, 0, 0, time.UTC)
+	h.srv = &MockService{model: db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1}, LastModified: &lastModified}}
+
+	rec := getWithHeaders("GET", Path, nil)
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "Wed, 01 Nov 2017 12:00:00 GMT", rec.Header().Get("Last-Modified"))
+	assert.NotContains(t, rec.Body.String(), "lastModified", "Modification time should not be part of the concordance")
+
+	rec = getWithHeaders("GET", Path, map[string]string{"If-Modified-Since": "Wed, 01 Nov 2017 12:00:00 GMT"})
+	assert.Equal(t, 304, rec.Code)
+
+	rec = getWithHeaders("GET", Path, map[string]string{"If-Modified-Since": "Wed, 01 Nov 2017 11:59:59 GMT"})
+	assert.Equal(t, 200, rec.Code)
+
+	rec = getWithHeaders("GET", Path, map[string]string{"If-Modified-Since": "Wed, 01 Nov 2017 12:00:00 GMT", "If-None-Match": `"other"`})
+	assert.Equal(t, 200, rec.Code, "If-None-Match should take precedence over If-Modified-Since")
+}
+
+func TestHandler_LastModifiedOfWrittenConcordance(t *testing.T) {
+	srv := createService(db.NewDynamoDBClientWithAPI("TestTable", &fakeTable{items: map[string]map[string]*dynamodb.AttributeValue{}}), &MockSNSClient{Happy: true})
+	r := mux.NewRouter()
+	NewHandler(r, AppConfig{}, &srv, nil)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	written := time.Now().Truncate(time.Second)
+
+	rec := serve(newRequest("PUT", Path, `{"uuid":"`+TestConceptUuid+`","identifiers":[{"authority":"TME","identifierValue":"tme-1","uuid":"`+ConcordedUuid1+`"}]}`))
+	assert.Equal(t, 201, rec.Code, rec.Body.String())
+
+	rec = serve(newRequest("GET", Path, ""))
+	assert.Equal(t, 200, rec.Code)
+	lastModified, err := http.ParseTime(rec.Header().Get("Last-Modified"))
+	assert.NoError(t, err, "Written concordance should have a Last-Modified")
+	assert.False(t, lastModified.Before(written), "Last-Modified should be the time of the write")
+
+	req := newRequest("GET", Path+"?authority=TME", "")
+	req.Header.Set("If-Modified-Since", rec.Header().Get("Last-Modified"))
+	rec = serve(req)
+	assert.Equal(t, 304, rec.Code, "Authority-filtered concordance should keep its modification time")
+}
+
+func TestHandler_Head(t *testing.T) {
+	h.srv = &MockService{model: db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2}}}
+
+	rec := getWithHeaders("HEAD", Path, nil)
+	assert.Equal(t, 200, rec.Code)
+	assert.Empty(t, rec.Body.String(), "HEAD responses should have no body")
+	assert.Equal(t, ContentTypeJson, rec.Header().Get("Content-Type"))
+	assert.Equal(t, strconv.Itoa(len(GoodBody)), rec.Header().Get("Content-Length"))
+	assert.Equal(t, getWithHeaders("GET", Path, nil).Header().Get("ETag"), rec.Header().Get("ETag"))
+
+	rec = getWithHeaders("HEAD", Path, map[string]string{"If-None-Match": rec.Header().Get("ETag")})
+	assert.Equal(t, 304, rec.Code)
+
+	h.srv = &MockService{}
+	rec = getWithHeaders("HEAD", Path, nil)
+	assert.Equal(t, 404, rec.Code)
+}
@@ -0,0 +1,81 @@
+package concordances
+
+import (
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const DefaultExpirySweepInterval = time.Hour
+
+// startExpirySweep purges the expired records of the table at the given interval, until the process exits.
+// Reads only hide expired records, so that they have no side effects.
+func (s *ConcordancesRwService) startExpirySweep(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			s.SweepExpired()
+		}
+	}()
+}
+
+// SweepExpired purges every record of the table that has expired, and announces the expiry of each as its deletion.
+// DynamoDB purges expired records too, but without the service hearing about it.
+func (s *ConcordancesRwService) SweepExpired() {
+	expirer, ok := s.ddb.(db.Expirer)
+	if !ok {
+		return
+	}
+	transactionId := transactionidutils.NewTransactionID()
+	err := expirer.ScanExpired(func(uuid string) error {
+		s.expire(expirer, uuid, transactionId)
+		return nil
+	})
+	if err != nil {
+		s.counters.inc(&s.counters.errors)
+		log.WithError(err).WithFields(log.Fields{"tenant": s.tenant, "transaction_id": transactionId}).Error("Error sweeping expired concordance records")
+	}
+}
+
+func (s *ConcordancesRwService) expire(expirer db.Expirer, uuid string, transactionId string) {
+	expired, err := expirer.Expire(uuid, transactionId)
+	if err != nil {
+		s.counters.inc(&s.counters.errors)
+		return
+	}
+	if !expired.Expired {
+		return
+	}
+	s.counters.inc(&s.counters.deletes)
+
+	// The stream publisher announces the expiry like any other deletion.
+	if s.publisher != nil {
+		return
+	}
+	if err := s.mirror.delete(uuid); err != nil {
+		s.counters.inc(&s.counters.errors)
+		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error deleting expired Concordance from the mirror")
+	}
+	if s.dispatcher != nil {
+		s.dispatcher.Dispatch(uuid)
+		return
+	}
+	s.notifyExpired(expired, transactionId)
+}
+
+// notifyExpired announces the expiry of a record as its deletion. Expiries that cannot be announced are kept as dead letters.
+func (s *ConcordancesRwService) notifyExpired(expired db.ConcordancesModel, transactionId string) {
+	uuid := expired.UUID
+	event := sns.NewEvent(sns.EventDeleted, uuid, transactionId, expired.ConcordedIds, nil)
+	event.Authorities = db.Authorities(expired)
+	if err := s.notifier.SendMessage(event); err != nil {
+		s.counters.inc(&s.counters.errors)
+		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error notifying expired Concordance")
+		s.keepDeadLetter(event, err)
+		return
+	}
+	s.counters.inc(&s.counters.snsPublishes)
+	log.WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Info("Notified expiry of Concordance")
+}
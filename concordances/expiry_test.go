@@ -0,0 +1,99 @@
+package concordances
+
+import (
+	"errors"
+	"testing"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/stretchr/testify/assert"
+)
+
+// MockExpiringDynamoDBClient holds expired records, which are purged only once.
+type MockExpiringDynamoDBClient struct {
+	MockDynamoDBClient
+	expired   map[string]db.ConcordancesModel
+	expireErr error
+}
+
+func (ddb *MockExpiringDynamoDBClient) ScanExpired(fn func(uuid string) error) error {
+	for uuid := range ddb.expired {
+		if err := fn(uuid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ddb *MockExpiringDynamoDBClient) Expire(uuid string, transactionId string) (db.ConcordancesModel, error) {
+	if ddb.expireErr != nil {
+		return db.ConcordancesModel{}, ddb.expireErr
+	}
+	expired, found := ddb.expired[uuid]
+	if !found {
+		return db.ConcordancesModel{}, nil
+	}
+	delete(ddb.expired, uuid)
+	expired.Expired = true
+	return expired, nil
+}
+
+func expiringClient() *MockExpiringDynamoDBClient {
+	return &MockExpiringDynamoDBClient{
+		MockDynamoDBClient: MockDynamoDBClient{Happy: true, expired: true},
+		expired:            map[string]db.ConcordancesModel{EXPECTED_UUID: {UUID: EXPECTED_UUID, ConcordedIds: []string{"A", "B"}}},
+	}
+}
+
+func TestSweepExpired_AnnouncesExpiry(t *testing.T) {
+	snsClient := &MockSNSClient{Happy: true}
+	mirror := NewMockMirror()
+	mirror.documents[MIRROR_KEY] = []byte("{}")
+	srv := createService(expiringClient(), snsClient)
+	srv.mirror = &documentMirror{store: mirror, layout: sns.KeyLayout{}}
+
+	srv.SweepExpired()
+
+	assert.Len(t, snsClient.events, 1, "Expiry was not announced")
+	assert.Equal(t, sns.EventDeleted, snsClient.events[0].Type, "Expiry should be announced as a deletion")
+	assert.Equal(t, []string{"A", "B"}, snsClient.events[0].OldConcordedIds)
+	assert.Empty(t, mirror.documents, "Expired concordance was not deleted from the mirror")
+
+	srv.SweepExpired()
+
+	assert.Len(t, snsClient.events, 1, "Expiry should only be announced once")
+}
+
+func TestSweepExpired_KeepsUndeliveredExpiry(t *testing.T) {
+	deadLetters, err := NewDeadLetterStore("")
+	assert.NoError(t, err)
+	srv := createService(expiringClient(), &MockSNSClient{Happy: false})
+	srv.deadLetters = deadLetters
+
+	srv.SweepExpired()
+
+	assert.Len(t, deadLetters.List(), 1, "Expiry that could not be announced should be kept as a dead letter")
+}
+
+func TestSweepExpired_DispatchesFromOutbox(t *testing.T) {
+	snsClient := &MockSNSClient{Happy: true}
+	srv := createService(expiringClient(), snsClient)
+	srv.dispatcher = NewDispatcher(&MockOutbox{changes: map[string][]db.Change{}}, snsClient, &srv.counters)
+
+	srv.SweepExpired()
+
+	assert.False(t, snsClient.Invoked, "Expiry should be announced by the dispatcher")
+	assert.Len(t, srv.dispatcher.queue, 1)
+}
+
+func TestSweepExpired_CountsErrors(t *testing.T) {
+	ddb := expiringClient()
+	ddb.expireErr = errors.New(DDB_ERROR)
+	snsClient := &MockSNSClient{Happy: true}
+	srv := createService(ddb, snsClient)
+
+	srv.SweepExpired()
+
+	assert.False(t, snsClient.Invoked)
+	assert.Equal(t, int64(1), srv.counters.snapshot().Errors)
+}
@@ -0,0 +1,28 @@
+package concordances
+
+import "github.com/Financial-Times/concordances-rw-dynamodb/sns"
+
+// BatchNotifier is implemented by notifiers that can send several events at once.
+type BatchNotifier interface {
+	SendMessages(events []sns.Event) error
+}
+
+// fanOutNotifier announces a change to the concept whose concordance changed and to every concept added to or removed
+// from it, in one batch when the notifier supports it. Sending fails unless every event was sent, so that the change
+// is announced again as a whole.
+type fanOutNotifier struct {
+	Notifier
+}
+
+func (n fanOutNotifier) SendMessage(event sns.Event) error {
+	events := sns.FanOut(event)
+	if batch, ok := n.Notifier.(BatchNotifier); ok && len(events) > 1 {
+		return batch.SendMessages(events)
+	}
+	for _, e := range events {
+		if err := n.Notifier.SendMessage(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package concordances
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockBatchNotifier struct {
+	MockSNSClient
+	batches [][]sns.Event
+	err     error
+}
+
+func (c *MockBatchNotifier) SendMessages(events []sns.Event) error {
+	c.batches = append(c.batches, events)
+	return c.err
+}
+
+func TestFanOutNotifier_SendsEventPerAffectedConcept(t *testing.T) {
+	snsClient := &MockSNSClient{Happy: true}
+	notifier := fanOutNotifier{snsClient}
+
+	assert.NoError(t, notifier.SendMessage(sns.NewEvent(sns.EventUpdated, EXPECTED_UUID, "tid_1", []string{"B", "C"}, []string{"C", "D"})))
+
+	assert.Len(t, snsClient.events, 3)
+	assert.Equal(t, EXPECTED_UUID, snsClient.events[0].UUID)
+	assert.Equal(t, "D", snsClient.events[1].UUID)
+	assert.Equal(t, "B", snsClient.events[2].UUID)
+}
+
+func TestFanOutNotifier_Batches(t *testing.T) {
+	batchClient := &MockBatchNotifier{MockSNSClient: MockSNSClient{Happy: true}}
+	notifier := fanOutNotifier{batchClient}
+
+	assert.NoError(t, notifier.SendMessage(sns.NewEvent(sns.EventCreated, EXPECTED_UUID, "tid_1", nil, []string{"B", "C"})))
+	assert.Len(t, batchClient.batches, 1)
+	assert.Len(t, batchClient.batches[0], 3)
+	assert.False(t, batchClient.Invoked)
+
+	assert.NoError(t, notifier.SendMessage(sns.NewEvent(sns.EventUpdated, EXPECTED_UUID, "tid_2", []string{"B"}, []string{"B"})))
+	assert.Len(t, batchClient.batches, 1, "Unaffected concepts should not be batched")
+	assert.Len(t, batchClient.events, 1)
+
+	batchClient.err = errors.New(SNS_ERROR)
+	assert.Error(t, notifier.SendMessage(sns.NewEvent(sns.EventDeleted, EXPECTED_UUID, "tid_3", []string{"B"}, nil)))
+}
+
+func TestFanOutNotifier_StopsAtFailure(t *testing.T) {
+	snsClient := &FailingSNSClient{MockSNSClient: MockSNSClient{Happy: true}, failAfter: 1}
+	notifier := fanOutNotifier{snsClient}
+
+	assert.Error(t, notifier.SendMessage(sns.NewEvent(sns.EventCreated, EXPECTED_UUID, "tid_1", nil, []string{"B", "C"})))
+	assert.Len(t, snsClient.events, 1)
+}
+
+func TestNewNotifier_FanOut(t *testing.T) {
+	notifier := newNotifier(AppConfig{Notifier: NotifierWebhook, NotificationFanOut: true})
+	_, ok := notifier.(fanOutNotifier)
+	assert.True(t, ok)
+
+	notifier = newNotifier(AppConfig{Notifier: NotifierWebhook})
+	_, ok = notifier.(fanOutNotifier)
+	assert.False(t, ok)
+}
@@ -0,0 +1,324 @@
+package concordances
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/awserrors"
+	"github.com/Financial-Times/concordances-rw-dynamodb/concordancespb"
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/transactionid-utils-go"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// grpcHealthInterval is the interval between updates of the status reported by the health service.
+	grpcHealthInterval = 10 * time.Second
+	// grpcTransactionIDKey is the metadata key of the transaction id, the X-Request-Id header of the REST API.
+	grpcTransactionIDKey = "x-request-id"
+	maxBatchGetUUIDs     = 100
+)
+
+// GRPCServer serves the concordances of the service and its tenants over gRPC, with the same validation as the REST API.
+// The standard health service reports the concordances service as serving while it is good to go.
+type GRPCServer struct {
+	concordancespb.UnimplementedConcordancesServer
+	port            string
+	srv             Service
+	tenants         map[string]Service
+	maxConcordedIds int
+	health          *health.Server
+	healthService   *healthService
+}
+
+func NewGRPCServer(conf AppConfig, srv Service, tenants map[string]Service) *GRPCServer {
+	healthcheckConfig := &healthConfig{appSystemCode: conf.AppSystemCode, appName: conf.AppName, port: conf.GRPCPort, srv: srv, tenants: tenants, notifier: conf.Notifier}
+	return &GRPCServer{port: conf.GRPCPort, srv: srv, tenants: tenants, maxConcordedIds: conf.MaxConcordedIds, health: health.NewServer(), healthService: newHealthService(healthcheckConfig)}
+}
+
+// Register adds the concordances and health services to a gRPC server.
+func (s *GRPCServer) Register(server *grpc.Server) {
+	concordancespb.RegisterConcordancesServer(server, s)
+	healthpb.RegisterHealthServer(server, s.health)
+}
+
+// ListenAndServe serves gRPC requests on the gRPC port until the server stops.
+func (s *GRPCServer) ListenAndServe() error {
+	listener, err := net.Listen("tcp", ":"+s.port)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	s.Register(server)
+
+	s.checkHealth()
+	go func() {
+		for range time.Tick(grpcHealthInterval) {
+			s.checkHealth()
+		}
+	}()
+	return server.Serve(listener)
+}
+
+func (s *GRPCServer) checkHealth() {
+	serving := healthpb.HealthCheckResponse_SERVING
+	if gtg := s.healthService.gtg(); !gtg.GoodToGo {
+		log.WithField("reason", gtg.Message).Warn("gRPC service is not serving")
+		serving = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	s.health.SetServingStatus("", serving)
+	s.health.SetServingStatus(concordancespb.Concordances_ServiceDesc.ServiceName, serving)
+}
+
+func (s *GRPCServer) Get(ctx context.Context, req *concordancespb.GetRequest) (*concordancespb.Concordance, error) {
+	tid := grpcTransactionID(ctx)
+	uuid := normaliseUUID(req.Uuid)
+	tenant, srv, err := lookupTenant(s.srv, s.tenants, req.Tenant)
+	if err != nil {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error(err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer tenantTimer(tenant, "grpc.Get").UpdateSince(time.Now())
+
+	concordance, err := s.read(tenant, srv, "grpc.Get", uuid, req.Authority, tid)
+	if err != nil {
+		return nil, err
+	}
+	if concordance == nil {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Info("Unable to find concordance")
+		return nil, status.Error(codes.NotFound, "Unable to find concordance")
+	}
+	return concordance, nil
+}
+
+func (s *GRPCServer) BatchGet(ctx context.Context, req *concordancespb.BatchGetRequest) (*concordancespb.BatchGetResponse, error) {
+	tid := grpcTransactionID(ctx)
+	tenant, srv, err := lookupTenant(s.srv, s.tenants, req.Tenant)
+	if err != nil {
+		log.WithField("transaction_id", tid).Error(err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if len(req.Uuids) > maxBatchGetUUIDs {
+		return nil, status.Errorf(codes.InvalidArgument, "Batch has %d UUIDs, the maximum is %d", len(req.Uuids), maxBatchGetUUIDs)
+	}
+	defer tenantTimer(tenant, "grpc.BatchGet").UpdateSince(time.Now())
+
+	resp := &concordancespb.BatchGetResponse{}
+	seen := map[string]bool{}
+	for _, uuid := range req.Uuids {
+		uuid = normaliseUUID(uuid)
+		if seen[uuid] {
+			continue
+		}
+		seen[uuid] = true
+		concordance, err := s.read(tenant, srv, "grpc.BatchGet", uuid, req.Authority, tid)
+		if err != nil {
+			return nil, err
+		}
+		if concordance == nil {
+			resp.Missing = append(resp.Missing, uuid)
+			continue
+		}
+		resp.Concordances = append(resp.Concordances, concordance)
+	}
+	return resp, nil
+}
+
+// read reads the concordance of a concept, nil when it has none, or none of the authority when one is given.
+func (s *GRPCServer) read(tenant string, srv Service, method string, uuid string, authority string, tid string) (*concordancespb.Concordance, error) {
+	if !uuidRegex.MatchString(uuid) {
+		return nil, status.Errorf(codes.InvalidArgument, "Concept UUID (%s) is not a valid UUID", uuid)
+	}
+	model, err := srv.Read(uuid, tid)
+	if err != nil {
+		tenantErrors(tenant, method).Inc(1)
+		return nil, storeError(err, "Error retrieving concordances")
+	}
+	if model.ConcordedIds == nil {
+		return nil, nil
+	}
+	if authority != "" {
+		model = filterByAuthority(model, authority)
+		if len(model.Identifiers) == 0 {
+			return nil, nil
+		}
+	}
+	return toConcordance(model), nil
+}
+
+func (s *GRPCServer) Put(ctx context.Context, req *concordancespb.PutRequest) (*concordancespb.PutResponse, error) {
+	tid := grpcTransactionID(ctx)
+	model := fromConcordance(req.Concordance)
+	uuid := normaliseUUID(model.UUID)
+	tenant, srv, err := lookupTenant(s.srv, s.tenants, req.Tenant)
+	if err != nil {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error(err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer tenantTimer(tenant, "grpc.Put").UpdateSince(time.Now())
+
+	if msg, violations := validatePut(uuid, model, s.maxConcordedIds); msg != "" {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid, "violations": len(violations)}).Error(msg)
+		return nil, invalidConcordance(msg, violations)
+	}
+
+	st, err := srv.Write(normaliseConcordance(model), tid)
+	if err != nil || st == db.CONCORDANCE_ERROR {
+		tenantErrors(tenant, "grpc.Put").Inc(1)
+		return nil, storeError(err, "Error writing concordance")
+	}
+	return &concordancespb.PutResponse{Created: st == db.CONCORDANCE_CREATED}, nil
+}
+
+func (s *GRPCServer) Delete(ctx context.Context, req *concordancespb.DeleteRequest) (*concordancespb.DeleteResponse, error) {
+	tid := grpcTransactionID(ctx)
+	uuid := normaliseUUID(req.Uuid)
+	tenant, srv, err := lookupTenant(s.srv, s.tenants, req.Tenant)
+	if err != nil {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error(err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !uuidRegex.MatchString(uuid) {
+		return nil, status.Errorf(codes.InvalidArgument, "Concept UUID (%s) is not a valid UUID", req.Uuid)
+	}
+	defer tenantTimer(tenant, "grpc.Delete").UpdateSince(time.Now())
+
+	st, err := srv.Delete(uuid, tid)
+	if err != nil || st == db.CONCORDANCE_ERROR {
+		tenantErrors(tenant, "grpc.Delete").Inc(1)
+		return nil, storeError(err, "Error deleting concordance")
+	}
+	if st == db.CONCORDANCE_NOT_FOUND {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Info("Unable to find concordance")
+		return nil, status.Error(codes.NotFound, "Unable to find concordance")
+	}
+	return &concordancespb.DeleteResponse{}, nil
+}
+
+// List streams every live concordance of the table, scanning it one page at a time.
+func (s *GRPCServer) List(req *concordancespb.ListRequest, stream concordancespb.Concordances_ListServer) error {
+	tid := grpcTransactionID(stream.Context())
+	tenant, srv, err := lookupTenant(s.srv, s.tenants, req.Tenant)
+	if err != nil {
+		log.WithField("transaction_id", tid).Error(err.Error())
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	scanner, ok := srv.getDBClient().(db.Scanner)
+	if !ok {
+		return status.Error(codes.Unimplemented, "Listing concordances is not supported by the table")
+	}
+	defer tenantTimer(tenant, "grpc.List").UpdateSince(time.Now())
+
+	now := time.Now()
+	err = scanner.Scan(func(m db.ConcordancesModel) error {
+		if m.ExpiresAt != nil && !m.ExpiresAt.After(now) {
+			return nil
+		}
+		if req.Authority != "" {
+			if m = filterByAuthority(m, req.Authority); len(m.Identifiers) == 0 {
+				return nil
+			}
+		}
+		return stream.Send(toConcordance(m))
+	})
+	if err != nil {
+		if ctxErr := stream.Context().Err(); ctxErr != nil {
+			return status.FromContextError(ctxErr).Err()
+		}
+		tenantErrors(tenant, "grpc.List").Inc(1)
+		log.WithError(err).WithFields(log.Fields{"transaction_id": tid, "tenant": tenant}).Error("Error listing concordances")
+		return storeError(err, "Error listing concordances")
+	}
+	return nil
+}
+
+// grpcTransactionID returns the transaction id of a request, a new one when it has none.
+func grpcTransactionID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(grpcTransactionIDKey); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return transactionidutils.NewTransactionID()
+}
+
+// storeError is the error of DynamoDB or SNS by its kind, as storeProblem describes it for the REST API,
+// the store being unavailable when its kind is not known. Throttled requests detail when they can be retried.
+func storeError(err error, msg string) error {
+	switch awserrors.KindOf(err) {
+	case awserrors.KindThrottled:
+		st, detailErr := status.New(codes.ResourceExhausted, msg).WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(throttledRetryAfter)})
+		if detailErr != nil {
+			return status.Error(codes.ResourceExhausted, msg)
+		}
+		return st.Err()
+	case awserrors.KindAccessDenied, awserrors.KindNotFound:
+		return status.Error(codes.Internal, msg)
+	case awserrors.KindValidation:
+		if awserrors.ServiceOf(err) == awserrors.ServiceSNS {
+			return status.Error(codes.Internal, msg)
+		}
+		return status.Error(codes.InvalidArgument, msg)
+	case awserrors.KindTimeout:
+		return status.Error(codes.DeadlineExceeded, msg)
+	}
+	return status.Error(codes.Unavailable, msg)
+}
+
+// invalidConcordance is the INVALID_ARGUMENT error of a concordance, detailing its violations as field violations.
+func invalidConcordance(msg string, violations []Violation) error {
+	st := status.New(codes.InvalidArgument, msg)
+	if len(violations) == 0 {
+		return st.Err()
+	}
+	details := &errdetails.BadRequest{}
+	for _, v := range violations {
+		description := v.Message
+		if v.Value != "" {
+			description = fmt.Sprintf("%s %s", v.Value, v.Message)
+		}
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: v.Field, Description: description})
+	}
+	withDetails, err := st.WithDetails(details)
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+func toConcordance(m db.ConcordancesModel) *concordancespb.Concordance {
+	c := &concordancespb.Concordance{Uuid: m.UUID, ConcordedIds: m.ConcordedIds}
+	for _, identifier := range m.Identifiers {
+		c.Identifiers = append(c.Identifiers, &concordancespb.Identifier{Authority: identifier.Authority, IdentifierValue: identifier.IdentifierValue, Uuid: identifier.UUID})
+	}
+	if m.ExpiresAt != nil {
+		c.ExpiresAt = timestamppb.New(*m.ExpiresAt)
+	}
+	if m.LastModified != nil {
+		c.LastModified = timestamppb.New(*m.LastModified)
+	}
+	return c
+}
+
+func fromConcordance(c *concordancespb.Concordance) db.ConcordancesModel {
+	m := db.ConcordancesModel{UUID: c.GetUuid(), ConcordedIds: c.GetConcordedIds()}
+	for _, identifier := range c.GetIdentifiers() {
+		m.Identifiers = append(m.Identifiers, db.Identifier{Authority: identifier.Authority, IdentifierValue: identifier.IdentifierValue, UUID: identifier.Uuid})
+	}
+	if c.GetExpiresAt() != nil {
+		expiresAt := c.ExpiresAt.AsTime()
+		m.ExpiresAt = &expiresAt
+	}
+	return m
+}
@@ -0,0 +1,338 @@
+package concordances
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/awserrors"
+	"github.com/Financial-Times/concordances-rw-dynamodb/concordancespb"
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// MockStoreService reads the concordances it holds, by UUID.
+type MockStoreService struct {
+	MockService
+	models map[string]db.ConcordancesModel
+}
+
+func (mock *MockStoreService) Read(uuid string, transaction_id string) (db.ConcordancesModel, error) {
+	if mock.err != nil {
+		return db.ConcordancesModel{}, mock.err
+	}
+	return mock.models[uuid], nil
+}
+
+func newTestGRPCClient(t *testing.T, s *GRPCServer) (concordancespb.ConcordancesClient, healthpb.HealthClient) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	s.Register(server)
+	go server.Serve(listener)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+	return concordancespb.NewConcordancesClient(conn), healthpb.NewHealthClient(conn)
+}
+
+func grpcStoreService() *MockStoreService {
+	return &MockStoreService{models: map[string]db.ConcordancesModel{
+		TestConceptUuid: {
+			UUID:         TestConceptUuid,
+			ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2},
+			Identifiers: []db.Identifier{
+				{Authority: "TME", IdentifierValue: "tme-1", UUID: ConcordedUuid1},
+				{Authority: "FACTSET", IdentifierValue: "factset-1", UUID: ConcordedUuid2},
+			},
+		},
+	}}
+}
+
+func TestGRPCServer_Get(t *testing.T) {
+	client, _ := newTestGRPCClient(t, NewGRPCServer(AppConfig{}, grpcStoreService(), nil))
+
+	concordance, err := client.Get(context.Background(), &concordancespb.GetRequest{Uuid: TestConceptUuid})
+	assert.NoError(t, err)
+	assert.Equal(t, TestConceptUuid, concordance.Uuid)
+	assert.Equal(t, []string{ConcordedUuid1, ConcordedUuid2}, concordance.ConcordedIds)
+	assert.Len(t, concordance.Identifiers, 2)
+	assert.Nil(t, concordance.ExpiresAt)
+
+	concordance, err = client.Get(context.Background(), &concordancespb.GetRequest{Uuid: TestConceptUuid, Authority: "factset"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ConcordedUuid2}, concordance.ConcordedIds)
+
+	_, err = client.Get(context.Background(), &concordancespb.GetRequest{Uuid: TestConceptUuid, Authority: "WIKIDATA"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Get(context.Background(), &concordancespb.GetRequest{Uuid: ConcordedUuid1})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	concordance, err = client.Get(context.Background(), &concordancespb.GetRequest{Uuid: " " + strings.ToUpper(TestConceptUuid)})
+	assert.NoError(t, err, "UUID should be normalised")
+	assert.Equal(t, TestConceptUuid, concordance.Uuid)
+	_, err = client.Get(context.Background(), &concordancespb.GetRequest{Uuid: "not-a-uuid"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.Get(context.Background(), &concordancespb.GetRequest{Tenant: "unknown", Uuid: TestConceptUuid})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCServer_GetUnavailable(t *testing.T) {
+	srv := grpcStoreService()
+	srv.err = errors.New(DDB_ERROR)
+	client, _ := newTestGRPCClient(t, NewGRPCServer(AppConfig{}, srv, nil))
+
+	_, err := client.Get(context.Background(), &concordancespb.GetRequest{Uuid: TestConceptUuid})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestGRPCServer_StoreErrors(t *testing.T) {
+	testCases := []struct {
+		description  string
+		err          error
+		expectedCode codes.Code
+	}{
+		{"Unknown", errors.New(DDB_ERROR), codes.Unavailable},
+		{"Throttled", dbError(awserrors.KindThrottled), codes.ResourceExhausted},
+		{"Notification throttled", snsError(awserrors.KindThrottled), codes.ResourceExhausted},
+		{"Access denied", dbError(awserrors.KindAccessDenied), codes.Internal},
+		{"Notification access denied", snsError(awserrors.KindAccessDenied), codes.Internal},
+		{"Validation", dbError(awserrors.KindValidation), codes.InvalidArgument},
+		{"Notification validation", snsError(awserrors.KindValidation), codes.Internal},
+		{"Missing table", dbError(awserrors.KindNotFound), codes.Internal},
+		{"Missing topic", snsError(awserrors.KindNotFound), codes.Internal},
+		{"Timeout", dbError(awserrors.KindTimeout), codes.DeadlineExceeded},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			srv := grpcStoreService()
+			srv.err = testCase.err
+			client, _ := newTestGRPCClient(t, NewGRPCServer(AppConfig{}, srv, nil))
+
+			_, err := client.Get(context.Background(), &concordancespb.GetRequest{Uuid: TestConceptUuid})
+			assert.Equal(t, testCase.expectedCode, status.Code(err), "Get")
+			_, err = client.Put(context.Background(), &concordancespb.PutRequest{Concordance: &concordancespb.Concordance{Uuid: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1}}})
+			assert.Equal(t, testCase.expectedCode, status.Code(err), "Put")
+			_, err = client.Delete(context.Background(), &concordancespb.DeleteRequest{Uuid: TestConceptUuid})
+			assert.Equal(t, testCase.expectedCode, status.Code(err), "Delete")
+		})
+	}
+}
+
+func TestGRPCServer_ThrottledRetryInfo(t *testing.T) {
+	srv := grpcStoreService()
+	srv.err = dbError(awserrors.KindThrottled)
+	client, _ := newTestGRPCClient(t, NewGRPCServer(AppConfig{}, srv, nil))
+
+	_, err := client.Get(context.Background(), &concordancespb.GetRequest{Uuid: TestConceptUuid})
+
+	st := status.Convert(err)
+	assert.Len(t, st.Details(), 1)
+	retryInfo, ok := st.Details()[0].(*errdetails.RetryInfo)
+	assert.True(t, ok, "Throttled error should detail when it can be retried")
+	if ok {
+		assert.Equal(t, throttledRetryAfter, retryInfo.RetryDelay.AsDuration())
+	}
+}
+
+func TestGRPCServer_GetTenant(t *testing.T) {
+	tenantSrv := grpcStoreService()
+	client, _ := newTestGRPCClient(t, NewGRPCServer(AppConfig{}, &MockStoreService{}, map[string]Service{"factset": tenantSrv}))
+
+	_, err := client.Get(context.Background(), &concordancespb.GetRequest{Uuid: TestConceptUuid})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	concordance, err := client.Get(context.Background(), &concordancespb.GetRequest{Tenant: "factset", Uuid: TestConceptUuid})
+	assert.NoError(t, err)
+	assert.Equal(t, TestConceptUuid, concordance.Uuid)
+}
+
+func TestGRPCServer_BatchGet(t *testing.T) {
+	client, _ := newTestGRPCClient(t, NewGRPCServer(AppConfig{}, grpcStoreService(), nil))
+
+	resp, err := client.BatchGet(context.Background(), &concordancespb.BatchGetRequest{Uuids: []string{TestConceptUuid, ConcordedUuid1, strings.ToUpper(TestConceptUuid)}})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Concordances, 1, "Duplicate UUIDs should be normalised and read once")
+	assert.Equal(t, TestConceptUuid, resp.Concordances[0].Uuid)
+	assert.Equal(t, []string{ConcordedUuid1}, resp.Missing)
+
+	uuids := make([]string, maxBatchGetUUIDs+1)
+	for i := range uuids {
+		uuids[i] = TestConceptUuid
+	}
+	_, err = client.BatchGet(context.Background(), &concordancespb.BatchGetRequest{Uuids: uuids})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCServer_Put(t *testing.T) {
+	srv := &MockService{}
+	client, _ := newTestGRPCClient(t, NewGRPCServer(AppConfig{}, srv, nil))
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+	resp, err := client.Put(context.Background(), &concordancespb.PutRequest{Concordance: &concordancespb.Concordance{
+		Uuid:         " " + TestConceptUuid,
+		ConcordedIds: []string{ConcordedUuid1, ConcordedUuid1},
+		ExpiresAt:    toConcordance(db.ConcordancesModel{ExpiresAt: &expiresAt}).ExpiresAt,
+	}})
+	assert.NoError(t, err)
+	assert.True(t, resp.Created)
+	assert.Equal(t, TestConceptUuid, srv.written.UUID, "Concordance should be normalised")
+	assert.Equal(t, []string{ConcordedUuid1}, srv.written.ConcordedIds)
+	assert.Equal(t, expiresAt, *srv.written.ExpiresAt)
+
+	srv.status = db.CONCORDANCE_UPDATED
+	resp, err = client.Put(context.Background(), &concordancespb.PutRequest{Concordance: &concordancespb.Concordance{Uuid: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1}}})
+	assert.NoError(t, err)
+	assert.False(t, resp.Created)
+
+	srv.err = errors.New(DDB_ERROR)
+	_, err = client.Put(context.Background(), &concordancespb.PutRequest{Concordance: &concordancespb.Concordance{Uuid: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1}}})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestGRPCServer_PutValidation(t *testing.T) {
+	client, _ := newTestGRPCClient(t, NewGRPCServer(AppConfig{}, &MockService{}, nil))
+
+	_, err := client.Put(context.Background(), &concordancespb.PutRequest{Concordance: &concordancespb.Concordance{ConcordedIds: []string{ConcordedUuid1}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "Concept UUID is missing from the Payload", status.Convert(err).Message(), "Validation should be the same as the REST API")
+
+	_, err = client.Put(context.Background(), &concordancespb.PutRequest{})
+	st := status.Convert(err)
+	assert.Equal(t, "Payload is not a valid concordance", st.Message())
+	assert.Len(t, st.Details()[0].(*errdetails.BadRequest).FieldViolations, 2, "Every violation should be reported")
+
+	_, err = client.Put(context.Background(), &concordancespb.PutRequest{Concordance: &concordancespb.Concordance{Uuid: TestConceptUuid}})
+	assert.Equal(t, "Payload has no concorded UUIDs to store", status.Convert(err).Message())
+
+	_, err = client.Put(context.Background(), &concordancespb.PutRequest{Concordance: &concordancespb.Concordance{Uuid: TestConceptUuid, ConcordedIds: []string{"not-a-uuid", TestConceptUuid}}})
+	st = status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, "Payload is not a valid concordance", st.Message())
+	assert.Len(t, st.Details(), 1)
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	assert.True(t, ok, "Violations should be detailed as a bad request")
+	assert.Len(t, badRequest.FieldViolations, 2)
+	assert.Equal(t, "concordedIds[0]", badRequest.FieldViolations[0].Field)
+	assert.Equal(t, "not-a-uuid is not a valid UUID", badRequest.FieldViolations[0].Description)
+	assert.Equal(t, "concordedIds[1]", badRequest.FieldViolations[1].Field)
+}
+
+func TestGRPCServer_Delete(t *testing.T) {
+	srv := &MockService{}
+	client, _ := newTestGRPCClient(t, NewGRPCServer(AppConfig{}, srv, nil))
+
+	_, err := client.Delete(context.Background(), &concordancespb.DeleteRequest{Uuid: strings.ToUpper(TestConceptUuid) + " "})
+	assert.NoError(t, err)
+	assert.Equal(t, TestConceptUuid, srv.deleted, "UUID should be normalised")
+
+	srv.status = db.CONCORDANCE_NOT_FOUND
+	_, err = client.Delete(context.Background(), &concordancespb.DeleteRequest{Uuid: TestConceptUuid})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	srv.err = errors.New(DDB_ERROR)
+	srv.status = db.CONCORDANCE_ERROR
+	_, err = client.Delete(context.Background(), &concordancespb.DeleteRequest{Uuid: TestConceptUuid})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	_, err = client.Delete(context.Background(), &concordancespb.DeleteRequest{Uuid: "not-a-uuid"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func receiveAll(t *testing.T, stream concordancespb.Concordances_ListClient) ([]*concordancespb.Concordance, error) {
+	concordances := []*concordancespb.Concordance{}
+	for {
+		concordance, err := stream.Recv()
+		if err == io.EOF {
+			return concordances, nil
+		}
+		if err != nil {
+			return concordances, err
+		}
+		concordances = append(concordances, concordance)
+	}
+}
+
+func TestGRPCServer_List(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	srv := auditService(
+		db.ConcordancesModel{UUID: UuidA, ConcordedIds: []string{UuidB}, Identifiers: []db.Identifier{{Authority: "TME", IdentifierValue: "1", UUID: UuidB}}},
+		db.ConcordancesModel{UUID: UuidC, ConcordedIds: []string{UuidD}},
+		db.ConcordancesModel{UUID: UuidE, ConcordedIds: []string{UuidD}, ExpiresAt: &past},
+	)
+	client, _ := newTestGRPCClient(t, NewGRPCServer(AppConfig{}, srv, nil))
+
+	stream, err := client.List(context.Background(), &concordancespb.ListRequest{})
+	assert.NoError(t, err)
+	concordances, err := receiveAll(t, stream)
+	assert.NoError(t, err)
+	assert.Len(t, concordances, 2, "Expired concordances should not be listed")
+	assert.Equal(t, UuidA, concordances[0].Uuid)
+	assert.Equal(t, UuidC, concordances[1].Uuid)
+
+	stream, err = client.List(context.Background(), &concordancespb.ListRequest{Authority: "TME"})
+	assert.NoError(t, err)
+	concordances, err = receiveAll(t, stream)
+	assert.NoError(t, err)
+	assert.Len(t, concordances, 1)
+	assert.Equal(t, UuidA, concordances[0].Uuid)
+}
+
+func TestGRPCServer_ListErrors(t *testing.T) {
+	client, _ := newTestGRPCClient(t, NewGRPCServer(AppConfig{}, &MockService{}, nil))
+	stream, err := client.List(context.Background(), &concordancespb.ListRequest{})
+	assert.NoError(t, err)
+	_, err = receiveAll(t, stream)
+	assert.Equal(t, codes.Unimplemented, status.Code(err), "Tables that cannot be scanned cannot be listed")
+
+	srv := auditService()
+	srv.ddb.(*MockScanningDynamoDBClient).err = errors.New(DDB_ERROR)
+	client, _ = newTestGRPCClient(t, NewGRPCServer(AppConfig{}, srv, nil))
+	stream, err = client.List(context.Background(), &concordancespb.ListRequest{})
+	assert.NoError(t, err)
+	_, err = receiveAll(t, stream)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestGRPCServer_Health(t *testing.T) {
+	srv := &MockService{}
+	s := NewGRPCServer(AppConfig{}, srv, nil)
+	_, health := newTestGRPCClient(t, s)
+	service := concordancespb.Concordances_ServiceDesc.ServiceName
+
+	s.checkHealth()
+	resp, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	srv.err = errors.New(SNS_ERROR)
+	s.checkHealth()
+	resp, err = health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+	resp, err = health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+}
+
+func TestGRPCTransactionID(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("X-Request-Id", "tid_grpc"))
+	assert.Equal(t, "tid_grpc", grpcTransactionID(ctx))
+	assert.NotEmpty(t, grpcTransactionID(context.Background()), "A transaction id should be generated")
+}
@@ -14,22 +14,37 @@ import (
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/rcrowley/go-metrics"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	ContentTypeJson = "application/json"
 	UUID_Param      = "uuid"
+	Authority_Param = "authority"
+	ID_Param        = "id"
 )
 
 type Handler struct {
-	srv  Service
-	conf AppConfig
+	srv     Service
+	tenants map[string]Service
+	auditor     *Auditor
+	republisher *Republisher
+	deadLetters *DeadLetterStore
+	conf        AppConfig
 }
 
-func NewHandler(router *mux.Router, conf AppConfig, srv Service) Handler {
-	h := Handler{srv: srv, conf: conf}
-	healthcheckConfig := &healthConfig{appSystemCode: h.conf.AppSystemCode, appName: h.conf.AppName, port: h.conf.Port, srv: srv}
+func NewHandler(router *mux.Router, conf AppConfig, srv Service, tenants map[string]Service) Handler {
+	h := Handler{srv: srv, tenants: tenants, auditor: NewAuditor(srv, tenants, conf.AuditReportDir), republisher: NewRepublisher(conf.RepublishRate), deadLetters: conf.DeadLetters, conf: conf}
+	if h.deadLetters == nil {
+		h.deadLetters, _ = NewDeadLetterStore("")
+	}
+	if conf.AuditInterval > 0 {
+		h.auditor.Schedule(conf.AuditInterval)
+	}
+	healthcheckConfig := &healthConfig{appSystemCode: h.conf.AppSystemCode, appName: h.conf.AppName, port: h.conf.Port, srv: srv, tenants: tenants, notifier: conf.Notifier}
 	h.registerAdminHandlers(router, healthcheckConfig)
 	h.registerAPIHandlers(router)
 	return h
@@ -40,17 +55,26 @@ func (h *Handler) registerAPIHandlers(router *mux.Router) {
 
 	rwHandler := handlers.MethodHandler{
 		"GET":    http.HandlerFunc(h.HandleGet),
+		"HEAD":   http.HandlerFunc(h.HandleGet),
 		"PUT":    http.HandlerFunc(h.HandlePut),
 		"DELETE": http.HandlerFunc(h.HandleDelete),
 	}
 
 	router.Handle("/concordances/{uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}", rwHandler)
+
+	if len(h.tenants) > 0 {
+		names := tenantNames(h.tenants)
+		for i, name := range names {
+			names[i] = regexp.QuoteMeta(name)
+		}
+		router.Handle("/{tenant:"+strings.Join(names, "|")+"}/concordances/{uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}", rwHandler)
+	}
 }
 
 func (h *Handler) registerAdminHandlers(router *mux.Router, config *healthConfig) {
 	log.Info("Registering admin handlers")
 	healthService := newHealthService(config)
-	var checks = []fthealth.Check{healthService.dynamoDbCheck(), healthService.snsCheck()}
+	var checks = healthService.checks
 
 	timedHC := fthealth.TimedHealthCheck{
 		HealthCheck: fthealth.HealthCheck{
@@ -65,6 +89,15 @@ func (h *Handler) registerAdminHandlers(router *mux.Router, config *healthConfig
 	router.HandleFunc(healthPath, fthealth.Handler(&timedHC))
 	router.HandleFunc(status.GTGPath, status.NewGoodToGoHandler(healthService.gtg))
 	router.HandleFunc(status.BuildInfoPath, status.BuildInfoHandler)
+	router.HandleFunc(apiPath, h.HandleAPI).Methods("GET")
+	router.HandleFunc(statsPath, h.HandleStats).Methods("GET")
+	router.HandleFunc(auditPath, h.HandleAudit).Methods("GET")
+	router.HandleFunc(republishPath, h.HandleRepublish).Methods("POST")
+	router.HandleFunc(republishPath+"/{id}", h.HandleRepublishStatus).Methods("GET")
+	router.HandleFunc(republishPath+"/{id}", h.HandleRepublishCancel).Methods("DELETE")
+	router.HandleFunc(deadLettersPath, h.HandleDeadLetters).Methods("GET")
+	router.HandleFunc(deadLettersPath+"/retry", h.HandleDeadLettersRetry).Methods("POST")
+	router.HandleFunc(deadLettersPath+"/{id}/retry", h.HandleDeadLetterRetry).Methods("POST")
 
 	monitoringRouter := httphandlers.TransactionAwareRequestLoggingHandler(log.StandardLogger(), router)
 	monitoringRouter = httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, monitoringRouter)
@@ -75,24 +108,68 @@ func (h *Handler) HandleGet(rw http.ResponseWriter, r *http.Request) {
 	uuid := vars[UUID_Param]
 	tid := transactionidutils.GetTransactionIDFromRequest(r)
 
-	model, err := h.srv.Read(uuid, tid)
+	tenant, srv, err := h.resolveService(r)
+	//400
+	if err != nil {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error(err.Error())
+		writeProblem(rw, problemOf(err, tid, uuid))
+		return
+	}
+	defer tenantTimer(tenant, r.Method).UpdateSince(time.Now())
+
+	model, err := srv.Read(uuid, tid)
 
-	//503
+	//400, 500, 503, 504
 	if err != nil {
-		writeJSONError(rw, "Error retrieving concordances", http.StatusServiceUnavailable)
+		tenantErrors(tenant, r.Method).Inc(1)
+		writeProblem(rw, storeProblem(err, "Error retrieving concordances", tid, uuid))
 		return
 	}
 	//404
 	if model.ConcordedIds == nil {
 		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Info("Unable to find concordance")
-		writeJSONError(rw, "Unable to find concordance", http.StatusNotFound)
+		writeProblem(rw, Problem{Status: http.StatusNotFound, Code: CodeConcordanceNotFound, Detail: "Unable to find concordance", TransactionID: tid, UUID: uuid})
+		return
+	}
+
+	if authority := r.URL.Query().Get(Authority_Param); authority != "" {
+		model = filterByAuthority(model, authority)
+		//404
+		if len(model.Identifiers) == 0 {
+			log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid, "authority": authority}).Info("Unable to find concordance for authority")
+			writeProblem(rw, Problem{Status: http.StatusNotFound, Code: CodeAuthorityNotFound, Detail: "Unable to find concordance for authority", TransactionID: tid, UUID: uuid})
+			return
+		}
+	}
+
+	contentType := negotiateContentType(r.Header.Get("Accept"))
+	body, err := renderConcordance(model, contentType)
+	//500
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": tid, "content_type": contentType}).Error("Error rendering concordance")
+		writeProblem(rw, Problem{Status: http.StatusInternalServerError, Code: CodeRenderingFailed, Detail: "Error rendering concordance", TransactionID: tid, UUID: uuid})
+		return
+	}
+	tag := etag(body)
+	rw.Header().Set("ETag", tag)
+	rw.Header().Set("Vary", "Accept")
+	if model.LastModified != nil {
+		rw.Header().Set("Last-Modified", model.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	//304
+	if notModified(r, tag, model.LastModified) {
+		rw.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	//200
-	rw.Header().Set("Content-Type", ContentTypeJson)
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
 	rw.WriteHeader(http.StatusOK)
-	json.NewEncoder(rw).Encode(&model)
+	if r.Method != http.MethodHead {
+		rw.Write(body)
+	}
 }
 
 func (h *Handler) HandlePut(rw http.ResponseWriter, r *http.Request) {
@@ -100,42 +177,65 @@ func (h *Handler) HandlePut(rw http.ResponseWriter, r *http.Request) {
 	tid := transactionidutils.GetTransactionIDFromRequest(r)
 	uuid := vars[UUID_Param]
 
+	tenant, srv, err := h.resolveService(r)
+	//400
+	if err != nil {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error(err.Error())
+		writeProblem(rw, problemOf(err, tid, uuid))
+		return
+	}
+	defer tenantTimer(tenant, r.Method).UpdateSince(time.Now())
+
+	suppress, err := h.suppressNotification(r)
+	//400, 403
+	if err != nil {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error(err.Error())
+		writeProblem(rw, problemOf(err, tid, uuid))
+		return
+	}
+
 	model := db.ConcordancesModel{}
-	err := json.NewDecoder(r.Body).Decode(&model)
+	err = json.NewDecoder(r.Body).Decode(&model)
 	defer r.Body.Close()
 
 	//400
 	if err != nil {
 		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error("Error decoding the JSON of the request body")
-		writeJSONError(rw, "Error decoding the JSON of the request body", http.StatusBadRequest)
+		writeProblem(rw, Problem{Status: http.StatusBadRequest, Code: CodeMalformedBody, Detail: "Error decoding the JSON of the request body", TransactionID: tid, UUID: uuid, Violations: decodingViolations(err)})
 		return
 	}
 
+	msg, violations := validatePut(uuid, model, h.conf.MaxConcordedIds)
 	//400
-	if model.UUID == "" {
-		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error("Concept UUID in payload is different from UUID path parameter")
-		writeJSONError(rw,"Concept UUID is missing from the Payload", http.StatusBadRequest)
+	if msg != "" {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid, "violations": len(violations)}).Error(msg)
+		writeProblem(rw, Problem{Status: http.StatusBadRequest, Code: CodeInvalidConcordance, Detail: msg, TransactionID: tid, UUID: uuid, Violations: violations})
 		return
 	}
-	if model.UUID != uuid {
-		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error("Concept UUID in payload is different from UUID path parameter")
-		writeJSONError(rw, fmt.Sprintf("Concept UUID (%s) in payload is different from UUID path parameter (%s)", model.UUID, uuid), http.StatusBadRequest)
-		return
+	model = normaliseConcordance(model)
+
+	var status db.Status
+	if suppress {
+		status, err = writeSuppressed(srv, model, tid)
+	} else {
+		status, err = srv.Write(model, tid)
 	}
 
-	if (model.ConcordedIds == nil) || (len(model.ConcordedIds) < 1) {
-		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error("Payload has no concorded UUIDs to store")
-		writeJSONError(rw, "Payload has no concorded UUIDs to store", http.StatusBadRequest)
+	//400
+	if err == errSuppressionUnsupported {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error(err.Error())
+		writeProblem(rw, problemOf(err, tid, uuid))
 		return
 	}
-
-	status, err := h.srv.Write(model, tid)
-
-	//503
+	//400, 500, 503, 504
 	if err != nil || status == db.CONCORDANCE_ERROR {
-		writeJSONError(rw, "Error writing concordance", http.StatusServiceUnavailable)
+		tenantErrors(tenant, r.Method).Inc(1)
+		writeProblem(rw, storeProblem(err, "Error writing concordance", tid, uuid))
 		return
 	}
+	if suppress {
+		tenantSuppressed(tenant, r.Method).Inc(1)
+	}
 
 	if status == db.CONCORDANCE_CREATED {
 		rw.WriteHeader(http.StatusCreated)
@@ -150,25 +250,60 @@ func (h *Handler) HandleDelete(rw http.ResponseWriter, r *http.Request) {
 	uuid := vars[UUID_Param]
 	tid := transactionidutils.GetTransactionIDFromRequest(r)
 
-	status, err := h.srv.Delete(uuid, tid)
+	tenant, srv, err := h.resolveService(r)
+	//400
+	if err != nil {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error(err.Error())
+		writeProblem(rw, problemOf(err, tid, uuid))
+		return
+	}
+	defer tenantTimer(tenant, r.Method).UpdateSince(time.Now())
+
+	suppress, err := h.suppressNotification(r)
+	//400, 403
+	if err != nil {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error(err.Error())
+		writeProblem(rw, problemOf(err, tid, uuid))
+		return
+	}
+
+	var status db.Status
+	if suppress {
+		status, err = deleteSuppressed(srv, uuid, tid)
+	} else {
+		status, err = srv.Delete(uuid, tid)
+	}
 
-	//503
+	//400
+	if err == errSuppressionUnsupported {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Error(err.Error())
+		writeProblem(rw, problemOf(err, tid, uuid))
+		return
+	}
+
+	//400, 500, 503, 504
 	if err != nil || status == db.CONCORDANCE_ERROR {
-		writeJSONError(rw, "Error deleting concordance", http.StatusServiceUnavailable)
+		tenantErrors(tenant, r.Method).Inc(1)
+		writeProblem(rw, storeProblem(err, "Error deleting concordance", tid, uuid))
 		return
 	}
+	if suppress && status == db.CONCORDANCE_DELETED {
+		tenantSuppressed(tenant, r.Method).Inc(1)
+	}
 	//404
 	if status == db.CONCORDANCE_NOT_FOUND {
 		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid}).Info("Unable to find concordance")
-		writeJSONError(rw, "Unable to find concordance", http.StatusNotFound)
+		writeProblem(rw, Problem{Status: http.StatusNotFound, Code: CodeConcordanceNotFound, Detail: "Unable to find concordance", TransactionID: tid, UUID: uuid})
 		return
 	}
 	//204
 	rw.WriteHeader(http.StatusNoContent)
 }
 
-func writeJSONError(rw http.ResponseWriter, logMsg string, statusCode int) {
-	rw.Header().Set("Content-Type", ContentTypeJson)
-	rw.WriteHeader(statusCode)
-	rw.Write([]byte(fmt.Sprintf("{\"message\":\"%s\"}", logMsg)))
+// decodingViolations points at the field of the body which does not have the type of the field of a concordance, if any.
+func decodingViolations(err error) []Violation {
+	if e, ok := err.(*json.UnmarshalTypeError); ok && e.Field != "" {
+		return []Violation{{Field: e.Field, Message: fmt.Sprintf("is not a %s", e.Type)}}
+	}
+	return nil
 }
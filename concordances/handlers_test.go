@@ -17,7 +17,9 @@ import (
 const (
 	TestConceptUuid = "4f50b156-6c50-4693-b835-02f70d3f3bc0"
 	Path            = "/concordances/4f50b156-6c50-4693-b835-02f70d3f3bc0"
-	GoodBody        = "{\"uuid\":\"4f50b156-6c50-4693-b835-02f70d3f3bc0\",\"concordedIds\":[\"1\",\"2\"]}\n"
+	ConcordedUuid1  = "7c4b3931-361f-4ea4-b694-75d1630d7746"
+	ConcordedUuid2  = "1e5c86f8-3f38-4b6b-97ce-f75489ac3113"
+	GoodBody        = "{\"uuid\":\"4f50b156-6c50-4693-b835-02f70d3f3bc0\",\"concordedIds\":[\"7c4b3931-361f-4ea4-b694-75d1630d7746\",\"1e5c86f8-3f38-4b6b-97ce-f75489ac3113\"]}\n"
 )
 
 var router *mux.Router
@@ -52,44 +54,52 @@ func TestHandler_ResponseCodesAndMessages(t *testing.T) {
 		expectedResponseBody string
 		service              Service
 		errorString              string
+		errorCode            string
 	}{
 		{
 			description:          "GET 503 Service Not Available",
 			request:              newRequest("GET", Path, ""),
 			service:              &MockService{err: errors.New("")},
 			expectedResponseCode: 503,
-			expectedContentType:  ContentTypeJson,
+			expectedContentType:  ContentTypeProblemJson,
 			errorString:          "Error retrieving concordances",
+			errorCode:            CodeStoreUnavailable,
 		},
 		{
 			description:          "PUT 503 Service Not Available",
 			request:              newRequest("PUT", Path, GoodBody),
 			service:              &MockService{err: errors.New("")},
 			expectedResponseCode: 503,
-			expectedContentType:  ContentTypeJson,
+			expectedContentType:  ContentTypeProblemJson,
 			errorString:          "Error writing concordance",
+			errorCode:            CodeStoreUnavailable,
 		},
 		{
 			description:          "DELETE 503 Service Not Available",
 			request:              newRequest("DELETE", Path, GoodBody),
 			service:              &MockService{err: errors.New("")},
 			expectedResponseCode: 503,
-			expectedContentType:  ContentTypeJson,
+			expectedContentType:  ContentTypeProblemJson,
 			errorString:          "Error deleting concordance",
+			errorCode:            CodeStoreUnavailable,
 		},
 		{
 			description:          "GET 404 Not Found",
 			request:              newRequest("GET", Path, ""),
 			service:              &MockService{model: db.ConcordancesModel{}, status:db.CONCORDANCE_NOT_FOUND},
 			expectedResponseCode: 404,
-			expectedContentType:  ContentTypeJson,
+			expectedContentType:  ContentTypeProblemJson,
+			errorString:          "Unable to find concordance",
+			errorCode:            CodeConcordanceNotFound,
 		},
 		{
 			description:          "DELETE 404 Not Found",
 			request:              newRequest("DELETE", Path, ""),
 			service:              &MockService{status: db.CONCORDANCE_NOT_FOUND},
 			expectedResponseCode: 404,
-			expectedContentType:  ContentTypeJson,
+			expectedContentType:  ContentTypeProblemJson,
+			errorString:          "Unable to find concordance",
+			errorCode:            CodeConcordanceNotFound,
 		},
 		{
 			description:          "DELETE 204 Deleted",
@@ -112,7 +122,7 @@ func TestHandler_ResponseCodesAndMessages(t *testing.T) {
 		{
 			description:          "GET 200 OK",
 			request:              newRequest("GET", Path, ""),
-			service:              &MockService{model: db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{"1", "2"}}},
+			service:              &MockService{model: db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2}}},
 			expectedResponseCode: 200,
 			expectedResponseBody: GoodBody,
 		},
@@ -127,9 +137,11 @@ func TestHandler_ResponseCodesAndMessages(t *testing.T) {
 
 				assert.Equal(t, testCase.expectedResponseCode, rec.Result().StatusCode, "Response code incorrect.")
 				if testCase.errorString != "" {
-					assert.Contains(t, fmt.Sprintf("\"{\"message\":\"%s\"}", testCase.errorString), rec.Body.String(), "Response body incorrect.")
-				} else if testCase.expectedResponseCode == 404 {
-					assert.Contains(t, "{\"message\":\"Unable to find concordance\"}", rec.Body.String(), "Response body incorrect.")
+					problem := decodeProblem(t, rec)
+					assert.Equal(t, testCase.expectedResponseCode, problem.Status, "Response body incorrect.")
+					assert.Equal(t, testCase.errorCode, problem.Code, "Response body incorrect.")
+					assert.Equal(t, testCase.errorString, problem.Detail, "Response body incorrect.")
+					assert.Equal(t, TestConceptUuid, problem.UUID, "Response body incorrect.")
 				} else {
 					assert.Equal(t, testCase.expectedResponseBody, rec.Body.String(), "Response body incorrect.")
 				}
@@ -165,20 +177,39 @@ func TestHandler_BadBody(t *testing.T) {
 	invalidPayloads := []struct {
 		desc           string
 		request        *http.Request
-		path           string
-		expectedErrMsg string
+		path            string
+		expectedProblem Problem
 	}{
 		{desc: "UUID in payload is different from UUID path parameter",
 			request:        newRequest("PUT", "/concordances/7c4b3931-361f-4ea4-b694-75d1630d7746", "{\"uuid\": \"4f50b156-6c50-4693-b835-02f70d3f3bc0\", \"concordedIds\": [\"1\"]}"),
-			expectedErrMsg: "{\"message\":\"Concept UUID (4f50b156-6c50-4693-b835-02f70d3f3bc0) in payload is different from UUID path parameter (7c4b3931-361f-4ea4-b694-75d1630d7746)\"}"},
-		{desc: "ConceptId not found in payload", request: newRequest("PUT", Path, "{\"concordedIds\": [\"1\"]}"),
-			expectedErrMsg: "{\"message\":\"Concept UUID is missing from the Payload\"}"},
+			expectedProblem: Problem{Code: CodeInvalidConcordance, Detail: "Payload is not a valid concordance", UUID: ConcordedUuid1, Violations: []Violation{
+				{Field: "uuid", Value: TestConceptUuid, Message: "is different from the UUID path parameter"},
+				{Field: "concordedIds[0]", Value: "1", Message: "is not a valid UUID"}}}},
+		{desc: "UUID in payload is different from UUID path parameter only", request: newRequest("PUT", "/concordances/7c4b3931-361f-4ea4-b694-75d1630d7746", "{\"uuid\": \"4f50b156-6c50-4693-b835-02f70d3f3bc0\", \"concordedIds\": [\"7c4b3931-361f-4ea4-b694-75d1630d7746\"]}"),
+			expectedProblem: Problem{Code: CodeInvalidConcordance, Detail: "Concept UUID (4f50b156-6c50-4693-b835-02f70d3f3bc0) in payload is different from UUID path parameter (7c4b3931-361f-4ea4-b694-75d1630d7746)", UUID: ConcordedUuid1,
+				Violations: []Violation{{Field: "uuid", Value: TestConceptUuid, Message: "is different from the UUID path parameter"}}}},
+		{desc: "ConceptId not found in payload", request: newRequest("PUT", Path, "{\"concordedIds\": [\"7c4b3931-361f-4ea4-b694-75d1630d7746\"]}"),
+			expectedProblem: Problem{Code: CodeInvalidConcordance, Detail: "Concept UUID is missing from the Payload", UUID: TestConceptUuid,
+				Violations: []Violation{{Field: "uuid", Message: "is missing"}}}},
+		{desc: "ConceptId and concordedIds not found in payload", request: newRequest("PUT", Path, "{}"),
+			expectedProblem: Problem{Code: CodeInvalidConcordance, Detail: "Payload is not a valid concordance", UUID: TestConceptUuid, Violations: []Violation{
+				{Field: "uuid", Message: "is missing"},
+				{Field: "concordedIds", Message: "is empty, and there are no identifiers"}}}},
 		{desc: "concordedIds is an empty array", request: newRequest("PUT", Path, "{\"uuid\": \"4f50b156-6c50-4693-b835-02f70d3f3bc0\"}"),
-			expectedErrMsg: "{\"message\":\"Payload has no concorded UUIDs to store\"}"},
+			expectedProblem: Problem{Code: CodeInvalidConcordance, Detail: "Payload has no concorded UUIDs to store", UUID: TestConceptUuid,
+				Violations: []Violation{{Field: "concordedIds", Message: "is empty, and there are no identifiers"}}}},
 		{desc: "concordedIds is null", request: newRequest("PUT", Path, "{\"uuid\": \"4f50b156-6c50-4693-b835-02f70d3f3bc0\", \"concordedIds\": null}"),
-			expectedErrMsg: "{\"message\":\"Payload has no concorded UUIDs to store\"}"},
+			expectedProblem: Problem{Code: CodeInvalidConcordance, Detail: "Payload has no concorded UUIDs to store", UUID: TestConceptUuid,
+				Violations: []Violation{{Field: "concordedIds", Message: "is empty, and there are no identifiers"}}}},
 		{desc: "Invalid JSON", request: newRequest("PUT", Path, "{\"uuid\": \"4f50b156-6c50-4693-b835-02f70d3f3bc0\", \"}"),
-			expectedErrMsg: "{\"message\":\"Error decoding the JSON of the request body\"}"},
+			expectedProblem: Problem{Code: CodeMalformedBody, Detail: "Error decoding the JSON of the request body", UUID: TestConceptUuid}},
+		{desc: "concordedIds is not an array", request: newRequest("PUT", Path, "{\"uuid\": \"4f50b156-6c50-4693-b835-02f70d3f3bc0\", \"concordedIds\": \"7c4b3931-361f-4ea4-b694-75d1630d7746\"}"),
+			expectedProblem: Problem{Code: CodeMalformedBody, Detail: "Error decoding the JSON of the request body", UUID: TestConceptUuid,
+				Violations: []Violation{{Field: "concordedIds", Message: "is not a []string"}}}},
+		{desc: "concordedIds are not valid UUIDs", request: newRequest("PUT", Path, "{\"uuid\": \"4f50b156-6c50-4693-b835-02f70d3f3bc0\", \"concordedIds\": [\"1\", \"4f50b156-6c50-4693-b835-02f70d3f3bc0\", \"7c4b3931-361f-4ea4-b694-75d1630d7746\"]}"),
+			expectedProblem: Problem{Code: CodeInvalidConcordance, Detail: "Payload is not a valid concordance", UUID: TestConceptUuid, Violations: []Violation{
+				{Field: "concordedIds[0]", Value: "1", Message: "is not a valid UUID"},
+				{Field: "concordedIds[1]", Value: "4f50b156-6c50-4693-b835-02f70d3f3bc0", Message: "is the concept UUID, a concept cannot be concorded to itself"}}}},
 	}
 
 	for _, c := range invalidPayloads {
@@ -187,8 +218,14 @@ func TestHandler_BadBody(t *testing.T) {
 				rec := httptest.NewRecorder()
 				router.ServeHTTP(rec, c.request)
 				assert.Equal(t, 400, rec.Result().StatusCode, "Response code incorrect.")
-				assert.Equal(t, ContentTypeJson, rec.HeaderMap["Content-Type"][0], "Incorrect Content-Type Header")
-				assert.Equal(t, c.expectedErrMsg, rec.Body.String(), "Response body incorrect.")
+				problem := decodeProblem(t, rec)
+				assert.NotEmpty(t, problem.TransactionID, "Problem should have the transaction id of the request")
+				expected := c.expectedProblem
+				expected.Type = "about:blank"
+				expected.Title = "Bad Request"
+				expected.Status = 400
+				expected.TransactionID = problem.TransactionID
+				assert.Equal(t, expected, problem, "Response body incorrect.")
 			})
 	}
 }
@@ -200,7 +237,7 @@ func TestHandler_AdminEndpoints(t *testing.T) {
 		healthPath:           "",
 	}
 	router := mux.NewRouter()
-	NewHandler(router, AppConfig{}, &MockService{})
+	NewHandler(router, AppConfig{}, &MockService{}, nil)
 
 	for url, expectedBody := range adminHandlers {
 		t.Run(url,
@@ -214,3 +251,54 @@ func TestHandler_AdminEndpoints(t *testing.T) {
 			})
 	}
 }
+
+func TestHandler_PutNormalisesConcordance(t *testing.T) {
+	srv := &MockService{}
+	h.srv = srv
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("PUT", Path, "{\"uuid\": \" 4F50B156-6C50-4693-B835-02F70D3F3BC0\", \"concordedIds\": [\"7c4b3931-361f-4ea4-b694-75d1630d7746 \", \"7C4B3931-361F-4EA4-B694-75D1630D7746\", \"1e5c86f8-3f38-4b6b-97ce-f75489ac3113\"]}"))
+
+	assert.Equal(t, 201, rec.Result().StatusCode, "Response code incorrect.")
+	assert.Equal(t, db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2}}, srv.written, "Concordance was not normalised before being stored")
+}
+
+func TestHandler_GetFiltersByAuthority(t *testing.T) {
+	h.srv = &MockService{model: identifiersModel}
+	testCases := []struct {
+		description          string
+		authority            string
+		expectedResponseCode int
+		expectedResponseBody string
+	}{
+		{"Matching authority", "FACTSET", 200, "{\"uuid\":\"4f50b156-6c50-4693-b835-02f70d3f3bc0\",\"concordedIds\":[\"1e5c86f8-3f38-4b6b-97ce-f75489ac3113\"]," +
+			"\"identifiers\":[{\"authority\":\"FACTSET\",\"identifierValue\":\"000D63-E\",\"uuid\":\"1e5c86f8-3f38-4b6b-97ce-f75489ac3113\"}]}\n"},
+		{"Unknown authority", "Wikidata", 404, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, newRequest("GET", Path+"?authority="+testCase.authority, ""))
+
+			assert.Equal(t, testCase.expectedResponseCode, rec.Result().StatusCode, "Response code incorrect.")
+			if testCase.expectedResponseBody == "" {
+				assert.Equal(t, CodeAuthorityNotFound, decodeProblem(t, rec).Code, "Response body incorrect.")
+			} else {
+				assert.Equal(t, testCase.expectedResponseBody, rec.Body.String(), "Response body incorrect.")
+			}
+		})
+	}
+}
+
+func TestHandler_PutIdentifiers(t *testing.T) {
+	srv := &MockService{}
+	h.srv = srv
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("PUT", Path, "{\"uuid\": \"4f50b156-6c50-4693-b835-02f70d3f3bc0\", \"identifiers\": ["+
+		"{\"authority\": \"TME\", \"identifierValue\": \"MTE3-U3ViamVjdHM=\", \"uuid\": \"7c4b3931-361f-4ea4-b694-75d1630d7746\"}, "+
+		"{\"authority\": \"FACTSET\", \"identifierValue\": \"000D63-E\", \"uuid\": \"1e5c86f8-3f38-4b6b-97ce-f75489ac3113\"}, "+
+		"{\"authority\": \"TME\", \"identifierValue\": \"NDc3-U3ViamVjdHM=\", \"uuid\": \"1e5c86f8-3f38-4b6b-97ce-f75489ac3113\"}]}"))
+
+	assert.Equal(t, 201, rec.Result().StatusCode, "Response code incorrect.")
+	assert.Equal(t, identifiersModel, srv.written, "Concorded UUIDs were not derived from the identifiers")
+}
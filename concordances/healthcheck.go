@@ -1,6 +1,9 @@
 package concordances
 
 import (
+	"fmt"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/service-status-go/gtg"
 )
@@ -17,13 +20,36 @@ type healthConfig struct {
 	appName       string
 	port          string
 	srv           Service
+	tenants       map[string]Service
+	notifier      string
 }
 
 func newHealthService(config *healthConfig) *healthService {
 
 	service := &healthService{config: config}
 	service.checks = []fthealth.Check{
-		service.dynamoDbCheck(), service.snsCheck(),
+		service.dynamoDbCheck(), service.notifierCheck(),
+	}
+	if reporter, ok := config.srv.getNotifier().(deliveryReporter); ok && config.notifier == NotifierWebhook {
+		service.checks = append(service.checks, webhookDeliveryCheck(DefaultTenant, reporter))
+	}
+	if replicator, ok := config.srv.getDBClient().(db.Replicator); ok {
+		service.checks = append(service.checks, secondaryDynamoDbCheck(DefaultTenant, replicator))
+	}
+	if m, ok := config.srv.(mirrored); ok && m.getMirror() != nil {
+		service.checks = append(service.checks, mirrorCheck(DefaultTenant, m.getMirror()))
+	}
+	for _, name := range tenantNames(config.tenants) {
+		service.checks = append(service.checks, service.tenantDynamoDbCheck(name), service.tenantNotifierCheck(name))
+		if reporter, ok := config.tenants[name].getNotifier().(deliveryReporter); ok && config.notifier == NotifierWebhook {
+			service.checks = append(service.checks, webhookDeliveryCheck(name, reporter))
+		}
+		if replicator, ok := config.tenants[name].getDBClient().(db.Replicator); ok {
+			service.checks = append(service.checks, secondaryDynamoDbCheck(name, replicator))
+		}
+		if m, ok := config.tenants[name].(mirrored); ok && m.getMirror() != nil {
+			service.checks = append(service.checks, mirrorCheck(name, m.getMirror()))
+		}
 	}
 	return service
 }
@@ -34,13 +60,23 @@ func (service *healthService) gtg() gtg.Status {
 	}
 
 	snsQueueCheck := func() gtg.Status {
-		return gtgCheck(service.snsChecker)
+		return gtgCheck(func() (string, error) { return service.notifierChecker(service.config.srv) })
 	}
 
-	return gtg.FailFastParallelCheck([]gtg.StatusChecker{
+	checkers := []gtg.StatusChecker{
 		dynamoDbCheck,
 		snsQueueCheck,
-	})()
+	}
+	for _, name := range tenantNames(service.config.tenants) {
+		srv := service.config.tenants[name]
+		checkers = append(checkers, func() gtg.Status {
+			return gtgCheck(func() (string, error) { return dynamoDbChecker(srv) })
+		}, func() gtg.Status {
+			return gtgCheck(func() (string, error) { return service.notifierChecker(srv) })
+		})
+	}
+
+	return gtg.FailFastParallelCheck(checkers)()
 }
 
 func gtgCheck(handler func() (string, error)) gtg.Status {
@@ -51,7 +87,11 @@ func gtgCheck(handler func() (string, error)) gtg.Status {
 }
 
 func (service *healthService) dynamoDbChecker() (string, error) {
-	dbClient := service.config.srv.getDBClient()
+	return dynamoDbChecker(service.config.srv)
+}
+
+func dynamoDbChecker(srv Service) (string, error) {
+	dbClient := srv.getDBClient()
 	err := dbClient.Healthcheck()
 	if err != nil {
 		return "Cannot connect to DynamoDB Table", err
@@ -78,7 +118,11 @@ func (service *healthService) dynamoDbCheck() fthealth.Check {
 }
 
 func (service *healthService) snsChecker() (string, error) {
-	snsClient := service.config.srv.getSNSClient()
+	return snsChecker(service.config.srv)
+}
+
+func snsChecker(srv Service) (string, error) {
+	snsClient := srv.getNotifier()
 	_,err := snsClient.Healthcheck()
 
 	if err != nil {
@@ -87,6 +131,77 @@ func (service *healthService) snsChecker() (string, error) {
 	return "SNS Client is healthy", nil
 }
 
+func webhookChecker(srv Service) (string, error) {
+	_, err := srv.getNotifier().Healthcheck()
+	if err != nil {
+		return "Cannot reach the webhook", err
+	}
+	return "Webhook Client is healthy", nil
+}
+
+// deliveryReporter is implemented by notifiers that remember the outcome of their last delivery.
+type deliveryReporter interface {
+	LastDeliveryError() error
+}
+
+func webhookDeliveryChecker(reporter deliveryReporter) (string, error) {
+	if err := reporter.LastDeliveryError(); err != nil {
+		return "Last notification to the webhook failed", err
+	}
+	return "Last notification was delivered to the webhook", nil
+}
+
+func (service *healthService) notifierChecker(srv Service) (string, error) {
+	if service.config.notifier == NotifierWebhook {
+		return webhookChecker(srv)
+	}
+	return snsChecker(srv)
+}
+
+func (service *healthService) notifierCheck() fthealth.Check {
+	if service.config.notifier == NotifierWebhook {
+		return webhookCheck("Webhook healthcheck", service.config.srv)
+	}
+	return service.snsCheck()
+}
+
+func (service *healthService) tenantNotifierCheck(name string) fthealth.Check {
+	if service.config.notifier == NotifierWebhook {
+		return webhookCheck(fmt.Sprintf("Webhook healthcheck (%s)", name), service.config.tenants[name])
+	}
+	return service.tenantSnsCheck(name)
+}
+
+func webhookCheck(name string, srv Service) fthealth.Check {
+	return fthealth.Check{
+		BusinessImpact: `Webhook healthcheck failure will cause service not to be able to notify downstream services of created, updated or deleted concordances records.`,
+		Name:           name,
+		PanicGuide:     "https://dewey.ft.com/concordances-rw-dynamodb.html",
+		Severity:       1,
+		TechnicalSummary: "Webhook healthcheck checks if the webhook concordances notifications are posted to can be reached." +
+			" The failure of this healthcheck may be due to" +
+			" 1) incorrect webhook URL;" +
+			" 2) the webhook being unavailable or too slow to respond;",
+		Checker: func() (string, error) { return webhookChecker(srv) },
+	}
+}
+
+func webhookDeliveryCheck(tenant string, reporter deliveryReporter) fthealth.Check {
+	return fthealth.Check{
+		BusinessImpact: `Webhook delivery healthcheck failure means downstream services have not been notified of some created, updated or deleted concordances records.
+		Undelivered notifications are kept as dead letters, or in the outbox.`,
+		Name:       fmt.Sprintf("Webhook delivery healthcheck (%s)", tenant),
+		PanicGuide: "https://dewey.ft.com/concordances-rw-dynamodb.html",
+		Severity:   2,
+		TechnicalSummary: "Webhook delivery healthcheck reports whether the last concordances notification was delivered to the webhook." +
+			" The failure of this healthcheck may be due to" +
+			" 1) incorrect or expired webhook headers;" +
+			" 2) the webhook rejecting the notification;" +
+			" 3) the webhook being unavailable or too slow to respond;",
+		Checker: func() (string, error) { return webhookDeliveryChecker(reporter) },
+	}
+}
+
 func (service *healthService) snsCheck() fthealth.Check {
 	return fthealth.Check{
 		BusinessImpact: `SNS healthcheck failure will cause service not to be able to notify downstream services of created, updated or deleted concordances records.`,
@@ -98,7 +213,92 @@ func (service *healthService) snsCheck() fthealth.Check {
 			" 1) incorrect region of SNS Topic;" +
 			" 2) incorrect AWS security credentials;" +
 			" 3) missing permissions For SNS Topic;" +
-			" 4) Topic does not exist;",
+			" 4) Topic does not exist;" +
+			" 5) a FIFO topic configured with an ARN not ending with .fifo;",
 		Checker: service.snsChecker,
 	}
 }
+
+func (service *healthService) tenantDynamoDbCheck(name string) fthealth.Check {
+	srv := service.config.tenants[name]
+	return fthealth.Check{
+		BusinessImpact: fmt.Sprintf(`DynamoDB healthcheck failure for tenant %s will cause service not to be able to store its concordances
+		and notify downstream services of its created, updated or deleted concordances records.`, name),
+		Name:       fmt.Sprintf("DynamoDB healthcheck (%s)", name),
+		PanicGuide: "https://dewey.ft.com/concordances-rw-dynamodb.html",
+		Severity:   1,
+		TechnicalSummary: fmt.Sprintf("DynamoDB healthcheck checks if the service can connect to DynamoDB, and access the table of tenant %s. ", name) +
+			"The failure of this healthcheck may be due to " +
+			"1) incorrect table name in the tenants configuration; " +
+			"2) incorrect AWS security credentials; " +
+			"3) missing permissions to the DynamoDB table; " +
+			"4) the table may not exist;",
+		Checker: func() (string, error) { return dynamoDbChecker(srv) },
+	}
+}
+
+func (service *healthService) tenantSnsCheck(name string) fthealth.Check {
+	srv := service.config.tenants[name]
+	return fthealth.Check{
+		BusinessImpact: fmt.Sprintf(`SNS healthcheck failure for tenant %s will cause service not to be able to notify downstream services of its created, updated or deleted concordances records.`, name),
+		Name:           fmt.Sprintf("SNS healthcheck (%s)", name),
+		PanicGuide:     "https://dewey.ft.com/concordances-rw-dynamodb.html",
+		Severity:       1,
+		TechnicalSummary: fmt.Sprintf("SNS healthcheck checks if the service can send concordances notifications to the SNS topic of tenant %s.", name) +
+			" The failure of this healthcheck may be due to" +
+			" 1) incorrect SNS Topic in the tenants configuration;" +
+			" 2) incorrect AWS security credentials;" +
+			" 3) missing permissions For SNS Topic;" +
+			" 4) Topic does not exist;" +
+			" 5) a FIFO topic configured with an ARN not ending with .fifo;",
+		Checker: func() (string, error) { return snsChecker(srv) },
+	}
+}
+
+func secondaryDynamoDbChecker(replicator db.Replicator) (string, error) {
+	if err := replicator.SecondaryHealthcheck(); err != nil {
+		return "Cannot replicate to secondary DynamoDB Table", err
+	}
+	return fmt.Sprintf("Secondary DynamoDB table is healthy, %d changes pending replication, %d divergences detected", replicator.Pending(), replicator.Divergences()), nil
+}
+
+func secondaryDynamoDbCheck(tenant string, replicator db.Replicator) fthealth.Check {
+	return fthealth.Check{
+		BusinessImpact: `Secondary DynamoDB healthcheck failure means concordances are not being replicated to the disaster recovery region.
+		Serving and storing concordances is not affected.`,
+		Name:       fmt.Sprintf("Secondary DynamoDB healthcheck (%s)", tenant),
+		PanicGuide: "https://dewey.ft.com/concordances-rw-dynamodb.html",
+		Severity:   2,
+		TechnicalSummary: "Secondary DynamoDB healthcheck checks if the service can access the secondary table and keep up replicating changes to it. " +
+			"The failure of this healthcheck may be due to " +
+			"1) incorrect name or region of the secondary DynamoDB table; " +
+			"2) missing permissions to the secondary DynamoDB table; " +
+			"3) the secondary table may not exist; " +
+			"4) the replication queue is full because the secondary table keeps failing;",
+		Checker: func() (string, error) { return secondaryDynamoDbChecker(replicator) },
+	}
+}
+
+func mirrorChecker(mirror Mirror) (string, error) {
+	if _, err := mirror.Healthcheck(); err != nil {
+		return "Cannot access the S3 mirror bucket", err
+	}
+	return "S3 mirror is healthy", nil
+}
+
+func mirrorCheck(tenant string, mirror Mirror) fthealth.Check {
+	return fthealth.Check{
+		BusinessImpact: `S3 mirror healthcheck failure means stored or deleted concordances are not copied to the mirror,
+		so downstream services may not be able to fetch the concordances they are notified of.`,
+		Name:       fmt.Sprintf("S3 mirror healthcheck (%s)", tenant),
+		PanicGuide: "https://dewey.ft.com/concordances-rw-dynamodb.html",
+		Severity:   1,
+		TechnicalSummary: "S3 mirror healthcheck checks if the service can access the bucket concordances are copied to. " +
+			"The failure of this healthcheck may be due to " +
+			"1) incorrect name, region or endpoint of the bucket; " +
+			"2) incorrect AWS security credentials; " +
+			"3) missing permissions to the bucket; " +
+			"4) the bucket may not exist;",
+		Checker: func() (string, error) { return mirrorChecker(mirror) },
+	}
+}
@@ -2,8 +2,13 @@ package concordances
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/Financial-Times/concordances-rw-dynamodb/webhook"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,3 +54,49 @@ func TestCheck_SnsIsNotHealthy(t *testing.T) {
 	assert.Equal(t, SNS_ERROR, err.Error(), "SNS healthcheck failed to detect unhealthy state")
 
 }
+
+func TestCheck_SecondaryDynamoDB(t *testing.T) {
+	replicating, err := db.NewReplicatingClient(&MockDynamoDBClient{Happy: true}, &MockDynamoDBClient{Happy: true}, db.ReplicationSync)
+	assert.NoError(t, err)
+	srv := createService(replicating, &MockSNSClient{Happy: true})
+	healthService := newHealthService(getConfig(&srv))
+
+	assert.Len(t, healthService.checks, 3, "Expected a healthcheck for the secondary table")
+	output, err := healthService.checks[2].Checker()
+	assert.NoError(t, err, "Secondary DynamoDB healthcheck failed to detect healthy state")
+	assert.Contains(t, output, "0 divergences detected")
+}
+
+func TestCheck_Webhook(t *testing.T) {
+	config := getConfig(&MockService{err: errors.New("")})
+	config.notifier = NotifierWebhook
+	config.tenants = map[string]Service{"factset": &MockService{}}
+	healthService := newHealthService(config)
+
+	assert.Equal(t, "Webhook healthcheck", healthService.checks[1].Name)
+	output, err := healthService.checks[1].Checker()
+	assert.Error(t, err, "Webhook healthcheck failed to detect unhealthy state")
+	assert.Equal(t, "Cannot reach the webhook", output)
+
+	assert.Equal(t, "Webhook healthcheck (factset)", healthService.checks[3].Name)
+	_, err = healthService.checks[3].Checker()
+	assert.NoError(t, err, "Webhook healthcheck failed to detect healthy state")
+}
+
+func TestCheck_WebhookDelivery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	client := webhook.NewWebhookClient(webhook.Config{URL: server.URL})
+	check := webhookDeliveryCheck(DefaultTenant, client)
+
+	_, err := check.Checker()
+	assert.NoError(t, err, "Webhook delivery healthcheck failed to detect healthy state")
+
+	assert.Error(t, client.SendMessage(sns.NewEvent(sns.EventCreated, TestConceptUuid, "tid_1", nil, []string{ConcordedUuid1})))
+	output, err := check.Checker()
+	assert.Error(t, err, "Webhook delivery healthcheck failed to detect unhealthy state")
+	assert.Equal(t, "Last notification to the webhook failed", output)
+	assert.Equal(t, uint8(2), check.Severity, "Failed deliveries should not be critical")
+}
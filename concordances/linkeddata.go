@@ -0,0 +1,112 @@
+package concordances
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+)
+
+const (
+	ContentTypeJsonLD   = "application/ld+json"
+	ContentTypeTurtle   = "text/turtle"
+	ContentTypeNTriples = "application/n-triples"
+
+	thingURIPrefix = "http://www.ft.com/thing/"
+	owlNamespace   = "http://www.w3.org/2002/07/owl#"
+)
+
+// representations are the content types concordances can be rendered as, JSON being the default.
+var representations = []string{ContentTypeJson, ContentTypeJsonLD, ContentTypeTurtle, ContentTypeNTriples}
+
+// negotiateContentType picks the representation of a concordance the Accept header prefers, JSON when it accepts none of them,
+// so that clients asking for anything else keep getting JSON.
+func negotiateContentType(accept string) string {
+	best, bestQuality := ContentTypeJson, 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, found := params["q"]; found {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		for _, representation := range representations {
+			if quality > bestQuality && mediaTypeMatches(mediaType, representation) {
+				best, bestQuality = representation, quality
+			}
+		}
+	}
+	return best
+}
+
+// mediaTypeMatches reports whether a media range of an Accept header, e.g. text/* or */*, covers a content type.
+func mediaTypeMatches(mediaRange string, contentType string) bool {
+	if mediaRange == "*/*" || mediaRange == contentType {
+		return true
+	}
+	return strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(mediaRange, "*"))
+}
+
+// renderConcordance writes a concordance as the given content type. Linked data representations state that the concept
+// is the same thing as each of its concorded concepts, e.g. <http://www.ft.com/thing/{uuid}> owl:sameAs <http://www.ft.com/thing/{concordedId}>
+func renderConcordance(model db.ConcordancesModel, contentType string) ([]byte, error) {
+	var body bytes.Buffer
+	subject := thingURI(model.UUID)
+	objects := sameAs(model)
+
+	switch contentType {
+	case ContentTypeJsonLD:
+		err := json.NewEncoder(&body).Encode(jsonLD{
+			Context: map[string]interface{}{
+				"owl":    owlNamespace,
+				"sameAs": map[string]string{"@id": "owl:sameAs", "@type": "@id"},
+			},
+			ID:     subject,
+			SameAs: objects,
+		})
+		return body.Bytes(), err
+	case ContentTypeTurtle:
+		fmt.Fprintf(&body, "@prefix owl: <%s> .\n", owlNamespace)
+		if len(objects) > 0 {
+			fmt.Fprintf(&body, "\n<%s> owl:sameAs <%s> .\n", subject, strings.Join(objects, ">, <"))
+		}
+		return body.Bytes(), nil
+	case ContentTypeNTriples:
+		for _, object := range objects {
+			fmt.Fprintf(&body, "<%s> <%ssameAs> <%s> .\n", subject, owlNamespace, object)
+		}
+		return body.Bytes(), nil
+	}
+	err := json.NewEncoder(&body).Encode(&model)
+	return body.Bytes(), err
+}
+
+type jsonLD struct {
+	Context map[string]interface{} `json:"@context"`
+	ID      string                 `json:"@id"`
+	SameAs  []string               `json:"sameAs"`
+}
+
+// sameAs returns the URIs of the concepts a concept is concorded with, leaving out the concept itself.
+func sameAs(model db.ConcordancesModel) []string {
+	uris := []string{}
+	for _, id := range model.ConcordedIds {
+		if id != model.UUID {
+			uris = append(uris, thingURI(id))
+		}
+	}
+	return uris
+}
+
+func thingURI(uuid string) string {
+	return thingURIPrefix + url.PathEscape(uuid)
+}
@@ -0,0 +1,100 @@
+package concordances
+
+import (
+	"encoding/json"
+	"testing"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	ThingURI           = "http://www.ft.com/thing/4f50b156-6c50-4693-b835-02f70d3f3bc0"
+	ConcordedThingURI1 = "http://www.ft.com/thing/7c4b3931-361f-4ea4-b694-75d1630d7746"
+	ConcordedThingURI2 = "http://www.ft.com/thing/1e5c86f8-3f38-4b6b-97ce-f75489ac3113"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	testCases := map[string]string{
+		"":                                       ContentTypeJson,
+		"application/json; charset=UTF-8":        ContentTypeJson,
+		"*/*":                                    ContentTypeJson,
+		"application/ld+json":                    ContentTypeJsonLD,
+		"text/turtle":                            ContentTypeTurtle,
+		"application/n-triples":                  ContentTypeNTriples,
+		"text/*":                                 ContentTypeTurtle,
+		"text/html":                              ContentTypeJson,
+		"text/turtle;q=0.5, application/ld+json": ContentTypeJsonLD,
+		"application/json;q=0.1, text/turtle;q=0.9":  ContentTypeTurtle,
+		"application/ld+json;q=0, text/turtle;q=0.1": ContentTypeTurtle,
+		"invalid;;, application/n-triples":           ContentTypeNTriples,
+	}
+
+	for accept, expected := range testCases {
+		t.Run(accept, func(t *testing.T) {
+			assert.Equal(t, expected, negotiateContentType(accept))
+		})
+	}
+}
+
+func TestRenderConcordance_JSONLD(t *testing.T) {
+	body, err := renderConcordance(db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{TestConceptUuid, ConcordedUuid1, ConcordedUuid2}}, ContentTypeJsonLD)
+	assert.NoError(t, err)
+
+	var document map[string]interface{}
+	assert.NoError(t, json.Unmarshal(body, &document))
+	assert.Equal(t, ThingURI, document["@id"])
+	assert.Equal(t, []interface{}{ConcordedThingURI1, ConcordedThingURI2}, document["sameAs"], "Concept should not be the same as itself")
+	context := document["@context"].(map[string]interface{})
+	assert.Equal(t, "http://www.w3.org/2002/07/owl#", context["owl"])
+	assert.Equal(t, map[string]interface{}{"@id": "owl:sameAs", "@type": "@id"}, context["sameAs"])
+}
+
+func TestRenderConcordance_Turtle(t *testing.T) {
+	body, err := renderConcordance(db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2}}, ContentTypeTurtle)
+	assert.NoError(t, err)
+	assert.Equal(t, "@prefix owl: <http://www.w3.org/2002/07/owl#> .\n\n"+
+		"<"+ThingURI+"> owl:sameAs <"+ConcordedThingURI1+">, <"+ConcordedThingURI2+"> .\n", string(body))
+}
+
+func TestRenderConcordance_NTriples(t *testing.T) {
+	body, err := renderConcordance(db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2}}, ContentTypeNTriples)
+	assert.NoError(t, err)
+	assert.Equal(t, "<"+ThingURI+"> <http://www.w3.org/2002/07/owl#sameAs> <"+ConcordedThingURI1+"> .\n"+
+		"<"+ThingURI+"> <http://www.w3.org/2002/07/owl#sameAs> <"+ConcordedThingURI2+"> .\n", string(body))
+}
+
+func TestRenderConcordance_EscapesURIs(t *testing.T) {
+	body, err := renderConcordance(db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{"a> <b"}}, ContentTypeNTriples)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "<http://www.ft.com/thing/a%3E%20%3Cb>")
+}
+
+func TestHandler_GetLinkedData(t *testing.T) {
+	h.srv = &MockService{model: db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2}}}
+
+	plain := getWithHeaders("GET", Path, nil)
+	assert.Equal(t, ContentTypeJson, plain.Header().Get("Content-Type"))
+	assert.Equal(t, GoodBody, plain.Body.String(), "JSON should remain the default")
+	assert.Equal(t, "Accept", plain.Header().Get("Vary"))
+
+	for _, contentType := range []string{ContentTypeJsonLD, ContentTypeTurtle, ContentTypeNTriples} {
+		t.Run(contentType, func(t *testing.T) {
+			rec := getWithHeaders("GET", Path, map[string]string{"Accept": contentType})
+
+			assert.Equal(t, 200, rec.Code)
+			assert.Equal(t, contentType, rec.Header().Get("Content-Type"))
+			assert.Contains(t, rec.Body.String(), ConcordedThingURI2)
+			assert.NotEqual(t, plain.Header().Get("ETag"), rec.Header().Get("ETag"), "Every representation should have its own ETag")
+
+			notModified := getWithHeaders("GET", Path, map[string]string{"Accept": contentType, "If-None-Match": rec.Header().Get("ETag")})
+			assert.Equal(t, 304, notModified.Code)
+		})
+	}
+
+	h.srv = &MockService{model: identifiersModel}
+	filtered := getWithHeaders("GET", Path+"?authority=FACTSET", map[string]string{"Accept": ContentTypeNTriples})
+	assert.Equal(t, 200, filtered.Code)
+	assert.Equal(t, "<"+ThingURI+"> <http://www.w3.org/2002/07/owl#sameAs> <"+ConcordedThingURI2+"> .\n", filtered.Body.String(),
+		"Linked data should only state the concorded concepts of the authority")
+}
@@ -0,0 +1,65 @@
+package concordances
+
+import (
+	"encoding/json"
+	"fmt"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/s3"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+)
+
+// Mirror is an object store concordance documents are copied to.
+type Mirror interface {
+	Put(key string, document []byte) error
+	Delete(key string) error
+	Healthcheck() (bool, error)
+}
+
+// documentMirror copies concordances to a mirror, at the key legacy SNS messages announce them with,
+// so that the key of a notification references a document consumers can fetch.
+type documentMirror struct {
+	store  Mirror
+	layout sns.KeyLayout
+}
+
+func newDocumentMirror(conf AppConfig) *documentMirror {
+	if conf.MirrorBucket == "" {
+		return nil
+	}
+	region := conf.MirrorRegion
+	if region == "" {
+		region = conf.AWSRegion
+	}
+	return &documentMirror{store: s3.NewS3Client(conf.MirrorBucket, region, conf.MirrorEndpoint), layout: conf.SNSKeyLayout}
+}
+
+// write stores the document of a concordance, as returned by GET /concordances/{uuid}.
+func (m *documentMirror) write(model db.ConcordancesModel) error {
+	if m == nil {
+		return nil
+	}
+	document, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	if err := m.store.Put(m.layout.Key(model.UUID), document); err != nil {
+		return fmt.Errorf("unable to mirror concordance: %w", err)
+	}
+	return nil
+}
+
+func (m *documentMirror) delete(uuid string) error {
+	if m == nil {
+		return nil
+	}
+	if err := m.store.Delete(m.layout.Key(uuid)); err != nil {
+		return fmt.Errorf("unable to delete mirrored concordance: %w", err)
+	}
+	return nil
+}
+
+// mirrored is implemented by services that copy their concordances to a mirror.
+type mirrored interface {
+	getMirror() Mirror
+}
@@ -0,0 +1,177 @@
+package concordances
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/internal/testutil"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/stretchr/testify/assert"
+)
+
+const MIRROR_KEY = "uuid_123"
+
+type MockMirror struct {
+	Happy     bool
+	documents map[string][]byte
+}
+
+func NewMockMirror() *MockMirror {
+	return &MockMirror{Happy: true, documents: map[string][]byte{}}
+}
+
+func (m *MockMirror) Put(key string, document []byte) error {
+	if !m.Happy {
+		return errors.New("S3 error")
+	}
+	m.documents[key] = document
+	return nil
+}
+
+func (m *MockMirror) Delete(key string) error {
+	if !m.Happy {
+		return errors.New("S3 error")
+	}
+	delete(m.documents, key)
+	return nil
+}
+
+func (m *MockMirror) Healthcheck() (bool, error) {
+	if !m.Happy {
+		return false, errors.New("S3 error")
+	}
+	return true, nil
+}
+
+func createMirroredService(mirror Mirror, snsClient Notifier) *ConcordancesRwService {
+	srv := createService(&MockDynamoDBClient{Happy: true}, snsClient)
+	srv.mirror = &documentMirror{store: mirror, layout: sns.KeyLayout{}}
+	return &srv
+}
+
+func TestMirror_WriteAndDelete(t *testing.T) {
+	mirror := NewMockMirror()
+	snsClient := &MockSNSClient{Happy: true}
+	srv := createMirroredService(mirror, snsClient)
+	model := db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}
+
+	status, err := srv.Write(model, "tid_1")
+	assert.NoError(t, err)
+	assert.Equal(t, db.CONCORDANCE_CREATED, status)
+	var mirrored db.ConcordancesModel
+	assert.NoError(t, json.Unmarshal(mirror.documents[MIRROR_KEY], &mirrored))
+	assert.Equal(t, model, mirrored, "Concordance should be mirrored as it is read")
+
+	status, err = srv.Delete(EXPECTED_UUID, "tid_2")
+	assert.NoError(t, err)
+	assert.Equal(t, db.CONCORDANCE_DELETED, status)
+	assert.Empty(t, mirror.documents)
+	assert.Len(t, snsClient.events, 2)
+}
+
+func TestMirror_FailureDoesNotFailCommittedChange(t *testing.T) {
+	mirror := NewMockMirror()
+	mirror.Happy = false
+	snsClient := &MockSNSClient{Happy: true}
+	srv := createMirroredService(mirror, snsClient)
+
+	status, err := srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "tid_1")
+	assert.NoError(t, err, "Committed write should not fail because it could not be mirrored")
+	assert.Equal(t, db.CONCORDANCE_CREATED, status)
+
+	status, err = srv.Delete(EXPECTED_UUID, "tid_2")
+	assert.NoError(t, err, "Committed delete should not fail because it could not be mirrored")
+	assert.Equal(t, db.CONCORDANCE_DELETED, status)
+
+	assert.Len(t, snsClient.events, 2, "Committed changes should still be announced")
+	assert.Equal(t, int64(2), srv.Stats().Counters.Errors)
+}
+
+func TestMirror_WrapsErrors(t *testing.T) {
+	mirror := &documentMirror{store: &MockMirror{}, layout: sns.KeyLayout{}}
+
+	assert.EqualError(t, errors.Unwrap(mirror.write(db.ConcordancesModel{UUID: EXPECTED_UUID})), "S3 error")
+	assert.EqualError(t, errors.Unwrap(mirror.delete(EXPECTED_UUID)), "S3 error")
+}
+
+func TestMirror_SuppressedChanges(t *testing.T) {
+	mirror := NewMockMirror()
+	srv := createMirroredService(mirror, &MockSNSClient{Happy: true})
+
+	_, err := srv.WriteSuppressed(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "tid_1")
+	assert.NoError(t, err)
+	assert.Contains(t, mirror.documents, MIRROR_KEY, "Suppressing the notification should not suppress the mirror")
+}
+
+func TestMirror_StreamPublisher(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(testShard, "")
+	streams.Put(testShard, nil, streamConcordance("A"))
+	snsClient := &MockSNSClient{Happy: true}
+	publisher, srv := newTestStreamPublisher(t, streams, snsClient)
+	mirror := NewMockMirror()
+	srv.mirror = &documentMirror{store: mirror}
+	publisher.mirror = srv.mirror
+
+	_, err := srv.Write(db.ConcordancesModel{UUID: "uuid_456", ConcordedIds: []string{"A"}}, "tid_1")
+	assert.NoError(t, err)
+	assert.Empty(t, mirror.documents, "Changes announced from the stream should be mirrored from the stream")
+
+	mirror.Happy = false
+	assert.Error(t, publisher.Poll())
+	assert.Empty(t, snsClient.events)
+
+	mirror.Happy = true
+	assert.NoError(t, publisher.Poll())
+	assert.Contains(t, mirror.documents, MIRROR_KEY)
+	assert.Len(t, snsClient.events, 1)
+
+	streams.Put(testShard, streamConcordance("A"), nil)
+	assert.NoError(t, publisher.Poll())
+	assert.Empty(t, mirror.documents)
+}
+
+func TestMirror_FetchableAtAnnouncedKey(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "key")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	store := testutil.NewFakeObjectStore("concordances")
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	layout := sns.KeyLayout{Prefix: "concordances/", Separator: "-", Suffix: ".json", ShardChars: 2}
+	mirror := newDocumentMirror(AppConfig{AWSRegion: "eu-west-1", MirrorBucket: "concordances", MirrorEndpoint: server.URL, SNSKeyLayout: layout})
+	srv := createService(&MockDynamoDBClient{Happy: true}, &MockSNSClient{Happy: true})
+	srv.mirror = mirror
+
+	uuid := "4f50b156-6c50-4693-b835-02f70d3f3bc0"
+	_, err := srv.Write(db.ConcordancesModel{UUID: uuid, ConcordedIds: []string{"A"}}, "tid_1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"concordances/4f/4f50b156-6c50-4693-b835-02f70d3f3bc0.json"}, store.Keys("concordances"))
+	body, _, found := store.Object("concordances", layout.Key(uuid))
+	assert.True(t, found, "Concordance should be stored at the key legacy messages announce")
+	assert.JSONEq(t, `{"uuid":"4f50b156-6c50-4693-b835-02f70d3f3bc0","concordedIds":["A"]}`, string(body))
+}
+
+func TestCheck_Mirror(t *testing.T) {
+	mirror := NewMockMirror()
+	srv := createMirroredService(mirror, &MockSNSClient{Happy: true})
+	healthService := newHealthService(getConfig(srv))
+
+	assert.Len(t, healthService.checks, 3, "Expected a healthcheck for the mirror")
+	assert.Equal(t, "S3 mirror healthcheck (default)", healthService.checks[2].Name)
+	_, err := healthService.checks[2].Checker()
+	assert.NoError(t, err)
+
+	mirror.Happy = false
+	_, err = healthService.checks[2].Checker()
+	assert.Error(t, err)
+
+	plain := createService(&MockDynamoDBClient{Happy: true}, &MockSNSClient{Happy: true})
+	assert.Len(t, newHealthService(getConfig(&plain)).checks, 2)
+}
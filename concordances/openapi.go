@@ -0,0 +1,144 @@
+package concordances
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/api"
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	apiPath         = "/__api"
+	ContentTypeYAML = "application/yaml"
+)
+
+func init() {
+	// The linked data representations of concordances are checked like the JSON and the text they are.
+	openapi3filter.RegisterBodyDecoder(ContentTypeJsonLD, openapi3filter.RegisteredBodyDecoder(ContentTypeJson))
+	openapi3filter.RegisterBodyDecoder(ContentTypeTurtle, openapi3filter.RegisteredBodyDecoder("text/plain"))
+	openapi3filter.RegisterBodyDecoder(ContentTypeNTriples, openapi3filter.RegisteredBodyDecoder("text/plain"))
+}
+
+// SpecValidator enforces the OpenAPI definition of the service, api/api.yml, on the requests it handles.
+type SpecValidator struct {
+	router routers.Router
+}
+
+// NewSpecValidator validates requests against the given OpenAPI 3 definition, usually api.Spec.
+func NewSpecValidator(spec []byte) (*SpecValidator, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, err
+	}
+	// Requests are matched wherever the service is served, not only behind the public server of the definition.
+	doc.Servers = openapi3.Servers{{URL: "/"}}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &SpecValidator{router: router}, nil
+}
+
+// Middleware rejects the requests whose parameters or body do not match the definition with a 400 listing every violation.
+// Requests to paths the definition does not describe are handled as they are.
+func (v *SpecValidator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		input, found := v.requestInput(r)
+		if !found {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		//400
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			tid := transactionidutils.GetTransactionIDFromRequest(r)
+			uuid := input.PathParams[UUID_Param]
+			violations := specViolations("", err)
+			log.WithFields(log.Fields{"UUID": uuid, "transaction_id": tid, "violations": len(violations)}).Error("Request does not match the API definition")
+			writeProblem(rw, Problem{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: "Request does not match the API definition", TransactionID: tid, UUID: uuid, Violations: violations})
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func (v *SpecValidator) requestInput(r *http.Request) (*openapi3filter.RequestValidationInput, bool) {
+	route, pathParams, err := v.router.FindRoute(r)
+	if err != nil {
+		return nil, false
+	}
+	// Bodies have always been read as JSON, whatever their content type, so clients leaving it out are not rejected.
+	if r.Header.Get("Content-Type") == "" && r.Body != nil && r.Body != http.NoBody {
+		r.Header.Set("Content-Type", ContentTypeJson)
+	}
+	options := &openapi3filter.Options{MultiError: true, SkipSettingDefaults: true}
+	return &openapi3filter.RequestValidationInput{Request: r, PathParams: pathParams, Route: route, Options: options}, true
+}
+
+// specViolations describes the errors found by the validation of a request like the violations found in concordances,
+// referring to parameters by their name and to the fields of the body by their path, e.g. identifiers[0].uuid.
+func specViolations(field string, err error) []Violation {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		violations := []Violation{}
+		for _, err := range e {
+			violations = append(violations, specViolations(field, err)...)
+		}
+		return violations
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			field = e.Parameter.Name
+		}
+		switch e.Err.(type) {
+		case openapi3.MultiError, *openapi3.SchemaError:
+			return specViolations(field, e.Err)
+		}
+		message := e.Reason
+		if message == "" && e.Err != nil {
+			message = e.Err.Error()
+		}
+		return []Violation{{Field: fieldOrBody(field), Message: message}}
+	case *openapi3.SchemaError:
+		violation := Violation{Field: fieldOrBody(jsonPointerField(field, e.JSONPointer())), Message: e.Reason}
+		if value, ok := e.Value.(string); ok {
+			violation.Value = value
+		}
+		return []Violation{violation}
+	}
+	return []Violation{{Field: fieldOrBody(field), Message: err.Error()}}
+}
+
+func jsonPointerField(field string, pointer []string) string {
+	for _, token := range pointer {
+		if _, err := strconv.Atoi(token); err == nil {
+			field += "[" + token + "]"
+		} else {
+			field += "." + token
+		}
+	}
+	return strings.TrimPrefix(field, ".")
+}
+
+func fieldOrBody(field string) string {
+	if field == "" {
+		return "body"
+	}
+	return field
+}
+
+func (h *Handler) HandleAPI(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", ContentTypeYAML)
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(api.Spec)
+}
@@ -0,0 +1,204 @@
+package concordances
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/api"
+	"github.com/Financial-Times/concordances-rw-dynamodb/awserrors"
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	status "github.com/Financial-Times/service-status-go/httphandlers"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkResponses fails the test when a response to a request the definition describes does not match it,
+// including responses with a status code it does not list.
+func checkResponses(t *testing.T, v *SpecValidator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			input, found := v.requestInput(r)
+			rec := httptest.NewRecorder()
+			next.ServeHTTP(rec, r)
+
+			if found {
+				err := openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+					RequestValidationInput: input,
+					Status:                 rec.Code,
+					Header:                 rec.Header(),
+					Body:                   ioutil.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+					Options:                &openapi3filter.Options{IncludeResponseStatus: true, MultiError: true},
+				})
+				assert.NoError(t, err, "%s %s responded %d outside of the API definition", r.Method, r.URL, rec.Code)
+			}
+
+			for name, values := range rec.Header() {
+				rw.Header()[name] = values
+			}
+			rw.WriteHeader(rec.Code)
+			rw.Write(rec.Body.Bytes())
+		})
+	}
+}
+
+func newContractRouter(t *testing.T, conf AppConfig, srv Service, tenants map[string]Service) *mux.Router {
+	validator, err := NewSpecValidator(api.Spec)
+	assert.NoError(t, err, "API definition is not valid")
+	router := mux.NewRouter()
+	NewHandler(router, conf, srv, tenants)
+	router.Use(checkResponses(t, validator), validator.Middleware)
+	return router
+}
+
+func serveContract(router *mux.Router, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSpec_ResponsesMatchDefinition(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).UTC()
+	model := identifiersModel
+	model.ExpiresAt = &expiresAt
+	srv := &MockService{model: model}
+	deadLetters, err := NewDeadLetterStore("")
+	assert.NoError(t, err)
+	deadLetters.Add(DefaultTenant, sns.NewEvent(sns.EventCreated, TestConceptUuid, "tid_1", nil, []string{ConcordedUuid1}), assert.AnError)
+	router := newContractRouter(t, AppConfig{DeadLetters: deadLetters, RepublishRate: 1000}, srv, map[string]Service{"factset": auditService()})
+
+	withHeader := func(req *http.Request, name string, value string) *http.Request {
+		req.Header.Set(name, value)
+		return req
+	}
+	testCases := []struct {
+		description  string
+		request      *http.Request
+		expectedCode int
+	}{
+		{"GET JSON", newRequest("GET", Path, ""), http.StatusOK},
+		{"GET JSON-LD", withHeader(newRequest("GET", Path, ""), "Accept", ContentTypeJsonLD), http.StatusOK},
+		{"GET Turtle", withHeader(newRequest("GET", Path, ""), "Accept", ContentTypeTurtle), http.StatusOK},
+		{"GET N-Triples", withHeader(newRequest("GET", Path, ""), "Accept", ContentTypeNTriples), http.StatusOK},
+		{"GET authority", newRequest("GET", Path+"?authority=FACTSET", ""), http.StatusOK},
+		{"GET unknown authority", newRequest("GET", Path+"?authority=WIKIDATA", ""), http.StatusNotFound},
+		{"GET unknown tenant", withHeader(newRequest("GET", Path, ""), TenantHeader, "unknown"), http.StatusBadRequest},
+		{"HEAD", newRequest("HEAD", Path, ""), http.StatusOK},
+		{"PUT", newRequest("PUT", Path, GoodBody), http.StatusCreated},
+		{"PUT invalid concordance", newRequest("PUT", Path, `{"uuid":"`+TestConceptUuid+`","concordedIds":["not-a-uuid"]}`), http.StatusBadRequest},
+		{"PUT body outside of the definition", newRequest("PUT", Path, `{"uuid":"`+TestConceptUuid+`","concordedIds":"`+ConcordedUuid1+`"}`), http.StatusBadRequest},
+		{"PUT suppressed without key", withHeader(newRequest("PUT", Path, GoodBody), SuppressNotificationHeader, "true"), http.StatusForbidden},
+		{"DELETE", newRequest("DELETE", Path, ""), http.StatusNoContent},
+		{"GET stats", newRequest("GET", statsPath, ""), http.StatusOK},
+		{"GET audit", newRequest("GET", auditPath, ""), http.StatusOK},
+		{"GET dead letters", newRequest("GET", deadLettersPath, ""), http.StatusOK},
+		{"POST dead letters retry", newRequest("POST", deadLettersPath+"/retry?tenant=factset", ""), http.StatusOK},
+		{"POST unknown dead letter retry", newRequest("POST", deadLettersPath+"/unknown/retry", ""), http.StatusNotFound},
+		{"POST republish", newRequest("POST", republishPath, `{"uuids":["`+TestConceptUuid+`"]}`), http.StatusAccepted},
+		{"POST republish without uuids", newRequest("POST", republishPath, `{}`), http.StatusBadRequest},
+		{"GET unknown republish job", newRequest("GET", republishPath+"/unknown", ""), http.StatusNotFound},
+		{"GET API definition", newRequest("GET", apiPath, ""), http.StatusOK},
+		{"GET build info", newRequest("GET", status.BuildInfoPath, ""), http.StatusOK},
+		{"GET health", newRequest("GET", healthPath, ""), http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			rec := serveContract(router, testCase.request)
+			assert.Equal(t, testCase.expectedCode, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func kindErrors(newError func(awserrors.ErrorKind) error, kinds []awserrors.ErrorKind) []error {
+	errs := []error{}
+	for _, kind := range kinds {
+		errs = append(errs, newError(kind))
+	}
+	return errs
+}
+
+func TestSpec_StoreErrorsMatchDefinition(t *testing.T) {
+	kinds := []awserrors.ErrorKind{awserrors.KindThrottled, awserrors.KindAccessDenied, awserrors.KindValidation, awserrors.KindNotFound, awserrors.KindTimeout}
+	for _, method := range []string{"GET", "HEAD", "PUT", "DELETE"} {
+		for _, err := range append(kindErrors(dbError, kinds), kindErrors(snsError, kinds)...) {
+			router := newContractRouter(t, AppConfig{}, &MockService{err: err}, nil)
+			body := ""
+			if method == "PUT" {
+				body = GoodBody
+			}
+
+			rec := serveContract(router, newRequest(method, Path, body))
+
+			assert.NotEqual(t, http.StatusOK, rec.Code, "%s should fail with errors of kind %d", method, awserrors.KindOf(err))
+		}
+	}
+}
+
+func TestSpecValidator_RejectsRequestsOutsideOfDefinition(t *testing.T) {
+	srv := &MockService{}
+	router := newContractRouter(t, AppConfig{}, srv, nil)
+
+	rec := serveContract(router, newRequest("PUT", Path, `{"uuid":1,"identifiers":[{"authority":"TME","uuid":"`+ConcordedUuid1+`"}],"expiresAt":"tomorrow"}`))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	problem := decodeProblem(t, rec)
+	assert.Equal(t, CodeInvalidRequest, problem.Code)
+	assert.Equal(t, "Request does not match the API definition", problem.Detail)
+	assert.Equal(t, TestConceptUuid, problem.UUID)
+	fields := []string{}
+	for _, violation := range problem.Violations {
+		fields = append(fields, violation.Field)
+	}
+	assert.ElementsMatch(t, []string{"uuid", "identifiers[0].identifierValue", "expiresAt"}, fields)
+	assert.Equal(t, db.ConcordancesModel{}, srv.written, "Request should not have been handled")
+}
+
+func TestSpecValidator_RejectsInvalidHeaders(t *testing.T) {
+	router := newContractRouter(t, AppConfig{SuppressionKey: "secret"}, &MockService{}, nil)
+	req := newRequest("DELETE", Path, "")
+	req.Header.Set(SuppressNotificationHeader, "maybe")
+
+	rec := serveContract(router, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"field":"`+SuppressNotificationHeader+`"`)
+}
+
+func TestSpecValidator_AcceptsBodyWithoutContentType(t *testing.T) {
+	srv := &MockService{}
+	router := newContractRouter(t, AppConfig{}, srv, nil)
+	req := newRequest("PUT", Path, GoodBody)
+	assert.Empty(t, req.Header.Get("Content-Type"))
+
+	rec := serveContract(router, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Equal(t, TestConceptUuid, srv.written.UUID, "Body should still be readable by the handler")
+}
+
+func TestSpecValidator_IgnoresPathsOutsideOfDefinition(t *testing.T) {
+	tenant := &MockService{model: identifiersModel}
+	router := newContractRouter(t, AppConfig{}, &MockService{}, map[string]Service{"factset": tenant})
+
+	rec := serveContract(router, newRequest("GET", "/factset"+Path, ""))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandler_API(t *testing.T) {
+	router := mux.NewRouter()
+	NewHandler(router, AppConfig{}, &MockService{}, nil)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("GET", apiPath, ""))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, ContentTypeYAML, rec.Header().Get("Content-Type"))
+	assert.Equal(t, api.Spec, rec.Body.Bytes())
+}
@@ -0,0 +1,143 @@
+package concordances
+
+import (
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultOutboxSweepInterval = time.Minute
+	// DefaultOutboxGiveUpAfter is how long a change is retried before it is kept as a dead letter.
+	DefaultOutboxGiveUpAfter = 10 * time.Minute
+
+	dispatchQueueSize   = 1000
+	dispatchMaxAttempts = 5
+)
+
+type dispatchJob struct {
+	uuid     string
+	attempts int
+}
+
+// Dispatcher announces the changes recorded in the outbox of concordance records, in the order they were made,
+// and acknowledges each change once it has been published. Changes are dispatched as soon as they are made,
+// retried a few times if they cannot be published, and periodically swept up from the whole table,
+// e.g. after a restart, so that every change is announced at least once. A change that still cannot be published
+// once it is older than giveUpAfter is kept as a dead letter and acknowledged, so that it no longer holds up
+// the changes made after it, nor the expiry of the record.
+type Dispatcher struct {
+	outbox      db.Outbox
+	notifier    Notifier
+	counters    *counters
+	deadLetters *DeadLetterStore
+	tenant      string
+	queue       chan dispatchJob
+	retryDelay  time.Duration
+	giveUpAfter time.Duration
+}
+
+func NewDispatcher(outbox db.Outbox, notifier Notifier, counters *counters) *Dispatcher {
+	return &Dispatcher{outbox: outbox, notifier: notifier, counters: counters, tenant: DefaultTenant, queue: make(chan dispatchJob, dispatchQueueSize), retryDelay: time.Second, giveUpAfter: DefaultOutboxGiveUpAfter}
+}
+
+// Start dispatches changes in the background, sweeping the table for undelivered changes at the given interval.
+func (d *Dispatcher) Start(sweepInterval time.Duration) {
+	if sweepInterval <= 0 {
+		sweepInterval = DefaultOutboxSweepInterval
+	}
+	go func() {
+		sweep := time.Tick(sweepInterval)
+		for {
+			select {
+			case job := <-d.queue:
+				d.dispatch(job)
+			case <-sweep:
+				d.Sweep()
+			}
+		}
+	}()
+}
+
+// Dispatch queues the pending changes of a record for delivery. Changes that cannot be queued are delivered by the next sweep.
+func (d *Dispatcher) Dispatch(uuid string) {
+	select {
+	case d.queue <- dispatchJob{uuid: uuid}:
+	default:
+		log.WithField("UUID", uuid).Warn("Dispatch queue is full, changes will be announced by the next sweep")
+	}
+}
+
+// Sweep delivers the pending changes of every record of the table.
+func (d *Dispatcher) Sweep() {
+	err := d.outbox.ScanPending(func(uuid string) error {
+		d.deliver(uuid)
+		return nil
+	})
+	if err != nil {
+		d.counters.inc(&d.counters.errors)
+		log.WithError(err).Error("Error sweeping the outbox of concordance records")
+	}
+}
+
+func (d *Dispatcher) dispatch(job dispatchJob) {
+	job.attempts++
+	if err := d.deliver(job.uuid); err != nil && job.attempts < dispatchMaxAttempts {
+		go func() {
+			time.Sleep(d.retryDelay * time.Duration(job.attempts))
+			d.queue <- job
+		}()
+	}
+}
+
+// deliver publishes and acknowledges the pending changes of a record, oldest first, stopping at the first change that fails.
+func (d *Dispatcher) deliver(uuid string) error {
+	changes, err := d.outbox.PendingChanges(uuid)
+	if err != nil {
+		d.counters.inc(&d.counters.errors)
+		return err
+	}
+
+	for _, change := range changes {
+		event := changeEvent(uuid, change)
+		if err := d.notifier.SendMessage(event); err != nil {
+			d.counters.inc(&d.counters.errors)
+			log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": change.TransactionID}).Error("Error notifying Concordance change")
+			if !d.keepDeadLetter(change, event, err) {
+				return err
+			}
+		} else {
+			d.counters.inc(&d.counters.snsPublishes)
+		}
+
+		if err := d.outbox.AcknowledgeChange(uuid, change.ID); err != nil {
+			d.counters.inc(&d.counters.errors)
+			return err
+		}
+	}
+	return nil
+}
+
+// keepDeadLetter keeps a change that has been retried for long enough as a dead letter, telling whether it was kept.
+func (d *Dispatcher) keepDeadLetter(change db.Change, event sns.Event, cause error) bool {
+	if d.deadLetters == nil || time.Since(change.Timestamp) < d.giveUpAfter {
+		return false
+	}
+	logEntry := log.WithFields(log.Fields{"UUID": event.UUID, "transaction_id": event.TransactionID, "tenant": d.tenant})
+	letter, err := d.deadLetters.Add(d.tenant, event, cause)
+	if err != nil {
+		logEntry.WithError(err).Error("Error keeping undelivered notification as a dead letter")
+		return false
+	}
+	logEntry.WithField("dead_letter", letter.ID).Warn("Kept undelivered notification as a dead letter")
+	return true
+}
+
+func changeEvent(uuid string, change db.Change) sns.Event {
+	event := sns.NewEvent(eventType(change.Status), uuid, change.TransactionID, change.OldConcordedIds, change.NewConcordedIds)
+	event.Timestamp = change.Timestamp
+	event.Authorities = change.Authorities
+	return event
+}
@@ -0,0 +1,176 @@
+package concordances
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockOutbox struct {
+	changes      map[string][]db.Change
+	acknowledged []string
+	scanErr      error
+}
+
+func (o *MockOutbox) PendingChanges(uuid string) ([]db.Change, error) {
+	return o.changes[uuid], nil
+}
+
+func (o *MockOutbox) AcknowledgeChange(uuid string, changeId string) error {
+	o.acknowledged = append(o.acknowledged, changeId)
+	o.changes[uuid] = o.changes[uuid][1:]
+	return nil
+}
+
+func (o *MockOutbox) ScanPending(fn func(uuid string) error) error {
+	if o.scanErr != nil {
+		return o.scanErr
+	}
+	for uuid, changes := range o.changes {
+		if len(changes) > 0 {
+			if err := fn(uuid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type FailingSNSClient struct {
+	MockSNSClient
+	failAfter int
+}
+
+func (c *FailingSNSClient) SendMessage(event sns.Event) error {
+	if len(c.events) >= c.failAfter {
+		return errors.New(SNS_ERROR)
+	}
+	return c.MockSNSClient.SendMessage(event)
+}
+
+func pendingChanges() map[string][]db.Change {
+	timestamp := time.Date(2017, 11, 1, 12, 0, 0, 0, time.UTC)
+	return map[string][]db.Change{
+		EXPECTED_UUID: {
+			{ID: "change-1", Status: db.CONCORDANCE_CREATED, TransactionID: "tid_1", Timestamp: timestamp, NewConcordedIds: []string{"A"}, Authorities: []string{"TME"}},
+			{ID: "change-2", Status: db.CONCORDANCE_DELETED, TransactionID: "tid_2", Timestamp: timestamp.Add(time.Minute), OldConcordedIds: []string{"A"}},
+		},
+	}
+}
+
+func TestDispatcher_DeliversChangesInOrder(t *testing.T) {
+	outbox := &MockOutbox{changes: pendingChanges()}
+	snsClient := &MockSNSClient{Happy: true}
+	srv := createService(&MockDynamoDBClient{Happy: true}, snsClient)
+	dispatcher := NewDispatcher(outbox, snsClient, &srv.counters)
+
+	err := dispatcher.deliver(EXPECTED_UUID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"change-1", "change-2"}, outbox.acknowledged)
+	assert.Len(t, snsClient.events, 2)
+	assert.Equal(t, sns.EventCreated, snsClient.events[0].Type)
+	assert.Equal(t, "tid_1", snsClient.events[0].TransactionID)
+	assert.Equal(t, time.Date(2017, 11, 1, 12, 0, 0, 0, time.UTC), snsClient.events[0].Timestamp, "Event should be timestamped with the time of the change")
+	assert.Equal(t, []string{"TME"}, snsClient.events[0].Authorities)
+	assert.Equal(t, sns.EventDeleted, snsClient.events[1].Type)
+	assert.Equal(t, []string{"A"}, snsClient.events[1].OldConcordedIds)
+	assert.Equal(t, int64(2), srv.counters.snapshot().SNSPublishes)
+}
+
+func TestDispatcher_StopsAtFailedChange(t *testing.T) {
+	outbox := &MockOutbox{changes: pendingChanges()}
+	snsClient := &FailingSNSClient{MockSNSClient: MockSNSClient{Happy: true}, failAfter: 1}
+	srv := createService(&MockDynamoDBClient{Happy: true}, snsClient)
+	dispatcher := NewDispatcher(outbox, snsClient, &srv.counters)
+
+	err := dispatcher.deliver(EXPECTED_UUID)
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"change-1"}, outbox.acknowledged, "Changes that were not published should stay in the outbox")
+	assert.Len(t, outbox.changes[EXPECTED_UUID], 1)
+	assert.Equal(t, int64(1), srv.counters.snapshot().Errors)
+}
+
+func TestDispatcher_KeepsUndeliverableChangeAsDeadLetter(t *testing.T) {
+	changes := pendingChanges()
+	changes[EXPECTED_UUID][1].Timestamp = time.Now()
+	outbox := &MockOutbox{changes: changes}
+	snsClient := &FailingSNSClient{MockSNSClient: MockSNSClient{Happy: true}, failAfter: 0}
+	srv := createService(&MockDynamoDBClient{Happy: true}, snsClient)
+	dispatcher := NewDispatcher(outbox, snsClient, &srv.counters)
+	deadLetters, err := NewDeadLetterStore("")
+	assert.NoError(t, err)
+	dispatcher.deadLetters = deadLetters
+
+	err = dispatcher.deliver(EXPECTED_UUID)
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"change-1"}, outbox.acknowledged, "Change older than giveUpAfter should be acknowledged once kept as a dead letter")
+	letters := deadLetters.List()
+	assert.Len(t, letters, 1, "Only the change older than giveUpAfter should be kept as a dead letter")
+	assert.Equal(t, "tid_1", letters[0].TransactionID)
+	assert.Equal(t, DefaultTenant, letters[0].Tenant)
+}
+
+func TestDispatcher_Sweep(t *testing.T) {
+	outbox := &MockOutbox{changes: pendingChanges()}
+	snsClient := &MockSNSClient{Happy: true}
+	srv := createService(&MockDynamoDBClient{Happy: true}, snsClient)
+	dispatcher := NewDispatcher(outbox, snsClient, &srv.counters)
+
+	dispatcher.Sweep()
+
+	assert.Equal(t, []string{"change-1", "change-2"}, outbox.acknowledged)
+
+	outbox.scanErr = errors.New(DDB_ERROR)
+	dispatcher.Sweep()
+	assert.Equal(t, int64(1), srv.counters.snapshot().Errors)
+}
+
+func TestDispatcher_RetriesFailedDelivery(t *testing.T) {
+	outbox := &MockOutbox{changes: pendingChanges()}
+	snsClient := &FailingSNSClient{MockSNSClient: MockSNSClient{Happy: true}, failAfter: 0}
+	srv := createService(&MockDynamoDBClient{Happy: true}, snsClient)
+	dispatcher := NewDispatcher(outbox, snsClient, &srv.counters)
+	dispatcher.retryDelay = time.Millisecond
+
+	dispatcher.dispatch(dispatchJob{uuid: EXPECTED_UUID})
+
+	select {
+	case job := <-dispatcher.queue:
+		assert.Equal(t, 1, job.attempts, "Failed delivery should be queued again")
+	case <-time.After(time.Second):
+		assert.Fail(t, "Failed delivery was not retried")
+	}
+
+	dispatcher.dispatch(dispatchJob{uuid: EXPECTED_UUID, attempts: dispatchMaxAttempts - 1})
+	select {
+	case <-dispatcher.queue:
+		assert.Fail(t, "Delivery should be left to the sweep after the last attempt")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestServiceWithOutbox_DispatchesChanges(t *testing.T) {
+	snsClient := &MockSNSClient{Happy: true}
+	srv := createService(&MockDynamoDBClient{Happy: true}, snsClient)
+	srv.dispatcher = NewDispatcher(&MockOutbox{changes: map[string][]db.Change{}}, snsClient, &srv.counters)
+
+	status, err := srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "testing_tid_1234")
+	assert.NoError(t, err)
+	assert.Equal(t, db.CONCORDANCE_CREATED, status)
+	status, err = srv.Delete(EXPECTED_UUID, "testing_tid_1234")
+	assert.NoError(t, err)
+	assert.Equal(t, db.CONCORDANCE_DELETED, status)
+	status, err = srv.Delete(EXPECTED_UUID, "testing_tid_1234")
+	assert.NoError(t, err)
+	assert.Equal(t, db.CONCORDANCE_NOT_FOUND, status)
+
+	assert.False(t, snsClient.Invoked, "Changes should be announced by the dispatcher")
+	assert.Len(t, srv.dispatcher.queue, 2, "Changes should be dispatched, except for records that were not found")
+}
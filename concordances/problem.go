@@ -0,0 +1,120 @@
+package concordances
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/awserrors"
+)
+
+const ContentTypeProblemJson = "application/problem+json"
+
+// throttledRetryAfter is how long clients are asked to wait before retrying requests throttled by DynamoDB or SNS,
+// which have already been retried by the AWS SDK.
+const throttledRetryAfter = 5 * time.Second
+
+// Codes of the problems reported by the API. Unlike the details of a problem, they do not change and clients can rely on them.
+const (
+	CodeUnknownTenant          = "UNKNOWN_TENANT"
+	CodeInvalidHeader          = "INVALID_HEADER"
+	CodeSuppressionForbidden   = "SUPPRESSION_FORBIDDEN"
+	CodeSuppressionUnsupported = "SUPPRESSION_UNSUPPORTED"
+	CodeInvalidRequest         = "INVALID_REQUEST"
+	CodeMalformedBody          = "MALFORMED_BODY"
+	CodeInvalidConcordance     = "INVALID_CONCORDANCE"
+	CodeConcordanceNotFound    = "CONCORDANCE_NOT_FOUND"
+	CodeAuthorityNotFound      = "AUTHORITY_NOT_FOUND"
+	CodeRenderingFailed        = "RENDERING_FAILED"
+	CodeStoreUnavailable       = "STORE_UNAVAILABLE"
+	CodeThrottled              = "THROTTLED"
+	CodeAccessDenied           = "ACCESS_DENIED"
+	CodeRejectedByAWS          = "REJECTED_BY_AWS"
+	CodeNotificationRejected   = "NOTIFICATION_REJECTED"
+	CodeTableNotFound          = "TABLE_NOT_FOUND"
+	CodeTopicNotFound          = "TOPIC_NOT_FOUND"
+	CodeTimeout                = "TIMEOUT"
+	CodeRepublishJobNotFound   = "REPUBLISH_JOB_NOT_FOUND"
+	CodeRepublishJobRunning    = "REPUBLISH_JOB_RUNNING"
+	CodeDeadLetterNotFound     = "DEAD_LETTER_NOT_FOUND"
+	CodeDeliveryFailed         = "DELIVERY_FAILED"
+)
+
+// Problem describes why a request failed, as the RFC 7807 problem details the API responds with. The code of the problem,
+// the transaction and the concept of the request and the fields of the body in error are extension members.
+type Problem struct {
+	Type          string      `json:"type"`
+	Title         string      `json:"title"`
+	Status        int         `json:"status"`
+	Detail        string      `json:"detail,omitempty"`
+	Code          string      `json:"code"`
+	TransactionID string      `json:"transactionId,omitempty"`
+	UUID          string      `json:"uuid,omitempty"`
+	Violations    []Violation `json:"violations,omitempty"`
+	// RetryAfter is sent as the Retry-After header, when the request is worth retrying later.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// problemError is an error found with a request, reported with the status and the code it is raised with.
+type problemError struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e problemError) Error() string {
+	return e.msg
+}
+
+// problemOf describes an error found with a request, a bad request unless it was raised as a problemError.
+func problemOf(err error, transactionID string, uuid string) Problem {
+	p := Problem{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: err.Error(), TransactionID: transactionID, UUID: uuid}
+	if e, ok := err.(problemError); ok {
+		p.Status = e.status
+		p.Code = e.code
+	}
+	return p
+}
+
+// storeProblem describes an error of DynamoDB or SNS by its kind, the store being unavailable when its kind is not known.
+func storeProblem(err error, detail string, transactionID string, uuid string) Problem {
+	p := Problem{Status: http.StatusServiceUnavailable, Code: CodeStoreUnavailable, Detail: detail, TransactionID: transactionID, UUID: uuid}
+	fromSNS := awserrors.ServiceOf(err) == awserrors.ServiceSNS
+	switch awserrors.KindOf(err) {
+	case awserrors.KindThrottled:
+		p.Code, p.RetryAfter = CodeThrottled, throttledRetryAfter
+	case awserrors.KindAccessDenied:
+		p.Status, p.Code = http.StatusInternalServerError, CodeAccessDenied
+	case awserrors.KindValidation:
+		// Only the record is the client's to fix, SNS rejects the messages the service builds.
+		p.Status, p.Code = http.StatusBadRequest, CodeRejectedByAWS
+		if fromSNS {
+			p.Status, p.Code = http.StatusInternalServerError, CodeNotificationRejected
+		}
+	case awserrors.KindNotFound:
+		p.Status, p.Code = http.StatusInternalServerError, CodeTableNotFound
+		if fromSNS {
+			p.Code = CodeTopicNotFound
+		}
+	case awserrors.KindTimeout:
+		p.Status, p.Code = http.StatusGatewayTimeout, CodeTimeout
+	}
+	return p
+}
+
+// writeProblem responds with the problem, its type left as about:blank and its title as the HTTP status unless they are given.
+func writeProblem(rw http.ResponseWriter, p Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	rw.Header().Set("Content-Type", ContentTypeProblemJson)
+	if p.RetryAfter > 0 {
+		rw.Header().Set("Retry-After", strconv.Itoa(int(p.RetryAfter/time.Second)))
+	}
+	rw.WriteHeader(p.Status)
+	json.NewEncoder(rw).Encode(p)
+}
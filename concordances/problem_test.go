@@ -0,0 +1,143 @@
+package concordances
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/awserrors"
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	assert.Equal(t, ContentTypeProblemJson, rec.Header().Get("Content-Type"), "Incorrect Content-Type Header")
+	problem := Problem{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem), "Response body should be a problem: %s", rec.Body.String())
+	return problem
+}
+
+func TestWriteProblem(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	writeProblem(rec, Problem{Status: http.StatusNotFound, Code: CodeConcordanceNotFound, Detail: "Unable to find concordance", TransactionID: "tid_test", UUID: TestConceptUuid})
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, ContentTypeProblemJson, rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Not Found","status":404,"detail":"Unable to find concordance",`+
+		`"code":"CONCORDANCE_NOT_FOUND","transactionId":"tid_test","uuid":"`+TestConceptUuid+`"}`, rec.Body.String())
+}
+
+func TestWriteProblem_EscapesDetail(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	writeProblem(rec, Problem{Status: http.StatusBadRequest, Code: CodeUnknownTenant, Detail: `Unknown tenant ("quoted"\)`})
+
+	assert.Equal(t, `Unknown tenant ("quoted"\)`, decodeProblem(t, rec).Detail)
+}
+
+func TestProblemOf(t *testing.T) {
+	testCases := []struct {
+		description    string
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"Problem error", problemError{http.StatusForbidden, CodeSuppressionForbidden, "Not authorised to suppress notifications"}, http.StatusForbidden, CodeSuppressionForbidden},
+		{"Other error", errors.New("Not a problem error"), http.StatusBadRequest, CodeInvalidRequest},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			problem := problemOf(testCase.err, "tid_test", TestConceptUuid)
+
+			assert.Equal(t, Problem{Status: testCase.expectedStatus, Code: testCase.expectedCode, Detail: testCase.err.Error(), TransactionID: "tid_test", UUID: TestConceptUuid}, problem)
+		})
+	}
+}
+
+func TestHandler_ProblemHasTransactionID(t *testing.T) {
+	h.srv = &MockService{status: db.CONCORDANCE_NOT_FOUND}
+	req := newRequest("DELETE", Path, "")
+	req.Header.Set("X-Request-Id", "tid_problem")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	problem := decodeProblem(t, rec)
+	assert.Equal(t, http.StatusNotFound, problem.Status)
+	assert.Equal(t, "tid_problem", problem.TransactionID)
+	assert.Equal(t, TestConceptUuid, problem.UUID)
+}
+
+type failingNotifier struct {
+	err error
+}
+
+func (n *failingNotifier) SendMessage(event sns.Event) error {
+	return n.err
+}
+
+func (n *failingNotifier) Healthcheck() (bool, error) {
+	return false, n.err
+}
+
+func dbError(kind awserrors.ErrorKind) error {
+	return &awserrors.Error{Kind: kind, Service: awserrors.ServiceDynamoDB, Err: assert.AnError}
+}
+
+func snsError(kind awserrors.ErrorKind) error {
+	return &awserrors.Error{Kind: kind, Service: awserrors.ServiceSNS, Err: assert.AnError}
+}
+
+func TestHandler_StoreErrors(t *testing.T) {
+	testCases := []struct {
+		description        string
+		method             string
+		err                error
+		expectedStatus     int
+		expectedCode       string
+		expectedRetryAfter string
+	}{
+		{"Unknown", "GET", errors.New("DynamoDB error"), http.StatusServiceUnavailable, CodeStoreUnavailable, ""},
+		{"Throttled read", "GET", dbError(awserrors.KindThrottled), http.StatusServiceUnavailable, CodeThrottled, "5"},
+		{"Throttled notification", "PUT", snsError(awserrors.KindThrottled), http.StatusServiceUnavailable, CodeThrottled, "5"},
+		{"Access denied", "DELETE", dbError(awserrors.KindAccessDenied), http.StatusInternalServerError, CodeAccessDenied, ""},
+		{"Notification access denied", "DELETE", snsError(awserrors.KindAccessDenied), http.StatusInternalServerError, CodeAccessDenied, ""},
+		{"Validation", "PUT", dbError(awserrors.KindValidation), http.StatusBadRequest, CodeRejectedByAWS, ""},
+		{"Notification validation", "PUT", snsError(awserrors.KindValidation), http.StatusInternalServerError, CodeNotificationRejected, ""},
+		{"Missing table", "GET", dbError(awserrors.KindNotFound), http.StatusInternalServerError, CodeTableNotFound, ""},
+		{"Missing topic", "PUT", snsError(awserrors.KindNotFound), http.StatusInternalServerError, CodeTopicNotFound, ""},
+		{"Timeout", "GET", dbError(awserrors.KindTimeout), http.StatusGatewayTimeout, CodeTimeout, ""},
+		{"Notification timeout", "DELETE", snsError(awserrors.KindTimeout), http.StatusGatewayTimeout, CodeTimeout, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			h.srv = &MockService{err: testCase.err}
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, newRequest(testCase.method, Path, GoodBody))
+
+			assert.Equal(t, testCase.expectedStatus, rec.Code)
+			assert.Equal(t, testCase.expectedRetryAfter, rec.Header().Get("Retry-After"))
+			problem := decodeProblem(t, rec)
+			assert.Equal(t, testCase.expectedCode, problem.Code)
+			assert.Equal(t, TestConceptUuid, problem.UUID)
+		})
+	}
+}
+
+func TestService_PropagatesClassifiedErrors(t *testing.T) {
+	notifier := &failingNotifier{err: snsError(awserrors.KindNotFound)}
+	srv := createService(&MockDynamoDBClient{Happy: true}, notifier)
+
+	status, err := srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "testing_tid_1234")
+
+	assert.Equal(t, db.CONCORDANCE_ERROR, status)
+	assert.Equal(t, awserrors.KindNotFound, awserrors.KindOf(err), "SNS errors should keep their kind")
+	assert.Equal(t, http.StatusInternalServerError, storeProblem(err, "Error writing concordance", "testing_tid_1234", EXPECTED_UUID).Status)
+}
@@ -0,0 +1,294 @@
+package concordances
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	republishPath = "/__republish"
+
+	// DefaultRepublishRate is the number of events a republish job sends per second.
+	DefaultRepublishRate = 10
+
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobCancelled = "cancelled"
+	JobFailed    = "failed"
+)
+
+var errJobRunning = errors.New("A republish job is already running")
+
+// RepublishRequest names the concordance records to announce again, either by UUID or all the records of the table.
+type RepublishRequest struct {
+	UUIDs []string `json:"uuids,omitempty"`
+	All   bool     `json:"all,omitempty"`
+}
+
+// RepublishJob reports the progress of announcing existing concordance records again.
+type RepublishJob struct {
+	ID            string     `json:"id"`
+	Tenant        string     `json:"tenant"`
+	TransactionID string     `json:"transactionId"`
+	Status        string     `json:"status"`
+	StartedAt     time.Time  `json:"startedAt"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+	// Total is the number of records to republish, unknown until the end of the job when republishing all the records.
+	Total     int    `json:"total,omitempty"`
+	Processed int    `json:"processed"`
+	Published int    `json:"published"`
+	NotFound  int    `json:"notFound"`
+	Failed    int    `json:"failed"`
+	Error     string `json:"error,omitempty"`
+
+	cancel chan struct{}
+}
+
+// Republisher runs one republish job at a time, sending the events of existing records at a limited rate,
+// so that downstream consumers that lost their state can rebuild it without the records being written again.
+type Republisher struct {
+	rate int
+
+	sync.Mutex
+	jobs    map[string]*RepublishJob
+	running *RepublishJob
+	lastID  int
+}
+
+func NewRepublisher(rate int) *Republisher {
+	if rate <= 0 {
+		rate = DefaultRepublishRate
+	}
+	return &Republisher{rate: rate, jobs: map[string]*RepublishJob{}}
+}
+
+// Start republishes the requested records of a tenant in the background, unless another job is still running.
+func (p *Republisher) Start(tenant string, srv Service, req RepublishRequest, transactionId string) (RepublishJob, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.running != nil {
+		return *p.running, errJobRunning
+	}
+
+	p.lastID++
+	job := &RepublishJob{
+		ID:            strconv.Itoa(p.lastID),
+		Tenant:        tenant,
+		TransactionID: transactionId,
+		Status:        JobRunning,
+		StartedAt:     time.Now(),
+		Total:         len(req.UUIDs),
+		cancel:        make(chan struct{}),
+	}
+	p.jobs[job.ID] = job
+	p.running = job
+
+	log.WithFields(log.Fields{"transaction_id": transactionId, "tenant": tenant, "job": job.ID, "all": req.All, "records": len(req.UUIDs)}).Info("Starting republish job")
+	go p.run(job, srv, req)
+	return *job, nil
+}
+
+// Job returns the status of a job.
+func (p *Republisher) Job(id string) (RepublishJob, bool) {
+	p.Lock()
+	defer p.Unlock()
+	job, found := p.jobs[id]
+	if !found {
+		return RepublishJob{}, false
+	}
+	return *job, true
+}
+
+// Cancel stops a running job after the record being republished. It returns false if there is no such job.
+func (p *Republisher) Cancel(id string) (RepublishJob, bool) {
+	p.Lock()
+	defer p.Unlock()
+	job, found := p.jobs[id]
+	if !found {
+		return RepublishJob{}, false
+	}
+	if job.Status == JobRunning {
+		select {
+		case <-job.cancel:
+		default:
+			close(job.cancel)
+		}
+	}
+	return *job, true
+}
+
+func (p *Republisher) run(job *RepublishJob, srv Service, req RepublishRequest) {
+	ticker := time.NewTicker(time.Second / time.Duration(p.rate))
+	defer ticker.Stop()
+
+	// errCancelled stops the scan of the table when the job is cancelled.
+	errCancelled := errors.New("cancelled")
+	republish := func(m db.ConcordancesModel, err error) error {
+		select {
+		case <-job.cancel:
+			return errCancelled
+		case <-ticker.C:
+		}
+		p.republish(job, srv, m, err)
+		return nil
+	}
+
+	var err error
+	if req.All {
+		scanner, ok := srv.getDBClient().(db.Scanner)
+		if !ok {
+			err = errors.New("table cannot be scanned")
+		} else {
+			err = scanner.Scan(func(m db.ConcordancesModel) error {
+				return republish(m, nil)
+			})
+		}
+	} else {
+		for _, uuid := range req.UUIDs {
+			m, readErr := srv.getDBClient().Read(uuid, job.TransactionID)
+			m.UUID = uuid
+			if err = republish(m, readErr); err != nil {
+				break
+			}
+		}
+	}
+	p.finish(job, err, errCancelled)
+}
+
+func (p *Republisher) republish(job *RepublishJob, srv Service, m db.ConcordancesModel, err error) {
+	logEntry := log.WithFields(log.Fields{"UUID": m.UUID, "transaction_id": job.TransactionID, "job": job.ID})
+	if err == nil && (m.ConcordedIds == nil || m.Expired) {
+		logEntry.Info("Unable to find concordance to republish")
+		p.update(job, func() { job.NotFound++ })
+		return
+	}
+	if err == nil {
+		err = srv.getNotifier().SendMessage(republishEvent(m, job.TransactionID))
+	}
+	if err != nil {
+		logEntry.WithError(err).Error("Error republishing concordance")
+		p.update(job, func() { job.Failed++ })
+		return
+	}
+	p.update(job, func() { job.Published++ })
+}
+
+// republishEvent announces the current state of a record as an update without previous concorded ids,
+// as consumers that lost their state need to learn every concorded id of the record again.
+func republishEvent(m db.ConcordancesModel, transactionId string) sns.Event {
+	event := sns.NewEvent(sns.EventUpdated, m.UUID, transactionId, nil, m.ConcordedIds)
+	event.Authorities = db.Authorities(m)
+	return event
+}
+
+func (p *Republisher) update(job *RepublishJob, fn func()) {
+	p.Lock()
+	fn()
+	job.Processed++
+	p.Unlock()
+}
+
+func (p *Republisher) finish(job *RepublishJob, err error, errCancelled error) {
+	p.Lock()
+	defer p.Unlock()
+	now := time.Now()
+	job.FinishedAt = &now
+	switch {
+	case err == errCancelled:
+		job.Status = JobCancelled
+	case err != nil:
+		job.Status = JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = JobCompleted
+	}
+	if job.Total == 0 {
+		job.Total = job.Processed
+	}
+	p.running = nil
+
+	logEntry := log.WithFields(log.Fields{"transaction_id": job.TransactionID, "tenant": job.Tenant, "job": job.ID, "status": job.Status, "published": job.Published, "notFound": job.NotFound, "failed": job.Failed})
+	if err != nil && err != errCancelled {
+		logEntry.WithError(err).Error("Republish job failed")
+	} else {
+		logEntry.Info("Finished republish job")
+	}
+}
+
+func (h *Handler) HandleRepublish(rw http.ResponseWriter, r *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(r)
+	tenant, srv, err := h.resolveService(r)
+	//400
+	if err != nil {
+		log.WithField("transaction_id", tid).Error(err.Error())
+		writeProblem(rw, problemOf(err, tid, ""))
+		return
+	}
+
+	req := RepublishRequest{}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	defer r.Body.Close()
+	//400
+	if err != nil {
+		writeProblem(rw, Problem{Status: http.StatusBadRequest, Code: CodeMalformedBody, Detail: "Error decoding the JSON of the request body", TransactionID: tid, Violations: decodingViolations(err)})
+		return
+	}
+	if req.All == (len(req.UUIDs) > 0) {
+		writeProblem(rw, Problem{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: "Either a list of uuids or all should be requested", TransactionID: tid})
+		return
+	}
+	for i, uuid := range req.UUIDs {
+		if !uuidRegex.MatchString(uuid) {
+			violations := []Violation{{Field: fmt.Sprintf("uuids[%d]", i), Value: uuid, Message: "is not a valid UUID"}}
+			writeProblem(rw, Problem{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: fmt.Sprintf("Invalid UUID (%s)", uuid), TransactionID: tid, Violations: violations})
+			return
+		}
+	}
+
+	job, err := h.republisher.Start(tenant, srv, req, tid)
+	//409
+	if err != nil {
+		writeProblem(rw, Problem{Status: http.StatusConflict, Code: CodeRepublishJobRunning, Detail: fmt.Sprintf("%s (%s)", err.Error(), job.ID), TransactionID: tid})
+		return
+	}
+	//202
+	rw.Header().Set("Location", republishPath+"/"+job.ID)
+	writeJob(rw, job, http.StatusAccepted)
+}
+
+func (h *Handler) HandleRepublishStatus(rw http.ResponseWriter, r *http.Request) {
+	job, found := h.republisher.Job(mux.Vars(r)[ID_Param])
+	//404
+	if !found {
+		writeProblem(rw, Problem{Status: http.StatusNotFound, Code: CodeRepublishJobNotFound, Detail: "Unable to find republish job", TransactionID: transactionidutils.GetTransactionIDFromRequest(r)})
+		return
+	}
+	writeJob(rw, job, http.StatusOK)
+}
+
+func (h *Handler) HandleRepublishCancel(rw http.ResponseWriter, r *http.Request) {
+	job, found := h.republisher.Cancel(mux.Vars(r)[ID_Param])
+	//404
+	if !found {
+		writeProblem(rw, Problem{Status: http.StatusNotFound, Code: CodeRepublishJobNotFound, Detail: "Unable to find republish job", TransactionID: transactionidutils.GetTransactionIDFromRequest(r)})
+		return
+	}
+	writeJob(rw, job, http.StatusAccepted)
+}
+
+func writeJob(rw http.ResponseWriter, job RepublishJob, statusCode int) {
+	rw.Header().Set("Content-Type", ContentTypeJson)
+	rw.WriteHeader(statusCode)
+	json.NewEncoder(rw).Encode(job)
+}
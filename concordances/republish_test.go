@@ -0,0 +1,166 @@
+package concordances
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockReadingDynamoDBClient struct {
+	MockDynamoDBClient
+	records map[string]db.ConcordancesModel
+	err     error
+}
+
+func (ddb *MockReadingDynamoDBClient) Read(uuid string, transaction_id string) (db.ConcordancesModel, error) {
+	if ddb.err != nil {
+		return db.ConcordancesModel{}, ddb.err
+	}
+	return ddb.records[uuid], nil
+}
+
+func waitForJob(t *testing.T, p *Republisher, id string) RepublishJob {
+	for i := 0; i < 100; i++ {
+		job, _ := p.Job(id)
+		if job.Status != JobRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Fail(t, "Republish job did not finish")
+	return RepublishJob{}
+}
+
+func TestRepublisher_UUIDs(t *testing.T) {
+	snsClient := &MockSNSClient{Happy: true}
+	srv := createService(&MockReadingDynamoDBClient{records: map[string]db.ConcordancesModel{
+		UuidA: {UUID: UuidA, ConcordedIds: []string{UuidB}},
+		UuidC: {UUID: UuidC, ConcordedIds: []string{UuidD}, Expired: true},
+	}}, snsClient)
+	p := NewRepublisher(1000)
+
+	job, err := p.Start(DefaultTenant, &srv, RepublishRequest{UUIDs: []string{UuidA, UuidC, UuidE}}, "tid_republish")
+	assert.NoError(t, err)
+	assert.Equal(t, JobRunning, job.Status)
+
+	job = waitForJob(t, p, job.ID)
+	assert.Equal(t, JobCompleted, job.Status)
+	assert.Equal(t, 3, job.Total)
+	assert.Equal(t, 3, job.Processed)
+	assert.Equal(t, 1, job.Published)
+	assert.Equal(t, 2, job.NotFound, "Missing and expired records should not be republished")
+	assert.NotNil(t, job.FinishedAt)
+
+	assert.Len(t, snsClient.events, 1)
+	assert.Equal(t, sns.EventUpdated, snsClient.events[0].Type)
+	assert.Equal(t, UuidA, snsClient.events[0].UUID)
+	assert.Equal(t, "tid_republish", snsClient.events[0].TransactionID)
+	assert.Equal(t, []string{}, snsClient.events[0].OldConcordedIds)
+	assert.Equal(t, []string{UuidB}, snsClient.events[0].NewConcordedIds)
+}
+
+func TestRepublisher_All(t *testing.T) {
+	snsClient := &MockSNSClient{Happy: true}
+	srv := auditService(db.ConcordancesModel{UUID: UuidA, ConcordedIds: []string{UuidB}}, db.ConcordancesModel{UUID: UuidC, ConcordedIds: []string{UuidD}})
+	srv.notifier = snsClient
+	p := NewRepublisher(1000)
+
+	job, err := p.Start(DefaultTenant, srv, RepublishRequest{All: true}, "tid_republish")
+	assert.NoError(t, err)
+
+	job = waitForJob(t, p, job.ID)
+	assert.Equal(t, JobCompleted, job.Status)
+	assert.Equal(t, 2, job.Total, "Total should be known once the table has been scanned")
+	assert.Equal(t, 2, job.Published)
+	assert.Len(t, snsClient.events, 2)
+}
+
+func TestRepublisher_Failures(t *testing.T) {
+	srv := createService(&MockReadingDynamoDBClient{err: errors.New(DDB_ERROR)}, &MockSNSClient{Happy: true})
+	p := NewRepublisher(1000)
+	job, _ := p.Start(DefaultTenant, &srv, RepublishRequest{UUIDs: []string{UuidA}}, "tid_republish")
+	assert.Equal(t, 1, waitForJob(t, p, job.ID).Failed, "Records that cannot be read should be counted as failed")
+
+	srv = createService(&MockReadingDynamoDBClient{records: map[string]db.ConcordancesModel{UuidA: {UUID: UuidA, ConcordedIds: []string{UuidB}}}}, &MockSNSClient{Happy: false})
+	job, _ = p.Start(DefaultTenant, &srv, RepublishRequest{UUIDs: []string{UuidA}}, "tid_republish")
+	job = waitForJob(t, p, job.ID)
+	assert.Equal(t, JobCompleted, job.Status)
+	assert.Equal(t, 1, job.Failed, "Records that cannot be published should be counted as failed")
+
+	srv = createService(&MockDynamoDBClient{Happy: true}, &MockSNSClient{Happy: true})
+	job, _ = p.Start(DefaultTenant, &srv, RepublishRequest{All: true}, "tid_republish")
+	job = waitForJob(t, p, job.ID)
+	assert.Equal(t, JobFailed, job.Status)
+	assert.Equal(t, "table cannot be scanned", job.Error)
+}
+
+func TestRepublisher_OneJobAtATime(t *testing.T) {
+	srv := createService(&MockDynamoDBClient{Happy: true}, &MockSNSClient{Happy: true})
+	p := NewRepublisher(1)
+
+	running, err := p.Start(DefaultTenant, &srv, RepublishRequest{UUIDs: []string{UuidA, UuidB, UuidC}}, "tid_1")
+	assert.NoError(t, err)
+	job, err := p.Start(DefaultTenant, &srv, RepublishRequest{UUIDs: []string{UuidA}}, "tid_2")
+	assert.Equal(t, errJobRunning, err)
+	assert.Equal(t, running.ID, job.ID, "The running job should be returned")
+
+	p.Cancel(running.ID)
+	job = waitForJob(t, p, running.ID)
+	assert.Equal(t, JobCancelled, job.Status)
+	assert.True(t, job.Processed < 3, "Cancelled job should stop republishing")
+
+	_, err = p.Start(DefaultTenant, &srv, RepublishRequest{UUIDs: []string{UuidA}}, "tid_3")
+	assert.NoError(t, err, "A job should start once the previous one has been cancelled")
+}
+
+func TestHandler_Republish(t *testing.T) {
+	router := mux.NewRouter()
+	snsClient := &MockSNSClient{Happy: true}
+	srv := createService(&MockReadingDynamoDBClient{records: map[string]db.ConcordancesModel{UuidA: {UUID: UuidA, ConcordedIds: []string{UuidB}}}}, snsClient)
+	handler := NewHandler(router, AppConfig{RepublishRate: 1000}, &srv, map[string]Service{"factset": &MockService{}})
+
+	for _, body := range []string{`{}`, `{"uuids":["` + UuidA + `"],"all":true}`, `{"uuids":["not-a-uuid"]}`, `[]`} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, newRequest("POST", republishPath, body))
+		assert.Equal(t, 400, rec.Result().StatusCode, "Invalid request %s should be rejected", body)
+	}
+
+	req := newRequest("POST", republishPath, `{"uuids":["`+UuidA+`"]}`)
+	req.Header.Set(TenantHeader, "unknown")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, 400, rec.Result().StatusCode, "Unknown tenant should be rejected")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("POST", republishPath, `{"uuids":["`+UuidA+`"]}`))
+	assert.Equal(t, 202, rec.Result().StatusCode)
+	job := RepublishJob{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&job))
+	assert.Equal(t, republishPath+"/"+job.ID, rec.Header().Get("Location"))
+	assert.Equal(t, DefaultTenant, job.Tenant)
+
+	waitForJob(t, handler.republisher, job.ID)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("GET", republishPath+"/"+job.ID, ""))
+	assert.Equal(t, 200, rec.Result().StatusCode)
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&job))
+	assert.Equal(t, JobCompleted, job.Status)
+	assert.Equal(t, 1, job.Published)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest("DELETE", republishPath+"/"+job.ID, ""))
+	assert.Equal(t, 202, rec.Result().StatusCode, "Cancelling a finished job should leave it as it is")
+
+	for _, method := range []string{"GET", "DELETE"} {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, newRequest(method, republishPath+"/42", ""))
+		assert.Equal(t, 404, rec.Result().StatusCode, "Unknown job should not be found")
+	}
+}
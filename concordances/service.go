@@ -3,77 +3,305 @@ package concordances
 import (
 	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
 	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/Financial-Times/concordances-rw-dynamodb/webhook"
 	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	NotifierSNS     = "sns"
+	NotifierWebhook = "webhook"
 )
 
 type AppConfig struct {
-	AWSRegion         string
-	DynamoDbTableName string
-	SNSTopic          string
-	AppSystemCode     string
-	AppDescription    string
-	AppName           string
-	Port              string
+	AWSRegion                  string
+	DynamoDbTableName          string
+	SecondaryAWSRegion         string
+	SecondaryDynamoDbTableName string
+	ReplicationMode            string
+	SNSTopic                   string
+	SNSMessageFormat           string
+	SNSMessageAttributes       []string
+	SNSKeyLayout               sns.KeyLayout
+	AppSystemCode              string
+	AppDescription             string
+	AppName                    string
+	Port                       string
+	// GRPCPort is the port the gRPC API listens on, it is disabled when empty.
+	GRPCPort            string
+	Tenants             []TenantConfig
+	MaxConcordedIds     int
+	AuditInterval       time.Duration
+	AuditReportDir      string
+	NotificationOutbox  bool
+	OutboxSweepInterval time.Duration
+	// ExpirySweepInterval is the interval between sweeps of the table for expired records, sweeping is disabled when zero.
+	ExpirySweepInterval time.Duration
+	Notifier            string
+	Webhook             webhook.Config
+	RepublishRate       int
+	// MirrorBucket is the S3 bucket concordances are copied to, at the key legacy SNS messages announce, when set.
+	MirrorBucket   string
+	MirrorRegion   string
+	MirrorEndpoint string
+	// NotificationFanOut announces changes to every concept added to or removed from a concordance too.
+	NotificationFanOut bool
+	// NotificationSource is where changes are announced from, the requests to the service or the DynamoDB Stream of its table.
+	NotificationSource string
+	// StreamArn is the stream the changes are read from, the latest stream of the table when empty.
+	StreamArn           string
+	StreamCheckpointDir string
+	StreamStartPosition string
+	StreamPollInterval  time.Duration
+	// SuppressionKey allows requests carrying it to change records without notifying downstream services, when set.
+	SuppressionKey string
+	// DeadLetters keeps the notifications that could not be delivered, they are only logged when nil.
+	DeadLetters *DeadLetterStore
+	// tenant is the name the dead letters of the service are kept under.
+	tenant string
 }
 
 type Service interface {
 	Read(uuid string, transactionId string) (db.ConcordancesModel, error)
 	Write(m db.ConcordancesModel, transactionId string) (db.Status, error)
 	Delete(uuid string, transactionId string) (db.Status, error)
+	Stats() ServiceStats
 	getDBClient() db.Clienter
-	getSNSClient() sns.Clienter
+	getNotifier() Notifier
+}
+
+// Notifier announces changes to concordance records to downstream services.
+type Notifier interface {
+	SendMessage(event sns.Event) error
+	Healthcheck() (bool, error)
 }
 
 type ConcordancesRwService struct {
 	DynamoDbTable string
 	AwsRegion     string
 	ddb           db.Clienter
-	sns           sns.Clienter
+	notifier      Notifier
+	counters      counters
+	// dispatcher announces the changes recorded in the outbox of the table, when the table has one.
+	dispatcher *Dispatcher
+	// publisher announces the changes read from the stream of the table, when notifications are sent from the stream.
+	publisher   *StreamPublisher
+	mirror      *documentMirror
+	deadLetters *DeadLetterStore
+	tenant      string
 }
 
 func NewConcordancesRwService(conf AppConfig) Service {
-	return &ConcordancesRwService{DynamoDbTable: conf.DynamoDbTableName, AwsRegion: conf.AWSRegion, ddb: db.NewDynamoDBClient(conf.DynamoDbTableName, conf.AWSRegion), sns: sns.NewSNSClient(conf.SNSTopic, conf.AWSRegion)}
+	srv := &ConcordancesRwService{DynamoDbTable: conf.DynamoDbTableName, AwsRegion: conf.AWSRegion, ddb: newDBClient(conf), notifier: newNotifier(conf), deadLetters: conf.DeadLetters, tenant: conf.tenant, mirror: newDocumentMirror(conf)}
+	if srv.tenant == "" {
+		srv.tenant = DefaultTenant
+	}
+	if outbox, ok := srv.ddb.(db.Outbox); ok && conf.NotificationOutbox {
+		srv.dispatcher = NewDispatcher(outbox, srv.notifier, &srv.counters)
+		srv.dispatcher.deadLetters = conf.DeadLetters
+		srv.dispatcher.tenant = srv.tenant
+		srv.dispatcher.Start(conf.OutboxSweepInterval)
+	}
+	if _, ok := srv.ddb.(db.Expirer); ok && conf.ExpirySweepInterval > 0 {
+		srv.startExpirySweep(conf.ExpirySweepInterval)
+	}
+	if conf.NotificationSource == NotificationSourceStream {
+		reader, err := newStreamReader(conf)
+		if err != nil {
+			log.WithError(err).WithField("tenant", srv.tenant).Fatal("Unable to read the DynamoDB stream of the table")
+		}
+		srv.publisher = NewStreamPublisher(reader, srv.notifier, &srv.counters)
+		srv.publisher.deadLetters = conf.DeadLetters
+		srv.publisher.tenant = srv.tenant
+		srv.publisher.mirror = srv.mirror
+		srv.publisher.Start(conf.StreamPollInterval)
+	}
+	return srv
+}
+
+func newNotifier(conf AppConfig) Notifier {
+	var notifier Notifier
+	if conf.Notifier == NotifierWebhook {
+		notifier = webhook.NewWebhookClient(conf.Webhook)
+	} else {
+		notifier = sns.NewSNSClient(conf.SNSTopic, conf.AWSRegion, conf.SNSMessageFormat, conf.SNSMessageAttributes, conf.SNSKeyLayout)
+	}
+	if conf.NotificationFanOut {
+		return fanOutNotifier{notifier}
+	}
+	return notifier
+}
+
+func newDBClient(conf AppConfig) db.Clienter {
+	primary := db.NewDynamoDBClient(conf.DynamoDbTableName, conf.AWSRegion)
+	if conf.NotificationOutbox {
+		primary = db.NewDynamoDBClientWithOutbox(conf.DynamoDbTableName, conf.AWSRegion)
+	}
+	if conf.SecondaryDynamoDbTableName == "" {
+		return primary
+	}
+
+	region := conf.SecondaryAWSRegion
+	if region == "" {
+		region = conf.AWSRegion
+	}
+	secondary := db.NewDynamoDBClient(conf.SecondaryDynamoDbTableName, region)
+	replicating, err := db.NewReplicatingClient(primary, secondary, conf.ReplicationMode)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to replicate concordances to the secondary DynamoDB table")
+	}
+	return replicating
 }
 
 func (s *ConcordancesRwService) Read(uuid string, transactionId string) (db.ConcordancesModel, error) {
 	model, err := s.ddb.Read(uuid, transactionId)
+	if err != nil {
+		s.counters.inc(&s.counters.errors)
+		return model, err
+	}
+	s.counters.inc(&s.counters.reads)
 	return model, err
 }
 
 func (s *ConcordancesRwService) Write(m db.ConcordancesModel, transactionId string) (status db.Status, err error) {
-	status, err = s.ddb.Write(m, transactionId)
+	status, previous, err := s.ddb.Write(m, transactionId)
 	if err != nil {
+		s.counters.inc(&s.counters.errors)
 		return status, err
 	}
-	err = s.sns.SendMessage(m.UUID, transactionId)
+	s.counters.inc(&s.counters.writes)
+	s.mirrorWrite(m, transactionId)
+	if s.dispatcher != nil {
+		s.dispatcher.Dispatch(m.UUID)
+		return status, nil
+	}
+	if s.publisher != nil {
+		return status, nil
+	}
+
+	event := sns.NewEvent(eventType(status), m.UUID, transactionId, previous.ConcordedIds, m.ConcordedIds)
+	event.Authorities = db.Authorities(previous, m)
+	err = s.notifier.SendMessage(event)
 
 	if err != nil {
+		s.counters.inc(&s.counters.errors)
+		// A change kept as a dead letter will be announced when it is retried, the client must not write it again.
+		if s.keepDeadLetter(event, err) {
+			return status, nil
+		}
 		return db.CONCORDANCE_ERROR, err
 	}
+	s.counters.inc(&s.counters.snsPublishes)
 
 	return status, err
 }
 
 func (s *ConcordancesRwService) Delete(uuid string, transactionId string) (db.Status, error) {
-	status, err := s.ddb.Delete(uuid, transactionId)
+	status, previous, err := s.ddb.Delete(uuid, transactionId)
 
 	if err != nil {
+		s.counters.inc(&s.counters.errors)
 		return status, err
 	}
+	s.counters.inc(&s.counters.deletes)
+	s.mirrorDelete(status, uuid, transactionId)
+	if s.dispatcher != nil {
+		if status == db.CONCORDANCE_DELETED {
+			s.dispatcher.Dispatch(uuid)
+		}
+		return status, nil
+	}
+	if s.publisher != nil {
+		return status, nil
+	}
 
-	err = s.sns.SendMessage(uuid, transactionId)
+	event := sns.NewEvent(sns.EventDeleted, uuid, transactionId, previous.ConcordedIds, nil)
+	event.Authorities = db.Authorities(previous)
+	err = s.notifier.SendMessage(event)
 
 	if err != nil {
+		s.counters.inc(&s.counters.errors)
 		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error sending Concordance to SNS")
+		if s.keepDeadLetter(event, err) {
+			return status, nil
+		}
 		return db.CONCORDANCE_ERROR, err
 	}
+	s.counters.inc(&s.counters.snsPublishes)
 
 	return status, nil
 }
 
+// keepDeadLetter keeps a notification that could not be delivered, so that it can be delivered again from the admin API,
+// telling whether it was kept.
+func (s *ConcordancesRwService) keepDeadLetter(event sns.Event, cause error) bool {
+	if s.deadLetters == nil {
+		return false
+	}
+	letter, err := s.deadLetters.Add(s.tenant, event, cause)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"UUID": event.UUID, "transaction_id": event.TransactionID}).Error("Error keeping undelivered notification as a dead letter")
+		return false
+	}
+	log.WithFields(log.Fields{"UUID": event.UUID, "transaction_id": event.TransactionID, "dead_letter": letter.ID}).Warn("Kept undelivered notification as a dead letter")
+	return true
+}
+
+func eventType(status db.Status) string {
+	switch status {
+	case db.CONCORDANCE_CREATED:
+		return sns.EventCreated
+	case db.CONCORDANCE_DELETED:
+		return sns.EventDeleted
+	}
+	return sns.EventUpdated
+}
+
+func (s *ConcordancesRwService) Stats() ServiceStats {
+	stats := ServiceStats{Counters: s.counters.snapshot()}
+	table, err := s.ddb.Stats()
+	stats.Table = table
+	if err != nil {
+		log.WithError(err).WithField("table", s.DynamoDbTable).Warn("Error describing DynamoDB table")
+		stats.TableError = err.Error()
+	}
+	return stats
+}
+
 func (s *ConcordancesRwService) getDBClient() db.Clienter {
 	return s.ddb
 }
-func (s *ConcordancesRwService) getSNSClient() sns.Clienter {
-	return s.sns
+
+// mirrorWrite copies a written concordance to the mirror, before it is announced. The write has been committed by then,
+// so a failure is logged and counted rather than failing the request. Changes announced from the stream are
+// mirrored by the stream publisher.
+func (s *ConcordancesRwService) mirrorWrite(m db.ConcordancesModel, transactionId string) {
+	if s.publisher != nil {
+		return
+	}
+	if err := s.mirror.write(m); err != nil {
+		s.counters.inc(&s.counters.errors)
+		log.WithError(err).WithFields(log.Fields{"UUID": m.UUID, "transaction_id": transactionId}).Error("Error mirroring Concordance")
+	}
+}
+
+func (s *ConcordancesRwService) mirrorDelete(status db.Status, uuid string, transactionId string) {
+	if s.publisher != nil || status != db.CONCORDANCE_DELETED {
+		return
+	}
+	if err := s.mirror.delete(uuid); err != nil {
+		s.counters.inc(&s.counters.errors)
+		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error deleting mirrored Concordance")
+	}
+}
+
+func (s *ConcordancesRwService) getMirror() Mirror {
+	if s.mirror == nil {
+		return nil
+	}
+	return s.mirror.store
+}
+
+func (s *ConcordancesRwService) getNotifier() Notifier {
+	return s.notifier
 }
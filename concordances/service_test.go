@@ -9,15 +9,16 @@ import (
 
 	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
 	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/Financial-Times/concordances-rw-dynamodb/webhook"
 	"github.com/stretchr/testify/assert"
 )
 
-func createService(ddbClient db.Clienter, snsClient sns.Clienter) ConcordancesRwService {
+func createService(ddbClient db.Clienter, snsClient Notifier) ConcordancesRwService {
 	return ConcordancesRwService{
 		DynamoDbTable: "TestTable",
 		AwsRegion:     "TestRegion",
 		ddb:           ddbClient,
-		sns:           snsClient,
+		notifier:      snsClient,
 	}
 }
 
@@ -48,6 +49,17 @@ func TestServiceRead(t *testing.T) {
 	}
 }
 
+func TestServiceReadExpired(t *testing.T) {
+	mockSNSClient := MockSNSClient{Happy: true}
+	srv := createService(&MockDynamoDBClient{Happy: true, expired: true}, &mockSNSClient)
+
+	m, err := srv.Read(EXPECTED_UUID, "testing_tid_1234")
+
+	assert.NoError(t, err, "Failed on service error.")
+	assert.Equal(t, db.ConcordancesModel{}, m, "Expired concordance was not hidden")
+	assert.False(t, mockSNSClient.Invoked, "Reading an expired concordance should not announce anything")
+}
+
 func TestServiceWrite(t *testing.T) {
 	tests := []struct {
 		testName         string
@@ -92,6 +104,55 @@ func TestServiceWrite(t *testing.T) {
 	}
 }
 
+func TestServiceEvents(t *testing.T) {
+	mockSNSClient := MockSNSClient{Happy: true}
+	srv := createService(&MockDynamoDBClient{Happy: true}, &mockSNSClient)
+
+	srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "testing_tid_1")
+	srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A", "B"}}, "testing_tid_2")
+	srv.Delete(EXPECTED_UUID, "testing_tid_3")
+
+	assert.Len(t, mockSNSClient.events, 3)
+	expected := []struct {
+		eventType     string
+		transactionId string
+		old           []string
+		new           []string
+	}{
+		{sns.EventCreated, "testing_tid_1", []string{}, []string{"A"}},
+		{sns.EventUpdated, "testing_tid_2", []string{"A"}, []string{"A", "B"}},
+		{sns.EventDeleted, "testing_tid_3", []string{"A", "B"}, []string{}},
+	}
+	for i, e := range expected {
+		event := mockSNSClient.events[i]
+		assert.Equal(t, e.eventType, event.Type)
+		assert.Equal(t, EXPECTED_UUID, event.UUID)
+		assert.Equal(t, e.transactionId, event.TransactionID)
+		assert.Equal(t, e.old, event.OldConcordedIds, "Unexpected old concorded UUIDs in %s event", e.eventType)
+		assert.Equal(t, e.new, event.NewConcordedIds, "Unexpected new concorded UUIDs in %s event", e.eventType)
+	}
+}
+
+func TestServiceEventAuthorities(t *testing.T) {
+	mockSNSClient := MockSNSClient{Happy: true}
+	srv := createService(&MockDynamoDBClient{Happy: true}, &mockSNSClient)
+
+	srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A", "B"}, Identifiers: []db.Identifier{
+		{Authority: "TME", IdentifierValue: "tme-1", UUID: "A"},
+		{Authority: "FACTSET", IdentifierValue: "fs-1", UUID: "B"},
+	}}, "testing_tid_1")
+	srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"C"}, Identifiers: []db.Identifier{
+		{Authority: "WIKIDATA", IdentifierValue: "Q1", UUID: "C"},
+	}}, "testing_tid_2")
+	srv.Delete(EXPECTED_UUID, "testing_tid_3")
+	srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "testing_tid_4")
+
+	assert.Equal(t, []string{"TME", "FACTSET"}, mockSNSClient.events[0].Authorities)
+	assert.Equal(t, []string{"TME", "FACTSET", "WIKIDATA"}, mockSNSClient.events[1].Authorities, "Authorities removed by an update should be announced")
+	assert.Equal(t, []string{"WIKIDATA"}, mockSNSClient.events[2].Authorities, "Authorities of a deleted concordance should be announced")
+	assert.Empty(t, mockSNSClient.events[3].Authorities)
+}
+
 func TestServiceDelete(t *testing.T) {
 	tests := []struct {
 		testName         string
@@ -142,10 +203,12 @@ const (
 type MockSNSClient struct {
 	Happy   bool
 	Invoked bool
+	events  []sns.Event
 }
 
-func (c *MockSNSClient) SendMessage(uuid string, transaction_id string) error {
+func (c *MockSNSClient) SendMessage(event sns.Event) error {
 	c.Invoked = true
+	c.events = append(c.events, event)
 	if c.Happy {
 		return nil
 	}
@@ -161,49 +224,65 @@ func (c *MockSNSClient) Healthcheck() (bool, error) {
 }
 
 type MockDynamoDBClient struct {
-	Happy bool
-	model db.ConcordancesModel
+	Happy   bool
+	model   db.ConcordancesModel
+	expired bool
 }
 
 func (ddb *MockDynamoDBClient) Read(uuid string, transaction_id string) (db.ConcordancesModel, error) {
+	// Expired records are hidden until they are purged.
+	if ddb.expired {
+		return db.ConcordancesModel{}, nil
+	}
 	if ddb.Happy {
 		return db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A", "B"}}, nil
 	}
 	return db.ConcordancesModel{}, errors.New(DDB_ERROR)
 }
 
-func (ddb *MockDynamoDBClient) Write(m db.ConcordancesModel, transaction_id string) (db.Status, error) {
+func (ddb *MockDynamoDBClient) Write(m db.ConcordancesModel, transaction_id string) (db.Status, db.ConcordancesModel, error) {
 	if !ddb.Happy {
-		return db.CONCORDANCE_ERROR, errors.New(DDB_ERROR)
+		return db.CONCORDANCE_ERROR, db.ConcordancesModel{}, errors.New(DDB_ERROR)
 	}
 
-	if ddb.model.UUID == "" {
-		ddb.model = m
-		return db.CONCORDANCE_CREATED, nil
-	}
+	previous := ddb.model
 	ddb.model = m
-	return db.CONCORDANCE_UPDATED, nil
+	if previous.UUID == "" {
+		return db.CONCORDANCE_CREATED, previous, nil
+	}
+	return db.CONCORDANCE_UPDATED, previous, nil
 }
 
-func (ddb *MockDynamoDBClient) Delete(uuid string, transaction_id string) (db.Status, error) {
+func (ddb *MockDynamoDBClient) Delete(uuid string, transaction_id string) (db.Status, db.ConcordancesModel, error) {
 	if !ddb.Happy {
-		return db.CONCORDANCE_ERROR, errors.New(DDB_ERROR)
+		return db.CONCORDANCE_ERROR, db.ConcordancesModel{}, errors.New(DDB_ERROR)
 	}
-	if ddb.model.UUID == "" {
-		return db.CONCORDANCE_NOT_FOUND, nil
+	previous := ddb.model
+	ddb.model = db.ConcordancesModel{}
+	if previous.UUID == "" {
+		return db.CONCORDANCE_NOT_FOUND, previous, nil
 	}
-	return db.CONCORDANCE_DELETED, nil
+	return db.CONCORDANCE_DELETED, previous, nil
 }
 
 func (ddb *MockDynamoDBClient) Healthcheck() error {
 	return nil
 }
 
+func (ddb *MockDynamoDBClient) Stats() (db.TableStats, error) {
+	if ddb.Happy {
+		return db.TableStats{Name: "TestTable", Status: "ACTIVE", ItemCount: 1}, nil
+	}
+	return db.TableStats{Name: "TestTable"}, errors.New(DDB_ERROR)
+}
+
 type MockService struct {
-	model  db.ConcordancesModel
-	status db.Status
-	count  int64
-	err    error
+	model   db.ConcordancesModel
+	written db.ConcordancesModel
+	deleted string
+	status  db.Status
+	count   int64
+	err     error
 }
 
 func (mock *MockService) Read(uuid string, transaction_id string) (db.ConcordancesModel, error) {
@@ -211,6 +290,7 @@ func (mock *MockService) Read(uuid string, transaction_id string) (db.Concordanc
 }
 
 func (mock *MockService) Write(m db.ConcordancesModel, transaction_id string) (db.Status, error) {
+	mock.written = m
 	if mock.status == 0 {
 		return db.CONCORDANCE_CREATED, mock.err
 	}
@@ -218,12 +298,21 @@ func (mock *MockService) Write(m db.ConcordancesModel, transaction_id string) (d
 }
 
 func (mock *MockService) Delete(uuid string, transaction_id string) (db.Status, error) {
+	mock.deleted = uuid
 	if mock.status == 0 {
 		return db.CONCORDANCE_DELETED, mock.err
 	}
 	return mock.status, mock.err
 }
 
+func (mock *MockService) Stats() ServiceStats {
+	stats := ServiceStats{Table: db.TableStats{Name: "TestTable"}}
+	if mock.err != nil {
+		stats.TableError = mock.err.Error()
+	}
+	return stats
+}
+
 func (mock *MockService) getDBClient() db.Clienter {
 	if mock.err != nil {
 		return &MockDynamoDBClient{Happy: false}
@@ -231,9 +320,14 @@ func (mock *MockService) getDBClient() db.Clienter {
 	return &MockDynamoDBClient{Happy: true}
 }
 
-func (mock *MockService) getSNSClient() sns.Clienter {
+func (mock *MockService) getNotifier() Notifier {
 	if mock.err != nil {
 		return &MockSNSClient{Happy: false}
 	}
 	return &MockSNSClient{Happy: true}
 }
+
+func TestNewNotifier(t *testing.T) {
+	assert.IsType(t, &sns.Client{}, newNotifier(AppConfig{SNSTopic: "topic", AWSRegion: "eu-west-1"}))
+	assert.IsType(t, &webhook.Client{}, newNotifier(AppConfig{Notifier: NotifierWebhook, Webhook: webhook.Config{URL: "http://localhost:8080/events"}}))
+}
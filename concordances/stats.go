@@ -0,0 +1,70 @@
+package concordances
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+)
+
+const statsPath = "/__stats"
+
+var startedAt = time.Now()
+
+// counters counts the operations of a service since it started.
+type counters struct {
+	reads        int64
+	writes       int64
+	deletes      int64
+	snsPublishes int64
+	suppressed   int64
+	errors       int64
+}
+
+func (c *counters) inc(counter *int64) {
+	atomic.AddInt64(counter, 1)
+}
+
+func (c *counters) snapshot() Counters {
+	return Counters{
+		Reads:        atomic.LoadInt64(&c.reads),
+		Writes:       atomic.LoadInt64(&c.writes),
+		Deletes:      atomic.LoadInt64(&c.deletes),
+		SNSPublishes: atomic.LoadInt64(&c.snsPublishes),
+		Suppressed:   atomic.LoadInt64(&c.suppressed),
+		Errors:       atomic.LoadInt64(&c.errors),
+	}
+}
+
+type Counters struct {
+	Reads        int64 `json:"reads"`
+	Writes       int64 `json:"writes"`
+	Deletes      int64 `json:"deletes"`
+	SNSPublishes int64 `json:"snsPublishes"`
+	Suppressed   int64 `json:"suppressed"`
+	Errors       int64 `json:"errors"`
+}
+
+type ServiceStats struct {
+	Table      db.TableStats `json:"table"`
+	TableError string        `json:"tableError,omitempty"`
+	Counters   Counters      `json:"counters"`
+}
+
+type statsResponse struct {
+	StartedAt time.Time               `json:"startedAt"`
+	Tenants   map[string]ServiceStats `json:"tenants"`
+}
+
+func (h *Handler) HandleStats(rw http.ResponseWriter, r *http.Request) {
+	stats := statsResponse{StartedAt: startedAt, Tenants: map[string]ServiceStats{DefaultTenant: h.srv.Stats()}}
+	for name, srv := range h.tenants {
+		stats.Tenants[name] = srv.Stats()
+	}
+
+	rw.Header().Set("Content-Type", ContentTypeJson)
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(&stats)
+}
@@ -0,0 +1,53 @@
+package concordances
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_StatsCountOperations(t *testing.T) {
+	srv := createService(&MockDynamoDBClient{Happy: true}, &MockSNSClient{Happy: true})
+
+	srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "testing_tid_1234")
+	srv.Read(EXPECTED_UUID, "testing_tid_1234")
+	srv.Read(EXPECTED_UUID, "testing_tid_1234")
+	srv.Delete(EXPECTED_UUID, "testing_tid_1234")
+	srv.notifier = &MockSNSClient{Happy: false}
+	srv.Delete(EXPECTED_UUID, "testing_tid_1234")
+
+	stats := srv.Stats()
+	assert.Equal(t, Counters{Reads: 2, Writes: 1, Deletes: 2, SNSPublishes: 2, Errors: 1}, stats.Counters)
+	assert.Equal(t, "ACTIVE", stats.Table.Status)
+	assert.Empty(t, stats.TableError)
+}
+
+func TestService_StatsReportTableError(t *testing.T) {
+	srv := createService(&MockDynamoDBClient{Happy: false}, &MockSNSClient{Happy: true})
+
+	srv.Read(EXPECTED_UUID, "testing_tid_1234")
+
+	stats := srv.Stats()
+	assert.Equal(t, DDB_ERROR, stats.TableError)
+	assert.Equal(t, int64(1), stats.Counters.Errors)
+}
+
+func TestHandler_Stats(t *testing.T) {
+	router := mux.NewRouter()
+	NewHandler(router, AppConfig{}, &MockService{}, map[string]Service{"factset": &MockService{}})
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, newRequest("GET", statsPath, ""))
+
+	assert.Equal(t, 200, rec.Result().StatusCode, "Response code incorrect.")
+	assert.Equal(t, ContentTypeJson, rec.HeaderMap["Content-Type"][0], "Incorrect Content-Type Header")
+	stats := statsResponse{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&stats))
+	assert.Equal(t, startedAt.Unix(), stats.StartedAt.Unix())
+	assert.Len(t, stats.Tenants, 2, "Expected stats of the default service and every tenant")
+	assert.Equal(t, "TestTable", stats.Tenants["factset"].Table.Name)
+}
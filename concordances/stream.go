@@ -0,0 +1,167 @@
+package concordances
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// NotificationSourceRequest announces the changes made by the requests to the service,
+	// NotificationSourceStream every change of the table, read from its DynamoDB Stream.
+	NotificationSourceRequest = "request"
+	NotificationSourceStream  = "stream"
+
+	DefaultStreamPollInterval = time.Second
+
+	streamMaxAttempts = 3
+)
+
+// StreamPublisher announces the changes read from the DynamoDB Stream of a table, including those made directly
+// to the table. A change that cannot be announced is retried a few times and then kept as a dead letter, or read
+// again by the next poll when there is no dead-letter store.
+type StreamPublisher struct {
+	reader      *db.StreamReader
+	notifier    Notifier
+	counters    *counters
+	deadLetters *DeadLetterStore
+	mirror      *documentMirror
+	tenant      string
+	retryDelay  time.Duration
+}
+
+func NewStreamPublisher(reader *db.StreamReader, notifier Notifier, counters *counters) *StreamPublisher {
+	return &StreamPublisher{reader: reader, notifier: notifier, counters: counters, tenant: DefaultTenant, retryDelay: time.Second}
+}
+
+// newStreamReader reads the stream of the table of a service, checkpointing in a file of the checkpoint directory, if any.
+func newStreamReader(conf AppConfig) (*db.StreamReader, error) {
+	streamArn := conf.StreamArn
+	if streamArn == "" {
+		var err error
+		if streamArn, err = db.LatestStreamArn(conf.DynamoDbTableName, conf.AWSRegion); err != nil {
+			return nil, err
+		}
+	}
+	path := ""
+	if conf.StreamCheckpointDir != "" {
+		tenant := conf.tenant
+		if tenant == "" {
+			tenant = DefaultTenant
+		}
+		path = filepath.Join(conf.StreamCheckpointDir, fmt.Sprintf("stream-%s.json", tenant))
+	}
+	checkpoints, err := db.NewFileCheckpoints(path)
+	if err != nil {
+		return nil, err
+	}
+	return db.NewStreamReader(streamArn, conf.AWSRegion, checkpoints, conf.StreamStartPosition), nil
+}
+
+// Start polls the stream in the background at the given interval.
+func (p *StreamPublisher) Start(pollInterval time.Duration) {
+	if pollInterval <= 0 {
+		pollInterval = DefaultStreamPollInterval
+	}
+	go func() {
+		for range time.Tick(pollInterval) {
+			p.Poll()
+		}
+	}()
+}
+
+// Poll announces the changes made since the last poll.
+func (p *StreamPublisher) Poll() error {
+	err := p.reader.Poll(p.publish)
+	if err != nil {
+		p.counters.inc(&p.counters.errors)
+		log.WithError(err).WithField("tenant", p.tenant).Error("Error publishing the changes of the DynamoDB stream")
+	}
+	return err
+}
+
+func (p *StreamPublisher) publish(change db.StreamChange) error {
+	event := streamEvent(change)
+	logEntry := log.WithFields(log.Fields{"UUID": event.UUID, "transaction_id": event.TransactionID, "tenant": p.tenant})
+
+	// A change that cannot be mirrored is read again by the next poll, so that it is never announced before it can be fetched.
+	if err := p.mirrorChange(change); err != nil {
+		p.counters.inc(&p.counters.errors)
+		logEntry.WithError(err).Error("Error mirroring Concordance change read from the DynamoDB stream")
+		return err
+	}
+
+	var err error
+	for attempt := 1; attempt <= streamMaxAttempts; attempt++ {
+		if err = p.notifier.SendMessage(event); err == nil {
+			p.counters.inc(&p.counters.snsPublishes)
+			return nil
+		}
+		p.counters.inc(&p.counters.errors)
+		logEntry.WithError(err).WithField("attempts", attempt).Warn("Error notifying Concordance change read from the DynamoDB stream")
+		if attempt < streamMaxAttempts {
+			time.Sleep(p.retryDelay * time.Duration(attempt))
+		}
+	}
+
+	if p.deadLetters == nil {
+		return err
+	}
+	letter, keepErr := p.deadLetters.Add(p.tenant, event, err)
+	if keepErr != nil {
+		logEntry.WithError(keepErr).Error("Error keeping undelivered notification as a dead letter")
+		return err
+	}
+	logEntry.WithField("dead_letter", letter.ID).Warn("Kept undelivered notification as a dead letter")
+	return nil
+}
+
+func (p *StreamPublisher) mirrorChange(change db.StreamChange) error {
+	if change.New == nil {
+		return p.mirror.delete(change.UUID)
+	}
+	return p.mirror.write(*change.New)
+}
+
+// streamEvent announces a change read from the stream with the transaction id of the request that made it, stamped on
+// the record by the write. Changes that did not stamp a new transaction id, i.e. made outside of the service, removals
+// and expiries purged by DynamoDB, have a transaction id derived from the position of the change in the stream instead,
+// which is the same every time it is read.
+func streamEvent(change db.StreamChange) sns.Event {
+	eventType := sns.EventUpdated
+	switch change.EventName {
+	case db.StreamInsert:
+		eventType = sns.EventCreated
+	case db.StreamRemove:
+		eventType = sns.EventDeleted
+	}
+
+	var oldIds, newIds []string
+	models := []db.ConcordancesModel{}
+	if change.Old != nil {
+		oldIds = change.Old.ConcordedIds
+		models = append(models, *change.Old)
+	}
+	if change.New != nil {
+		newIds = change.New.ConcordedIds
+		models = append(models, *change.New)
+	}
+
+	event := sns.NewEvent(eventType, change.UUID, streamTransactionID(change), oldIds, newIds)
+	if !change.Timestamp.IsZero() {
+		event.Timestamp = change.Timestamp
+	}
+	event.Authorities = db.Authorities(models...)
+	return event
+}
+
+func streamTransactionID(change db.StreamChange) string {
+	if change.New != nil && change.New.TransactionID != "" && (change.Old == nil || change.Old.TransactionID != change.New.TransactionID) {
+		return change.New.TransactionID
+	}
+	return "tid_stream_" + change.SequenceNumber
+}
@@ -0,0 +1,134 @@
+package concordances
+
+import (
+	"testing"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/internal/testutil"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testStreamArn = "arn:aws:dynamodb:eu-west-1:027104099916:table/concordances/stream/2017-11-01T00:00:00.000"
+	testShard     = "shardId-00000001-000000000000000000000a"
+)
+
+func newTestStreamPublisher(t *testing.T, streams *testutil.FakeStreams, notifier Notifier) (*StreamPublisher, *ConcordancesRwService) {
+	checkpoints, err := db.NewFileCheckpoints("")
+	assert.NoError(t, err)
+	srv := createService(&MockDynamoDBClient{Happy: true}, notifier)
+	reader := db.NewStreamReaderWithClient(streams, testStreamArn, checkpoints, db.StreamStartTrimHorizon)
+	publisher := NewStreamPublisher(reader, notifier, &srv.counters)
+	publisher.retryDelay = 0
+	srv.publisher = publisher
+	return publisher, &srv
+}
+
+func streamConcordance(ids ...string) *db.ConcordancesModel {
+	m := &db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: ids}
+	for _, id := range ids {
+		m.Identifiers = append(m.Identifiers, db.Identifier{Authority: "TME", IdentifierValue: id, UUID: id})
+	}
+	return m
+}
+
+func TestStreamPublisher_AnnouncesChanges(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(testShard, "")
+	created := streams.Put(testShard, nil, streamConcordance("A"))
+	streams.Put(testShard, streamConcordance("A"), streamConcordance("A", "B"))
+	streams.Put(testShard, streamConcordance("A", "B"), nil)
+	snsClient := &MockSNSClient{Happy: true}
+	publisher, srv := newTestStreamPublisher(t, streams, snsClient)
+
+	assert.NoError(t, publisher.Poll())
+	assert.Len(t, snsClient.events, 3)
+
+	assert.Equal(t, sns.EventCreated, snsClient.events[0].Type)
+	assert.Equal(t, EXPECTED_UUID, snsClient.events[0].UUID)
+	assert.Equal(t, "tid_stream_"+created, snsClient.events[0].TransactionID, "Transaction id should be the same every time the change is read")
+	assert.Empty(t, snsClient.events[0].OldConcordedIds)
+	assert.Equal(t, []string{"A"}, snsClient.events[0].NewConcordedIds)
+	assert.Equal(t, []string{"TME"}, snsClient.events[0].Authorities)
+
+	assert.Equal(t, sns.EventUpdated, snsClient.events[1].Type)
+	assert.Equal(t, []string{"A"}, snsClient.events[1].OldConcordedIds)
+	assert.Equal(t, []string{"A", "B"}, snsClient.events[1].NewConcordedIds)
+
+	assert.Equal(t, sns.EventDeleted, snsClient.events[2].Type)
+	assert.Equal(t, []string{"A", "B"}, snsClient.events[2].OldConcordedIds)
+	assert.Empty(t, snsClient.events[2].NewConcordedIds)
+	assert.Equal(t, int64(3), srv.Stats().Counters.SNSPublishes)
+
+	assert.NoError(t, publisher.Poll())
+	assert.Len(t, snsClient.events, 3, "Changes should only be announced once")
+}
+
+func TestStreamPublisher_TransactionIdOfTheWrite(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(testShard, "")
+	written := streamConcordance("A")
+	written.TransactionID = "tid_1"
+	streams.Put(testShard, nil, written)
+	// A change made outside of the service leaves the transaction id of the last write on the record.
+	outside := streamConcordance("A", "B")
+	outside.TransactionID = "tid_1"
+	outsideChange := streams.Put(testShard, written, outside)
+	snsClient := &MockSNSClient{Happy: true}
+	publisher, _ := newTestStreamPublisher(t, streams, snsClient)
+
+	assert.NoError(t, publisher.Poll())
+	assert.Len(t, snsClient.events, 2)
+	assert.Equal(t, "tid_1", snsClient.events[0].TransactionID, "Change should be announced with the transaction id of its request")
+	assert.Equal(t, "tid_stream_"+outsideChange, snsClient.events[1].TransactionID, "Change made outside of the service should not reuse the transaction id of another")
+}
+
+func TestStreamPublisher_ReadsChangeAgainWithoutDeadLetters(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(testShard, "")
+	streams.Put(testShard, nil, streamConcordance("A"))
+	snsClient := &MockSNSClient{Happy: false}
+	publisher, _ := newTestStreamPublisher(t, streams, snsClient)
+
+	assert.Error(t, publisher.Poll())
+	assert.Len(t, snsClient.events, streamMaxAttempts, "Notification should be retried")
+
+	snsClient.Happy = true
+	snsClient.events = nil
+	assert.NoError(t, publisher.Poll())
+	assert.Len(t, snsClient.events, 1, "Undelivered change should be read again")
+}
+
+func TestStreamPublisher_KeepsDeadLetter(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(testShard, "")
+	streams.Put(testShard, nil, streamConcordance("A"))
+	streams.Put(testShard, streamConcordance("A"), streamConcordance("A", "B"))
+	snsClient := &FailingSNSClient{MockSNSClient: MockSNSClient{Happy: true}, failAfter: 0}
+	publisher, _ := newTestStreamPublisher(t, streams, snsClient)
+	deadLetters, err := NewDeadLetterStore("")
+	assert.NoError(t, err)
+	publisher.deadLetters = deadLetters
+
+	assert.NoError(t, publisher.Poll(), "Undelivered changes should not stop the stream")
+	letters := deadLetters.List()
+	assert.Len(t, letters, 2)
+	assert.Equal(t, DefaultTenant, letters[0].Tenant)
+	assert.Equal(t, sns.EventCreated, letters[0].Event.Type)
+}
+
+func TestStreamPublisher_ServiceDoesNotNotify(t *testing.T) {
+	snsClient := &MockSNSClient{Happy: true}
+	_, srv := newTestStreamPublisher(t, testutil.NewFakeStreams(), snsClient)
+
+	status, err := srv.Write(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "tid_1")
+	assert.NoError(t, err)
+	assert.Equal(t, db.CONCORDANCE_CREATED, status)
+	_, err = srv.Delete(EXPECTED_UUID, "tid_2")
+	assert.NoError(t, err)
+	assert.False(t, snsClient.Invoked, "Changes should only be announced from the stream")
+
+	_, err = srv.WriteSuppressed(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "tid_3")
+	assert.Equal(t, errSuppressionUnsupported, err)
+}
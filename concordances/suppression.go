@@ -0,0 +1,108 @@
+package concordances
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	SuppressNotificationHeader = "X-Suppress-Notification"
+	SuppressionKeyHeader       = "X-Suppression-Key"
+)
+
+var errSuppressionUnsupported = problemError{http.StatusBadRequest, CodeSuppressionUnsupported, "Notification suppression is not supported by the service"}
+
+// NotificationSuppressor is implemented by services that can change records without notifying downstream services,
+// e.g. during bulk backfills.
+type NotificationSuppressor interface {
+	WriteSuppressed(m db.ConcordancesModel, transactionId string) (db.Status, error)
+	DeleteSuppressed(uuid string, transactionId string) (db.Status, error)
+}
+
+func (s *ConcordancesRwService) WriteSuppressed(m db.ConcordancesModel, transactionId string) (db.Status, error) {
+	// Changes recorded in the outbox or read from the stream are always announced.
+	if s.dispatcher != nil || s.publisher != nil {
+		return db.CONCORDANCE_ERROR, errSuppressionUnsupported
+	}
+	status, _, err := s.ddb.Write(m, transactionId)
+	if err != nil {
+		s.counters.inc(&s.counters.errors)
+		return status, err
+	}
+	s.counters.inc(&s.counters.writes)
+	s.mirrorWrite(m, transactionId)
+	s.suppressed(m.UUID, transactionId)
+	return status, nil
+}
+
+func (s *ConcordancesRwService) DeleteSuppressed(uuid string, transactionId string) (db.Status, error) {
+	if s.dispatcher != nil || s.publisher != nil {
+		return db.CONCORDANCE_ERROR, errSuppressionUnsupported
+	}
+	status, _, err := s.ddb.Delete(uuid, transactionId)
+	if err != nil {
+		s.counters.inc(&s.counters.errors)
+		return status, err
+	}
+	s.counters.inc(&s.counters.deletes)
+	s.mirrorDelete(status, uuid, transactionId)
+	if status == db.CONCORDANCE_DELETED {
+		s.suppressed(uuid, transactionId)
+	}
+	return status, nil
+}
+
+func (s *ConcordancesRwService) suppressed(uuid string, transactionId string) {
+	s.counters.inc(&s.counters.suppressed)
+	log.WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId, "tenant": s.tenant}).Info("Suppressed notification of Concordance change")
+}
+
+// suppressNotification reports whether a request asks for its change not to be announced, and whether it may,
+// with the problem to respond with when it may not. Suppression is only allowed when a suppression key is
+// configured and the request carries it.
+func (h *Handler) suppressNotification(r *http.Request) (bool, error) {
+	header := r.Header.Get(SuppressNotificationHeader)
+	if header == "" {
+		return false, nil
+	}
+	suppress, err := strconv.ParseBool(header)
+	if err != nil {
+		return false, problemError{http.StatusBadRequest, CodeInvalidHeader, fmt.Sprintf("Invalid %s header (%s)", SuppressNotificationHeader, header)}
+	}
+	if !suppress {
+		return false, nil
+	}
+	if h.conf.SuppressionKey == "" {
+		return false, problemError{http.StatusForbidden, CodeSuppressionForbidden, "Notification suppression is not enabled"}
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(SuppressionKeyHeader)), []byte(h.conf.SuppressionKey)) != 1 {
+		return false, problemError{http.StatusForbidden, CodeSuppressionForbidden, "Not authorised to suppress notifications"}
+	}
+	return true, nil
+}
+
+func writeSuppressed(srv Service, m db.ConcordancesModel, transactionId string) (db.Status, error) {
+	suppressor, ok := srv.(NotificationSuppressor)
+	if !ok {
+		return db.CONCORDANCE_ERROR, errSuppressionUnsupported
+	}
+	return suppressor.WriteSuppressed(m, transactionId)
+}
+
+func deleteSuppressed(srv Service, uuid string, transactionId string) (db.Status, error) {
+	suppressor, ok := srv.(NotificationSuppressor)
+	if !ok {
+		return db.CONCORDANCE_ERROR, errSuppressionUnsupported
+	}
+	return suppressor.DeleteSuppressed(uuid, transactionId)
+}
+
+func tenantSuppressed(tenant string, method string) metrics.Counter {
+	return metrics.GetOrRegisterCounter(fmt.Sprintf("tenants.%s.%s.suppressed", tenant, method), metrics.DefaultRegistry)
+}
@@ -0,0 +1,104 @@
+package concordances
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceSuppressed(t *testing.T) {
+	snsClient := &MockSNSClient{Happy: true}
+	srv := createService(&MockDynamoDBClient{Happy: true}, snsClient)
+
+	status, err := srv.WriteSuppressed(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "tid_backfill")
+	assert.NoError(t, err)
+	assert.Equal(t, db.CONCORDANCE_CREATED, status)
+	status, err = srv.DeleteSuppressed(EXPECTED_UUID, "tid_backfill")
+	assert.NoError(t, err)
+	assert.Equal(t, db.CONCORDANCE_DELETED, status)
+	status, err = srv.DeleteSuppressed(EXPECTED_UUID, "tid_backfill")
+	assert.NoError(t, err)
+	assert.Equal(t, db.CONCORDANCE_NOT_FOUND, status)
+
+	assert.False(t, snsClient.Invoked, "Suppressed changes should not be notified")
+	counters := srv.counters.snapshot()
+	assert.Equal(t, int64(2), counters.Suppressed, "Only changes that happened should be counted as suppressed")
+	assert.Equal(t, int64(1), counters.Writes)
+	assert.Equal(t, int64(2), counters.Deletes)
+}
+
+func TestServiceSuppressed_Outbox(t *testing.T) {
+	srv := createService(&MockDynamoDBClient{Happy: true}, &MockSNSClient{Happy: true})
+	srv.dispatcher = NewDispatcher(&MockOutbox{}, srv.notifier, &srv.counters)
+
+	_, err := srv.WriteSuppressed(db.ConcordancesModel{UUID: EXPECTED_UUID, ConcordedIds: []string{"A"}}, "tid_backfill")
+	assert.Equal(t, errSuppressionUnsupported, err, "Changes recorded in the outbox should not be suppressed")
+	_, err = srv.DeleteSuppressed(EXPECTED_UUID, "tid_backfill")
+	assert.Equal(t, errSuppressionUnsupported, err)
+}
+
+func TestHandler_SuppressNotification(t *testing.T) {
+	snsClient := &MockSNSClient{Happy: true}
+	srv := createService(&MockDynamoDBClient{Happy: true}, snsClient)
+	router := mux.NewRouter()
+	NewHandler(router, AppConfig{SuppressionKey: "secret"}, &srv, map[string]Service{"factset": &MockService{}})
+	// The tenant metrics are registered globally, so they are reset for the test to be repeatable.
+	tenantSuppressed(DefaultTenant, "PUT").Clear()
+
+	testCases := []struct {
+		description    string
+		method         string
+		path           string
+		suppress       string
+		key            string
+		expectedStatus int
+	}{
+		{"Invalid header", "PUT", Path, "maybe", "secret", 400},
+		{"Missing key", "PUT", Path, "true", "", 403},
+		{"Wrong key", "DELETE", Path, "true", "guess", 403},
+		{"Not supported by tenant", "PUT", "/factset" + Path, "true", "secret", 400},
+		{"Suppressed write", "PUT", Path, "true", "secret", 201},
+		{"Suppressed delete", "DELETE", Path, "true", "secret", 204},
+		{"Not suppressed", "PUT", Path, "false", "", 201},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			body := ""
+			if testCase.method == "PUT" {
+				body = GoodBody
+			}
+			req := newRequest(testCase.method, testCase.path, body)
+			req.Header.Set(SuppressNotificationHeader, testCase.suppress)
+			if testCase.key != "" {
+				req.Header.Set(SuppressionKeyHeader, testCase.key)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, testCase.expectedStatus, rec.Result().StatusCode, "Response code incorrect.")
+		})
+	}
+
+	assert.Len(t, snsClient.events, 1, "Only the change that was not suppressed should be notified")
+	assert.Equal(t, int64(2), srv.counters.snapshot().Suppressed)
+	assert.Equal(t, int64(1), tenantSuppressed(DefaultTenant, "PUT").Count())
+}
+
+func TestHandler_SuppressNotificationDisabled(t *testing.T) {
+	router := mux.NewRouter()
+	NewHandler(router, AppConfig{}, &MockService{}, nil)
+
+	req := newRequest("PUT", Path, GoodBody)
+	req.Header.Set(SuppressNotificationHeader, "true")
+	req.Header.Set(SuppressionKeyHeader, "")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, 403, rec.Result().StatusCode, "Suppression should be refused when no key is configured")
+	problem := decodeProblem(t, rec)
+	assert.Equal(t, CodeSuppressionForbidden, problem.Code)
+	assert.Equal(t, "Notification suppression is not enabled", problem.Detail)
+}
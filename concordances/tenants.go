@@ -0,0 +1,148 @@
+package concordances
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/gorilla/mux"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	TenantHeader  = "X-Concordances-Tenant"
+	Tenant_Param  = "tenant"
+	DefaultTenant = "default"
+)
+
+var tenantNameRegex = regexp.MustCompile("^[a-z0-9][a-z0-9-]*$")
+
+// TenantConfig describes an authority or namespace whose concordances live in their own table
+// and are announced on their own SNS topic.
+type TenantConfig struct {
+	Name                       string         `json:"name"`
+	DynamoDbTableName          string         `json:"dynamoDbTableName"`
+	SecondaryDynamoDbTableName string         `json:"secondaryDynamoDbTableName,omitempty"`
+	SNSTopic                   string         `json:"snsTopicArn"`
+	SNSMessageFormat           string         `json:"snsMessageFormat,omitempty"`
+	SNSKeyLayout               *sns.KeyLayout `json:"snsKeyLayout,omitempty"`
+	WebhookURL                 string         `json:"webhookUrl,omitempty"`
+	MirrorBucket               string         `json:"mirrorBucket,omitempty"`
+	StreamArn                  string         `json:"streamArn,omitempty"`
+}
+
+// ParseTenants reads the tenants configuration, a JSON array of tenant objects, e.g.
+// [{"name":"factset","dynamoDbTableName":"upp-concordance-store-factset","snsTopicArn":"arn:aws:sns:..."}]
+func ParseTenants(tenants string) ([]TenantConfig, error) {
+	if strings.TrimSpace(tenants) == "" {
+		return nil, nil
+	}
+
+	var configs []TenantConfig
+	if err := json.Unmarshal([]byte(tenants), &configs); err != nil {
+		return nil, fmt.Errorf("tenants configuration is not valid JSON: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, c := range configs {
+		if !tenantNameRegex.MatchString(c.Name) {
+			return nil, fmt.Errorf("tenant name (%s) must be lowercase alphanumeric or dashes", c.Name)
+		}
+		if c.Name == DefaultTenant {
+			return nil, fmt.Errorf("tenant name (%s) is reserved", c.Name)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("tenant (%s) is configured more than once", c.Name)
+		}
+		if c.DynamoDbTableName == "" {
+			return nil, fmt.Errorf("tenant (%s) has no DynamoDB table", c.Name)
+		}
+		if c.SNSMessageFormat != "" {
+			if err := sns.ValidateMessageFormat(c.SNSMessageFormat); err != nil {
+				return nil, fmt.Errorf("tenant (%s) has an invalid SNS message format: %v", c.Name, err)
+			}
+		}
+		if c.SNSKeyLayout != nil {
+			if err := c.SNSKeyLayout.Validate(); err != nil {
+				return nil, fmt.Errorf("tenant (%s) has an invalid SNS key layout: %v", c.Name, err)
+			}
+		}
+		seen[c.Name] = true
+	}
+	return configs, nil
+}
+
+// NewTenantServices creates a service per configured tenant. Tenants without their own SNS topic, message format, key layout, webhook URL or mirror bucket
+// notify like the default service, tenants are only replicated when they name their own secondary table, and tenants
+// without their own stream ARN read the latest stream of their table.
+func NewTenantServices(conf AppConfig) map[string]Service {
+	services := map[string]Service{}
+	for _, t := range conf.Tenants {
+		tenantConf := conf
+		tenantConf.DynamoDbTableName = t.DynamoDbTableName
+		tenantConf.SecondaryDynamoDbTableName = t.SecondaryDynamoDbTableName
+		tenantConf.StreamArn = t.StreamArn
+		tenantConf.tenant = t.Name
+		if t.SNSTopic != "" {
+			tenantConf.SNSTopic = t.SNSTopic
+		}
+		if t.SNSMessageFormat != "" {
+			tenantConf.SNSMessageFormat = t.SNSMessageFormat
+		}
+		if t.SNSKeyLayout != nil {
+			tenantConf.SNSKeyLayout = *t.SNSKeyLayout
+		}
+		if t.WebhookURL != "" {
+			tenantConf.Webhook.URL = t.WebhookURL
+		}
+		if t.MirrorBucket != "" {
+			tenantConf.MirrorBucket = t.MirrorBucket
+		}
+		services[t.Name] = NewConcordancesRwService(tenantConf)
+	}
+	return services
+}
+
+func tenantNames(tenants map[string]Service) []string {
+	names := make([]string, 0, len(tenants))
+	for name := range tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveService picks the service for the tenant named in the path prefix or, failing that, in the tenant header.
+// Requests naming neither are served by the default service.
+func (h *Handler) resolveService(r *http.Request) (string, Service, error) {
+	name := mux.Vars(r)[Tenant_Param]
+	if name == "" {
+		name = r.Header.Get(TenantHeader)
+	}
+	return lookupTenant(h.srv, h.tenants, name)
+}
+
+// lookupTenant returns the service of the named tenant, the default service when no tenant is named.
+func lookupTenant(srv Service, tenants map[string]Service, name string) (string, Service, error) {
+	if name == "" || name == DefaultTenant {
+		return DefaultTenant, srv, nil
+	}
+
+	tenantSrv, found := tenants[name]
+	if !found {
+		return name, nil, problemError{http.StatusBadRequest, CodeUnknownTenant, fmt.Sprintf("Unknown tenant (%s)", name)}
+	}
+	return name, tenantSrv, nil
+}
+
+func tenantTimer(tenant string, method string) metrics.Timer {
+	return metrics.GetOrRegisterTimer(fmt.Sprintf("tenants.%s.%s", tenant, method), metrics.DefaultRegistry)
+}
+
+func tenantErrors(tenant string, method string) metrics.Counter {
+	return metrics.GetOrRegisterCounter(fmt.Sprintf("tenants.%s.%s.errors", tenant, method), metrics.DefaultRegistry)
+}
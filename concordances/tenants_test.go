@@ -0,0 +1,113 @@
+package concordances
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTenants(t *testing.T) {
+	tenants, err := ParseTenants(`[{"name":"factset","dynamoDbTableName":"factset-table","snsTopicArn":"arn:aws:sns:eu-west-1:123:factset","snsMessageFormat":"v1"},{"name":"wikidata","dynamoDbTableName":"wikidata-table"}]`)
+
+	assert.NoError(t, err, "Valid tenants configuration was rejected")
+	assert.Equal(t, []TenantConfig{
+		{Name: "factset", DynamoDbTableName: "factset-table", SNSTopic: "arn:aws:sns:eu-west-1:123:factset", SNSMessageFormat: "v1"},
+		{Name: "wikidata", DynamoDbTableName: "wikidata-table"},
+	}, tenants)
+}
+
+func TestParseTenants_KeyLayout(t *testing.T) {
+	tenants, err := ParseTenants(`[{"name":"factset","dynamoDbTableName":"factset-table","snsKeyLayout":{"prefix":"factset/","separator":"-","suffix":".json","shardChars":2}}]`)
+
+	assert.NoError(t, err, "Valid tenants configuration was rejected")
+	assert.Equal(t, &sns.KeyLayout{Prefix: "factset/", Separator: "-", Suffix: ".json", ShardChars: 2}, tenants[0].SNSKeyLayout)
+}
+
+func TestParseTenants_Empty(t *testing.T) {
+	tenants, err := ParseTenants("")
+
+	assert.NoError(t, err, "Empty tenants configuration was rejected")
+	assert.Empty(t, tenants)
+}
+
+func TestParseTenants_Invalid(t *testing.T) {
+	invalidConfigs := map[string]string{
+		"Invalid JSON":       `[{"name":"factset"`,
+		"Missing name":       `[{"dynamoDbTableName":"factset-table"}]`,
+		"Uppercase name":     `[{"name":"FACTSET","dynamoDbTableName":"factset-table"}]`,
+		"Reserved name":      `[{"name":"default","dynamoDbTableName":"factset-table"}]`,
+		"Duplicate name":     `[{"name":"factset","dynamoDbTableName":"a"},{"name":"factset","dynamoDbTableName":"b"}]`,
+		"Missing table":      `[{"name":"factset"}]`,
+		"Unknown format":     `[{"name":"factset","dynamoDbTableName":"factset-table","snsMessageFormat":"v2"}]`,
+		"Invalid key layout": `[{"name":"factset","dynamoDbTableName":"factset-table","snsKeyLayout":{"shardChars":9}}]`,
+	}
+
+	for desc, config := range invalidConfigs {
+		t.Run(desc, func(t *testing.T) {
+			_, err := ParseTenants(config)
+			assert.Error(t, err, "Invalid tenants configuration was accepted")
+		})
+	}
+}
+
+func TestHandler_TenantRouting(t *testing.T) {
+	defaultSrv := &MockService{model: db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{"default"}}}
+	factsetSrv := &MockService{model: db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{"factset"}}}
+	router := mux.NewRouter()
+	NewHandler(router, AppConfig{}, defaultSrv, map[string]Service{"factset": factsetSrv})
+
+	testCases := []struct {
+		description          string
+		path                 string
+		tenantHeader         string
+		expectedResponseCode int
+		expectedResponseBody string
+	}{
+		{"No tenant", Path, "", 200, "{\"uuid\":\"4f50b156-6c50-4693-b835-02f70d3f3bc0\",\"concordedIds\":[\"default\"]}\n"},
+		{"Tenant path prefix", "/factset" + Path, "", 200, "{\"uuid\":\"4f50b156-6c50-4693-b835-02f70d3f3bc0\",\"concordedIds\":[\"factset\"]}\n"},
+		{"Tenant header", Path, "factset", 200, "{\"uuid\":\"4f50b156-6c50-4693-b835-02f70d3f3bc0\",\"concordedIds\":[\"factset\"]}\n"},
+		{"Unknown tenant path prefix", "/wikidata" + Path, "", 404, "404 page not found\n"},
+		{"Unknown tenant header", Path, "wikidata", 400, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req := newRequest("GET", testCase.path, "")
+			if testCase.tenantHeader != "" {
+				req.Header.Set(TenantHeader, testCase.tenantHeader)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, testCase.expectedResponseCode, rec.Result().StatusCode, "Response code incorrect.")
+			if testCase.expectedResponseBody == "" {
+				problem := decodeProblem(t, rec)
+				assert.Equal(t, CodeUnknownTenant, problem.Code, "Response body incorrect.")
+				assert.Equal(t, "Unknown tenant (wikidata)", problem.Detail, "Response body incorrect.")
+			} else {
+				assert.Equal(t, testCase.expectedResponseBody, rec.Body.String(), "Response body incorrect.")
+			}
+		})
+	}
+}
+
+func TestHealthService_TenantChecks(t *testing.T) {
+	config := getConfig(&MockService{})
+	config.tenants = map[string]Service{"wikidata": &MockService{err: errors.New("")}, "factset": &MockService{}}
+	healthService := newHealthService(config)
+
+	assert.Len(t, healthService.checks, 6, "Expected DynamoDB and SNS checks for the default service and every tenant")
+	assert.Equal(t, "DynamoDB healthcheck (factset)", healthService.checks[2].Name)
+	assert.Equal(t, "SNS healthcheck (wikidata)", healthService.checks[5].Name)
+
+	_, err := healthService.checks[3].Checker()
+	assert.NoError(t, err, "Healthy tenant reported as unhealthy")
+	_, err = healthService.checks[5].Checker()
+	assert.Error(t, err, "Unhealthy tenant reported as healthy")
+	assert.False(t, healthService.gtg().GoodToGo, "GTG should fail when a tenant is unhealthy")
+}
@@ -0,0 +1,165 @@
+package concordances
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+)
+
+const DefaultMaxConcordedIds = 500
+
+var uuidRegex = regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$")
+
+// Violation describes one problem found with a concordance in a request payload.
+type Violation struct {
+	Field   string `json:"field"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// normaliseConcordance trims and lowercases the UUIDs of a concordance and drops duplicate concorded UUIDs and identifiers,
+// keeping the first occurrence of each. The concorded UUIDs of a concordance given with identifiers are those of its identifiers.
+func normaliseConcordance(m db.ConcordancesModel) db.ConcordancesModel {
+	normalised := db.ConcordancesModel{UUID: normaliseUUID(m.UUID), ExpiresAt: m.ExpiresAt}
+
+	ids := m.ConcordedIds
+	if len(m.Identifiers) > 0 {
+		ids = nil
+		seenIdentifiers := map[db.Identifier]bool{}
+		for _, identifier := range m.Identifiers {
+			identifier = db.Identifier{
+				Authority:       strings.TrimSpace(identifier.Authority),
+				IdentifierValue: strings.TrimSpace(identifier.IdentifierValue),
+				UUID:            normaliseUUID(identifier.UUID),
+			}
+			if seenIdentifiers[identifier] {
+				continue
+			}
+			seenIdentifiers[identifier] = true
+			normalised.Identifiers = append(normalised.Identifiers, identifier)
+			ids = append(ids, identifier.UUID)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, id := range ids {
+		id = normaliseUUID(id)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		normalised.ConcordedIds = append(normalised.ConcordedIds, id)
+	}
+	return normalised
+}
+
+func normaliseUUID(uuid string) string {
+	return strings.ToLower(strings.TrimSpace(uuid))
+}
+
+// validatePut checks a concordance written to the given UUID, the same way for every API. It returns the message
+// of the error found, if any, with every violation of the fields in error. The message describes the violation when
+// there is only one.
+func validatePut(uuid string, m db.ConcordancesModel, maxConcordedIds int) (string, []Violation) {
+	var msg string
+	violations := []Violation{}
+	if m.UUID == "" {
+		msg = "Concept UUID is missing from the Payload"
+		violations = append(violations, Violation{Field: "uuid", Message: "is missing"})
+	} else if normaliseUUID(m.UUID) != uuid {
+		msg = fmt.Sprintf("Concept UUID (%s) in payload is different from UUID path parameter (%s)", m.UUID, uuid)
+		violations = append(violations, Violation{Field: "uuid", Value: m.UUID, Message: "is different from the UUID path parameter"})
+	}
+	if len(m.ConcordedIds) < 1 && len(m.Identifiers) < 1 {
+		msg = "Payload has no concorded UUIDs to store"
+		violations = append(violations, Violation{Field: "concordedIds", Message: "is empty, and there are no identifiers"})
+	}
+	for _, violation := range validateConcordance(m, maxConcordedIds) {
+		// A missing UUID is not reported a second time as an invalid one.
+		if violation.Field == "uuid" && m.UUID == "" {
+			continue
+		}
+		violations = append(violations, violation)
+	}
+
+	if len(violations) == 0 {
+		return "", nil
+	}
+	if len(violations) > 1 || msg == "" {
+		msg = "Payload is not a valid concordance"
+	}
+	return msg, violations
+}
+
+// validateConcordance returns every violation found in a concordance, or none if it can be stored once normalised.
+// Violations refer to concorded UUIDs and identifiers by their position in the payload.
+func validateConcordance(m db.ConcordancesModel, maxConcordedIds int) []Violation {
+	violations := []Violation{}
+	uuid := normaliseUUID(m.UUID)
+	if !uuidRegex.MatchString(uuid) {
+		violations = append(violations, Violation{Field: "uuid", Value: m.UUID, Message: "is not a valid UUID"})
+	}
+
+	distinct := map[string]bool{}
+	validateUUID := func(field string, id string) {
+		normalised := normaliseUUID(id)
+		if !uuidRegex.MatchString(normalised) {
+			violations = append(violations, Violation{Field: field, Value: id, Message: "is not a valid UUID"})
+		} else if normalised == uuid {
+			violations = append(violations, Violation{Field: field, Value: id, Message: "is the concept UUID, a concept cannot be concorded to itself"})
+		}
+		distinct[normalised] = true
+	}
+
+	if len(m.Identifiers) > 0 {
+		if len(m.ConcordedIds) > 0 {
+			violations = append(violations, Violation{Field: "concordedIds", Message: "must be omitted when identifiers are given"})
+		}
+		for i, identifier := range m.Identifiers {
+			field := fmt.Sprintf("identifiers[%d]", i)
+			if strings.TrimSpace(identifier.Authority) == "" {
+				violations = append(violations, Violation{Field: field + ".authority", Message: "is missing"})
+			}
+			if strings.TrimSpace(identifier.IdentifierValue) == "" {
+				violations = append(violations, Violation{Field: field + ".identifierValue", Message: "is missing"})
+			}
+			validateUUID(field+".uuid", identifier.UUID)
+		}
+	} else {
+		for i, id := range m.ConcordedIds {
+			validateUUID(fmt.Sprintf("concordedIds[%d]", i), id)
+		}
+	}
+
+	if m.ExpiresAt != nil && !m.ExpiresAt.After(time.Now()) {
+		violations = append(violations, Violation{Field: "expiresAt", Value: m.ExpiresAt.Format(time.RFC3339), Message: "is in the past"})
+	}
+
+	if maxConcordedIds <= 0 {
+		maxConcordedIds = DefaultMaxConcordedIds
+	}
+	if len(distinct) > maxConcordedIds {
+		violations = append(violations, Violation{Field: "concordedIds", Message: fmt.Sprintf("has %d distinct UUIDs, the maximum is %d", len(distinct), maxConcordedIds)})
+	}
+	return violations
+}
+
+// filterByAuthority keeps only the identifiers of the given authority, and the concorded UUIDs they identify.
+func filterByAuthority(m db.ConcordancesModel, authority string) db.ConcordancesModel {
+	filtered := db.ConcordancesModel{UUID: m.UUID, ConcordedIds: []string{}, ExpiresAt: m.ExpiresAt, LastModified: m.LastModified}
+	seen := map[string]bool{}
+	for _, identifier := range m.Identifiers {
+		if !strings.EqualFold(identifier.Authority, authority) {
+			continue
+		}
+		filtered.Identifiers = append(filtered.Identifiers, identifier)
+		if !seen[identifier.UUID] {
+			seen[identifier.UUID] = true
+			filtered.ConcordedIds = append(filtered.ConcordedIds, identifier.UUID)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,121 @@
+package concordances
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormaliseConcordance(t *testing.T) {
+	m := normaliseConcordance(db.ConcordancesModel{
+		UUID:         " 4F50B156-6C50-4693-B835-02F70D3F3BC0 ",
+		ConcordedIds: []string{"7c4b3931-361f-4ea4-b694-75d1630d7746 ", "1E5C86F8-3F38-4B6B-97CE-F75489AC3113", "7C4B3931-361F-4EA4-B694-75D1630D7746"},
+	})
+
+	assert.Equal(t, db.ConcordancesModel{
+		UUID:         TestConceptUuid,
+		ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2},
+	}, m, "Concordance was not trimmed, lowercased and deduplicated")
+}
+
+func TestValidateConcordance_Valid(t *testing.T) {
+	violations := validateConcordance(db.ConcordancesModel{
+		UUID:         TestConceptUuid,
+		ConcordedIds: []string{ConcordedUuid1, " 1E5C86F8-3F38-4B6B-97CE-F75489AC3113", ConcordedUuid1},
+	}, 2)
+
+	assert.Empty(t, violations, "Valid concordance was rejected")
+}
+
+func TestValidateConcordance_ReportsEveryViolation(t *testing.T) {
+	violations := validateConcordance(db.ConcordancesModel{
+		UUID:         TestConceptUuid,
+		ConcordedIds: []string{"tme-id", TestConceptUuid, ConcordedUuid1, ConcordedUuid2},
+	}, 2)
+
+	assert.Equal(t, []Violation{
+		{Field: "concordedIds[0]", Value: "tme-id", Message: "is not a valid UUID"},
+		{Field: "concordedIds[1]", Value: TestConceptUuid, Message: "is the concept UUID, a concept cannot be concorded to itself"},
+		{Field: "concordedIds", Message: "has 4 distinct UUIDs, the maximum is 2"},
+	}, violations)
+}
+
+func TestValidateConcordance_DefaultMaximum(t *testing.T) {
+	ids := make([]string, DefaultMaxConcordedIds+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%08x-f3b8-4b6b-97ce-f75489ac3113", i)
+	}
+	violations := validateConcordance(db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: ids}, 0)
+
+	assert.Len(t, violations, 1, "Default maximum number of concorded UUIDs was not enforced")
+}
+
+var identifiersModel = db.ConcordancesModel{
+	UUID:         TestConceptUuid,
+	ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2},
+	Identifiers: []db.Identifier{
+		{Authority: "TME", IdentifierValue: "MTE3-U3ViamVjdHM=", UUID: ConcordedUuid1},
+		{Authority: "FACTSET", IdentifierValue: "000D63-E", UUID: ConcordedUuid2},
+		{Authority: "TME", IdentifierValue: "NDc3-U3ViamVjdHM=", UUID: ConcordedUuid2},
+	},
+}
+
+func TestNormaliseConcordance_Identifiers(t *testing.T) {
+	m := normaliseConcordance(db.ConcordancesModel{
+		UUID: TestConceptUuid,
+		Identifiers: []db.Identifier{
+			{Authority: " TME", IdentifierValue: "MTE3-U3ViamVjdHM= ", UUID: "7C4B3931-361F-4EA4-B694-75D1630D7746"},
+			{Authority: "FACTSET", IdentifierValue: "000D63-E", UUID: ConcordedUuid2},
+			{Authority: "TME", IdentifierValue: "NDc3-U3ViamVjdHM=", UUID: ConcordedUuid2},
+			{Authority: "TME", IdentifierValue: "MTE3-U3ViamVjdHM=", UUID: ConcordedUuid1},
+		},
+	})
+
+	assert.Equal(t, identifiersModel, m, "Concorded UUIDs were not derived from normalised identifiers")
+}
+
+func TestValidateConcordance_Identifiers(t *testing.T) {
+	violations := validateConcordance(db.ConcordancesModel{
+		UUID:         TestConceptUuid,
+		ConcordedIds: []string{ConcordedUuid1},
+		Identifiers: []db.Identifier{
+			{Authority: "TME", IdentifierValue: "MTE3-U3ViamVjdHM=", UUID: ConcordedUuid1},
+			{IdentifierValue: " ", UUID: "tme-id"},
+		},
+	}, 0)
+
+	assert.Equal(t, []Violation{
+		{Field: "concordedIds", Message: "must be omitted when identifiers are given"},
+		{Field: "identifiers[1].authority", Message: "is missing"},
+		{Field: "identifiers[1].identifierValue", Message: "is missing"},
+		{Field: "identifiers[1].uuid", Value: "tme-id", Message: "is not a valid UUID"},
+	}, violations)
+}
+
+func TestFilterByAuthority(t *testing.T) {
+	assert.Equal(t, db.ConcordancesModel{
+		UUID:         TestConceptUuid,
+		ConcordedIds: []string{ConcordedUuid1, ConcordedUuid2},
+		Identifiers:  []db.Identifier{identifiersModel.Identifiers[0], identifiersModel.Identifiers[2]},
+	}, filterByAuthority(identifiersModel, "tme"))
+
+	assert.Empty(t, filterByAuthority(identifiersModel, "Wikidata").Identifiers)
+	assert.Empty(t, filterByAuthority(db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1}}, "TME").ConcordedIds,
+		"Concordances without identifiers have no known authority")
+}
+
+func TestValidateConcordance_Expiry(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	assert.Empty(t, validateConcordance(db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1}, ExpiresAt: &future}, 0))
+	violations := validateConcordance(db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1}, ExpiresAt: &past}, 0)
+	assert.Len(t, violations, 1, "Expiry in the past was accepted")
+	assert.Equal(t, "expiresAt", violations[0].Field)
+
+	normalised := normaliseConcordance(db.ConcordancesModel{UUID: TestConceptUuid, ConcordedIds: []string{ConcordedUuid1}, ExpiresAt: &future})
+	assert.Equal(t, &future, normalised.ExpiresAt, "Expiry was lost by normalisation")
+}
@@ -0,0 +1,295 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: api/grpc/concordances.proto
+
+package concordancespb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Concordances_Get_FullMethodName      = "/ft.concordances.v1.Concordances/Get"
+	Concordances_BatchGet_FullMethodName = "/ft.concordances.v1.Concordances/BatchGet"
+	Concordances_Put_FullMethodName      = "/ft.concordances.v1.Concordances/Put"
+	Concordances_Delete_FullMethodName   = "/ft.concordances.v1.Concordances/Delete"
+	Concordances_List_FullMethodName     = "/ft.concordances.v1.Concordances/List"
+)
+
+// ConcordancesClient is the client API for Concordances service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ConcordancesClient interface {
+	// Get responds with the concordance of a concept, NOT_FOUND when there is none.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Concordance, error)
+	// BatchGet responds with the concordances of up to 100 concepts, listing the concepts that have none as missing.
+	BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*BatchGetResponse, error)
+	// Put creates or replaces the concordance of a concept, INVALID_ARGUMENT with the violations found when it is not valid.
+	Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error)
+	// Delete removes the concordance of a concept, NOT_FOUND when there is none.
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// List streams every concordance of the table.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (Concordances_ListClient, error)
+}
+
+type concordancesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewConcordancesClient(cc grpc.ClientConnInterface) ConcordancesClient {
+	return &concordancesClient{cc}
+}
+
+func (c *concordancesClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Concordance, error) {
+	out := new(Concordance)
+	err := c.cc.Invoke(ctx, Concordances_Get_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *concordancesClient) BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*BatchGetResponse, error) {
+	out := new(BatchGetResponse)
+	err := c.cc.Invoke(ctx, Concordances_BatchGet_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *concordancesClient) Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	out := new(PutResponse)
+	err := c.cc.Invoke(ctx, Concordances_Put_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *concordancesClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, Concordances_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *concordancesClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (Concordances_ListClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Concordances_ServiceDesc.Streams[0], Concordances_List_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &concordancesListClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Concordances_ListClient interface {
+	Recv() (*Concordance, error)
+	grpc.ClientStream
+}
+
+type concordancesListClient struct {
+	grpc.ClientStream
+}
+
+func (x *concordancesListClient) Recv() (*Concordance, error) {
+	m := new(Concordance)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ConcordancesServer is the server API for Concordances service.
+// All implementations must embed UnimplementedConcordancesServer
+// for forward compatibility
+type ConcordancesServer interface {
+	// Get responds with the concordance of a concept, NOT_FOUND when there is none.
+	Get(context.Context, *GetRequest) (*Concordance, error)
+	// BatchGet responds with the concordances of up to 100 concepts, listing the concepts that have none as missing.
+	BatchGet(context.Context, *BatchGetRequest) (*BatchGetResponse, error)
+	// Put creates or replaces the concordance of a concept, INVALID_ARGUMENT with the violations found when it is not valid.
+	Put(context.Context, *PutRequest) (*PutResponse, error)
+	// Delete removes the concordance of a concept, NOT_FOUND when there is none.
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// List streams every concordance of the table.
+	List(*ListRequest, Concordances_ListServer) error
+	mustEmbedUnimplementedConcordancesServer()
+}
+
+// UnimplementedConcordancesServer must be embedded to have forward compatible implementations.
+type UnimplementedConcordancesServer struct {
+}
+
+func (UnimplementedConcordancesServer) Get(context.Context, *GetRequest) (*Concordance, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedConcordancesServer) BatchGet(context.Context, *BatchGetRequest) (*BatchGetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGet not implemented")
+}
+func (UnimplementedConcordancesServer) Put(context.Context, *PutRequest) (*PutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Put not implemented")
+}
+func (UnimplementedConcordancesServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedConcordancesServer) List(*ListRequest, Concordances_ListServer) error {
+	return status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedConcordancesServer) mustEmbedUnimplementedConcordancesServer() {}
+
+// UnsafeConcordancesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ConcordancesServer will
+// result in compilation errors.
+type UnsafeConcordancesServer interface {
+	mustEmbedUnimplementedConcordancesServer()
+}
+
+func RegisterConcordancesServer(s grpc.ServiceRegistrar, srv ConcordancesServer) {
+	s.RegisterService(&Concordances_ServiceDesc, srv)
+}
+
+func _Concordances_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConcordancesServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Concordances_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConcordancesServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Concordances_BatchGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConcordancesServer).BatchGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Concordances_BatchGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConcordancesServer).BatchGet(ctx, req.(*BatchGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Concordances_Put_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConcordancesServer).Put(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Concordances_Put_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConcordancesServer).Put(ctx, req.(*PutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Concordances_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConcordancesServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Concordances_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConcordancesServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Concordances_List_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConcordancesServer).List(m, &concordancesListServer{stream})
+}
+
+type Concordances_ListServer interface {
+	Send(*Concordance) error
+	grpc.ServerStream
+}
+
+type concordancesListServer struct {
+	grpc.ServerStream
+}
+
+func (x *concordancesListServer) Send(m *Concordance) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Concordances_ServiceDesc is the grpc.ServiceDesc for Concordances service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Concordances_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ft.concordances.v1.Concordances",
+	HandlerType: (*ConcordancesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Concordances_Get_Handler,
+		},
+		{
+			MethodName: "BatchGet",
+			Handler:    _Concordances_BatchGet_Handler,
+		},
+		{
+			MethodName: "Put",
+			Handler:    _Concordances_Put_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Concordances_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "List",
+			Handler:       _Concordances_List_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api/grpc/concordances.proto",
+}
@@ -5,12 +5,21 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	log "github.com/sirupsen/logrus"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	TableHashKey = "conceptId"
+	TTLAttribute = "expiresAt"
+	// LastModifiedAttribute is the time a record was last modified, in seconds since the epoch, stamped by every write and deletion.
+	LastModifiedAttribute = "lastModified"
+	// TransactionIDAttribute is the transaction id of the request that last modified a record, stamped with its time.
+	TransactionIDAttribute = "transactionId"
 )
 
 type Status int
@@ -23,37 +32,96 @@ const (
 	CONCORDANCE_ERROR
 )
 
+// Identifier is a concorded concept together with the authority that identifies it and its identifier within that authority.
+type Identifier struct {
+	Authority       string `json:"authority"`
+	IdentifierValue string `json:"identifierValue"`
+	UUID            string `json:"uuid"`
+}
+
 type ConcordancesModel struct {
-	UUID         string   `json:"uuid"`
-	ConcordedIds []string `json:"concordedIds"`
+	UUID         string       `json:"uuid"`
+	ConcordedIds []string     `json:"concordedIds"`
+	Identifiers  []Identifier `json:"identifiers,omitempty"`
+	ExpiresAt    *time.Time   `json:"expiresAt,omitempty"`
+	// LastModified is the time the record was last written, it is not part of the concordance.
+	// Records written before it was stamped have none.
+	LastModified *time.Time `json:"-"`
+	// TransactionID is the transaction id of the request that last wrote the record, it is not part of the concordance.
+	TransactionID string `json:"-"`
+	// Expired is set on the record returned by Expire, when that call deleted it.
+	Expired bool `json:"-"`
 }
 
 type DynamoConcordancesModel struct {
-	UUID         string   `json:"conceptId"`
-	ConcordedIds []string `json:"concordedIds"`
+	UUID         string       `json:"conceptId"`
+	ConcordedIds []string     `json:"concordedIds"`
+	Identifiers  []Identifier `json:"identifiers,omitempty"`
+	// ExpiresAt is the DynamoDB TTL attribute, in seconds since the epoch.
+	ExpiresAt     int64  `json:"expiresAt,omitempty"`
+	LastModified  int64  `json:"lastModified,omitempty"`
+	TransactionID string `json:"transactionId,omitempty"`
+	// Version, Deleted, Outbox and HeldExpiresAt are only written by clients with an outbox, see outbox.go.
+	Version       int64    `json:"version,omitempty"`
+	Deleted       bool     `json:"deleted,omitempty"`
+	Outbox        []Change `json:"outbox,omitempty"`
+	HeldExpiresAt int64    `json:"heldExpiresAt,omitempty"`
 }
 
 type Clienter interface {
 	Read(uuid string, transactionId string) (ConcordancesModel, error)
-	Write(m ConcordancesModel, transactionId string) (Status, error)
-	Delete(uuid string, transactionId string) (Status, error)
+	// Write stores a concordance record and returns the record it replaced, if any.
+	Write(m ConcordancesModel, transactionId string) (Status, ConcordancesModel, error)
+	// Delete deletes a concordance record and returns the deleted record, if any.
+	Delete(uuid string, transactionId string) (Status, ConcordancesModel, error)
 	Healthcheck() (error)
+	Stats() (TableStats, error)
+}
+
+// Scanner is implemented by clients that can read every concordance record of their table.
+type Scanner interface {
+	Scan(fn func(ConcordancesModel) error) error
 }
 
 type Client struct {
 	dynamoDbTable string
 	awsRegion     string
-	ddb           *dynamodb.DynamoDB
+	ddb           dynamodbiface.DynamoDBAPI
+	outbox        bool
+
+	// consumedLock guards the capacity consumed, counted on every request, and statsLock the last description
+	// of the table, so that describing the table does not hold up requests.
+	consumedLock          sync.Mutex
+	consumedReadCapacity  float64
+	consumedWriteCapacity float64
+	statsLock             sync.Mutex
+	statsTTL              time.Duration
+	stats                 TableStats
+	statsErr              error
+	statsUpdated          time.Time
 }
 
 func NewDynamoDBClient(dynamoDbTable string, awsRegion string) Clienter {
 	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String(awsRegion)}))
 	ddb := dynamodb.New(sess)
-	c := Client{dynamoDbTable: dynamoDbTable, awsRegion: awsRegion, ddb: ddb}
+	c := Client{dynamoDbTable: dynamoDbTable, awsRegion: awsRegion, ddb: ddb, statsTTL: defaultStatsTTL}
 	return &c
 }
 
-func (s *Client) Read(uuid string, transactionId string) (ConcordancesModel, error) {
+// NewDynamoDBClientWithAPI creates a client of a table reached through the given API, e.g. DynamoDB Local.
+func NewDynamoDBClientWithAPI(dynamoDbTable string, api dynamodbiface.DynamoDBAPI) Clienter {
+	return &Client{dynamoDbTable: dynamoDbTable, ddb: api, statsTTL: defaultStatsTTL}
+}
+
+// NewDynamoDBClientWithOutbox creates a client that records every change in the outbox of the changed record, see Outbox.
+func NewDynamoDBClientWithOutbox(dynamoDbTable string, awsRegion string) Clienter {
+	c := NewDynamoDBClient(dynamoDbTable, awsRegion).(*Client)
+	c.outbox = true
+	return c
+}
+
+func (s *Client) Read(uuid string, transactionId string) (_ ConcordancesModel, err error) {
+	defer func() { err = classify(err) }()
 	m := DynamoConcordancesModel{}
 	input := &dynamodb.GetItemInput{}
 	input.SetTableName(s.dynamoDbTable)
@@ -65,6 +133,7 @@ func (s *Client) Read(uuid string, transactionId string) (ConcordancesModel, err
 	}
 
 	input.SetKey(map[string]*dynamodb.AttributeValue{"conceptId": k})
+	input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityTotal)
 	output, err := s.ddb.GetItem(input)
 
 	if err != nil {
@@ -72,6 +141,7 @@ func (s *Client) Read(uuid string, transactionId string) (ConcordancesModel, err
 		return ConcordancesModel{}, err
 	}
 
+	s.consumed(output.ConsumedCapacity, false)
 	if output.Item == nil {
 		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Info("No concordance record was found")
 	}
@@ -83,82 +153,186 @@ func (s *Client) Read(uuid string, transactionId string) (ConcordancesModel, err
 		return ConcordancesModel{}, err
 	}
 
-	return ConcordancesModel{m.UUID, m.ConcordedIds}, err
+	// Deleted records are kept until the changes in their outbox are delivered.
+	if m.Deleted {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Info("Concordance record has been deleted")
+		return ConcordancesModel{}, nil
+	}
+
+	// DynamoDB purges expired items up to a couple of days after they expire, so they are hidden until then.
+	// Reading has no side effects, expired records are purged by Expire.
+	if m.expired() {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Info("Concordance record has expired")
+		return ConcordancesModel{}, nil
+	}
+
+	return m.toModel(), err
 }
 
-func (s *Client) Write(m ConcordancesModel, transactionId string) (updateStatus Status, err error) {
-	input, err := s.getUpdateInput(m)
+func (s *Client) Write(m ConcordancesModel, transactionId string) (updateStatus Status, previous ConcordancesModel, err error) {
+	defer func() { err = classify(err) }()
+	if s.outbox {
+		return s.writeWithChange(m, transactionId)
+	}
+	input, err := s.getUpdateInput(m, transactionId)
 	model := DynamoConcordancesModel{}
 	output, err := s.ddb.UpdateItem(input)
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{"UUID": m.UUID, "ConcordedIds": strings.Join(m.ConcordedIds, ", "), "transaction_id": transactionId}).Error("Error Getting Concordance Record")
-		return CONCORDANCE_ERROR, err
+		return CONCORDANCE_ERROR, previous, err
 	}
+	s.consumed(output.ConsumedCapacity, true)
 
 	err = dynamodbattribute.UnmarshalMap(output.Attributes, &model)
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{"UUID": m.UUID, "ConcordedIds": strings.Join(m.ConcordedIds, ", "), "transaction_id": transactionId}).Error("Error unmarshalling the response to writing Concordance Record")
-		return CONCORDANCE_ERROR, err
+		return CONCORDANCE_ERROR, previous, err
 	}
 
-	if model.UUID != "" {
+	if model.live() {
 		log.WithFields(log.Fields{"UUID": m.UUID, "ConcordedIds": strings.Join(m.ConcordedIds, ", "), "transaction_id": transactionId}).Info("Concordance updated")
-		return CONCORDANCE_UPDATED, nil
+		return CONCORDANCE_UPDATED, model.toModel(), nil
 	} else {
 		log.WithFields(log.Fields{"UUID": m.UUID, "ConcordedIds": strings.Join(m.ConcordedIds, ", "), "transaction_id": transactionId}).Info("Concordance created")
-		return CONCORDANCE_CREATED, nil
+		return CONCORDANCE_CREATED, previous, nil
 	}
 }
-func (s *Client) getUpdateInput(m ConcordancesModel) (*dynamodb.UpdateItemInput, error) {
+func (s *Client) getUpdateInput(m ConcordancesModel, transactionId string) (*dynamodb.UpdateItemInput, error) {
 	input := &dynamodb.UpdateItemInput{}
 	k, err := dynamodbattribute.Marshal(m.UUID)
 	if err != nil {
 		return input, err
 	}
-	l, err := dynamodbattribute.Marshal(m.ConcordedIds)
+	set, remove, values, err := updateClauses(m)
 	if err != nil {
 		return input, err
 	}
+	set, values = stamp(set, values, transactionId)
+	// A deleted record that is written again is no longer deleted.
+	remove = append(remove, "#deleted")
 
 	input.SetKey(map[string]*dynamodb.AttributeValue{TableHashKey: k})
-	input.SetUpdateExpression("SET concordedIds = :concordedIds")
+	input.SetUpdateExpression(updateExpression(set, remove))
 	input.SetReturnValues(dynamodb.ReturnValueAllOld)
+	input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityTotal)
 	input.SetTableName(s.dynamoDbTable)
-	input.SetExpressionAttributeValues(map[string]*dynamodb.AttributeValue{":concordedIds": l})
+	input.SetExpressionAttributeNames(map[string]*string{"#deleted": aws.String(deletedAttribute)})
+	input.SetExpressionAttributeValues(values)
 	return input, nil
 }
 
-func (s *Client) Delete(uuid string, transactionId string) (status Status, err error) {
+// updateClauses returns the attributes to set and remove to store a concordance, and the values they are set to.
+func updateClauses(m ConcordancesModel) (set []string, remove []string, values map[string]*dynamodb.AttributeValue, err error) {
+	l, err := dynamodbattribute.Marshal(m.ConcordedIds)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	values = map[string]*dynamodb.AttributeValue{":concordedIds": l}
+	set = []string{"concordedIds = :concordedIds"}
+	if len(m.Identifiers) > 0 {
+		ids, err := dynamodbattribute.Marshal(m.Identifiers)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		values[":identifiers"] = ids
+		set = append(set, "identifiers = :identifiers")
+	} else {
+		remove = append(remove, "identifiers")
+	}
+	if m.ExpiresAt != nil {
+		values[":expiresAt"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(m.ExpiresAt.Unix(), 10))}
+		set = append(set, TTLAttribute+" = :expiresAt")
+	} else {
+		remove = append(remove, TTLAttribute)
+	}
+	return set, remove, values, nil
+}
+
+// stamp sets the time of an update as the time the record was last modified, and the transaction id of the update
+// as the transaction id of the record, so that the change can be attributed to its request when read from the stream.
+func stamp(set []string, values map[string]*dynamodb.AttributeValue, transactionId string) ([]string, map[string]*dynamodb.AttributeValue) {
+	values[":lastModified"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))}
+	values[":transactionId"] = &dynamodb.AttributeValue{S: aws.String(transactionId)}
+	return append(set, LastModifiedAttribute+" = :lastModified", TransactionIDAttribute+" = :transactionId"), values
+}
+
+func updateExpression(set []string, remove []string) string {
+	expression := "SET " + strings.Join(set, ", ")
+	if len(remove) > 0 {
+		expression += " REMOVE " + strings.Join(remove, ", ")
+	}
+	return expression
+}
+
+func (s *Client) Delete(uuid string, transactionId string) (status Status, previous ConcordancesModel, err error) {
+	defer func() { err = classify(err) }()
+	if s.outbox {
+		return s.deleteWithChange(uuid, transactionId)
+	}
 	model := DynamoConcordancesModel{}
 
 	input := &dynamodb.DeleteItemInput{}
 	input.SetReturnValues(dynamodb.ReturnValueAllOld)
+	input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityTotal)
 	input.SetTableName(s.dynamoDbTable)
 
 	k, err := dynamodbattribute.Marshal(uuid)
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error marshalling UUID to Dynamo Key for Deletion of a concordance")
-		return CONCORDANCE_ERROR, err
+		return CONCORDANCE_ERROR, previous, err
 	}
 
 	input.SetKey(map[string]*dynamodb.AttributeValue{TableHashKey: k})
 	output, err := s.ddb.DeleteItem(input)
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error Deleting Concordance")
-		return CONCORDANCE_ERROR, err
+		return CONCORDANCE_ERROR, previous, err
 	}
+	s.consumed(output.ConsumedCapacity, true)
 
 	err = dynamodbattribute.UnmarshalMap(output.Attributes, &model)
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error Unmarshalling response from deleting concordance - Unable to ascertain whether the delete was a delete/not found")
-		return CONCORDANCE_ERROR, err
+		return CONCORDANCE_ERROR, previous, err
 	}
 
-	if model.UUID != "" {
-		return CONCORDANCE_DELETED, nil
+	if model.live() {
+		return CONCORDANCE_DELETED, model.toModel(), nil
 	} else {
-		return CONCORDANCE_NOT_FOUND, nil
+		return CONCORDANCE_NOT_FOUND, previous, nil
+	}
+}
+
+// Scan reads every concordance record of the table, one page at a time, calling fn for each record in turn.
+// Scanning stops at the first error returned by fn.
+func (s *Client) Scan(fn func(ConcordancesModel) error) error {
+	input := &dynamodb.ScanInput{}
+	input.SetTableName(s.dynamoDbTable)
+
+	var fnErr error
+	err := s.ddb.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			m := DynamoConcordancesModel{}
+			if fnErr = dynamodbattribute.UnmarshalMap(item, &m); fnErr != nil {
+				log.WithError(fnErr).Error("Error unmarshalling a scanned concordance record")
+				return false
+			}
+			// Expired records are no longer live, even though DynamoDB has not purged them yet.
+			if m.Deleted || m.expired() {
+				continue
+			}
+			if fnErr = fn(m.toModel()); fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		log.WithError(err).WithField("table", s.dynamoDbTable).Error("Error scanning concordance records")
+		return err
 	}
+	return fnErr
 }
 
 func (s *Client) Healthcheck() (error) {
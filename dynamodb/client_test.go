@@ -11,6 +11,7 @@ import (
 	"testing"
 	"log"
 	"fmt"
+	"time"
 )
 
 const (
@@ -25,6 +26,15 @@ var goodModel = ConcordancesModel{
 	ConcordedIds: []string{"7c4b3931-361f-4ea4-b694-75d1630d7746", "1e5c86f8-3f38-4b6b-97ce-f75489ac3113"},
 }
 
+var identifiersModel = ConcordancesModel{
+	UUID:         UUID,
+	ConcordedIds: []string{"7c4b3931-361f-4ea4-b694-75d1630d7746", "1e5c86f8-3f38-4b6b-97ce-f75489ac3113"},
+	Identifiers: []Identifier{
+		{Authority: "TME", IdentifierValue: "MTE3-U3ViamVjdHM=", UUID: "7c4b3931-361f-4ea4-b694-75d1630d7746"},
+		{Authority: "FACTSET", IdentifierValue: "000D63-E", UUID: "1e5c86f8-3f38-4b6b-97ce-f75489ac3113"},
+	},
+}
+
 var db *dynamodb.DynamoDB
 var c Client
 
@@ -117,17 +127,28 @@ func TestUpdateInputIsValid(t *testing.T) {
 	tearDownTestCase := setupTestCase(t)
 	defer tearDownTestCase(t)
 
-	input, err := c.getUpdateInput(goodModel)
+	input, err := c.getUpdateInput(goodModel, "test_transaction_id")
+
+	assert.NoError(t, err, "Received error")
+	assert.NoError(t, input.Validate(), "Update Input is valid.")
+}
+
+func TestUpdateInputWithIdentifiersIsValid(t *testing.T) {
+	input, err := c.getUpdateInput(identifiersModel, "test_transaction_id")
 
 	assert.NoError(t, err, "Received error")
 	assert.NoError(t, input.Validate(), "Update Input is valid.")
+	assert.Equal(t, "SET concordedIds = :concordedIds, identifiers = :identifiers, lastModified = :lastModified, transactionId = :transactionId REMOVE expiresAt, #deleted", *input.UpdateExpression)
+	assert.Equal(t, "test_transaction_id", *input.ExpressionAttributeValues[":transactionId"].S, "Transaction id was not stamped")
+	assert.Len(t, input.ExpressionAttributeValues[":identifiers"].L, 2, "Identifiers were not stored as a list")
+	assert.Equal(t, "FACTSET", *input.ExpressionAttributeValues[":identifiers"].L[1].M["authority"].S, "Identifiers were not stored as maps")
 }
 
 func TestCreateConcordance(t *testing.T) {
 	tearDownTestCase := setupTestCase(t)
 	defer tearDownTestCase(t)
 
-	status, err := c.Write(goodModel, "test_transaction_id")
+	status, _, err := c.Write(goodModel, "test_transaction_id")
 
 	assert.NoError(t, err, "Failed to write concordance.")
 	assert.Equal(t, status, CONCORDANCE_CREATED)
@@ -135,21 +156,97 @@ func TestCreateConcordance(t *testing.T) {
 	assert.True(t, reflect.DeepEqual(goodModel, newModel), "Failed to create concordance record")
 }
 
+func TestCreateConcordanceWithIdentifiers(t *testing.T) {
+	tearDownTestCase := setupTestCase(t)
+	defer tearDownTestCase(t)
+
+	status, _, err := c.Write(identifiersModel, "test_transaction_id")
+
+	assert.NoError(t, err, "Failed to write concordance.")
+	assert.Equal(t, status, CONCORDANCE_CREATED)
+	newModel, err := c.Read(UUID, "test_transaction_id")
+	assert.True(t, reflect.DeepEqual(identifiersModel, newModel), "Failed to create concordance record with identifiers")
+}
+
+func TestUpdateConcordanceRemovesIdentifiers(t *testing.T) {
+	tearDownTestCase := setupTestCase(t)
+	defer tearDownTestCase(t)
+
+	_, _, err := c.Write(identifiersModel, "test_transaction_id")
+	assert.NoError(t, err, "Failed to write concordance.")
+	status, _, err := c.Write(goodModel, "test_transaction_id")
+
+	updatedModel, err := c.Read(UUID, "test_transaction_id")
+
+	assert.Equal(t, status, CONCORDANCE_UPDATED)
+	assert.True(t, reflect.DeepEqual(goodModel, updatedModel), "Identifiers of a concordance updated without identifiers were not removed")
+}
+
+func TestCreateExpiringConcordance(t *testing.T) {
+	tearDownTestCase := setupTestCase(t)
+	defer tearDownTestCase(t)
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	expiringModel := ConcordancesModel{UUID: UUID, ConcordedIds: goodModel.ConcordedIds, ExpiresAt: &expiresAt}
+	_, _, err := c.Write(expiringModel, "test_transaction_id")
+	assert.NoError(t, err, "Failed to write concordance.")
+
+	newModel, err := c.Read(UUID, "test_transaction_id")
+	assert.NoError(t, err, "Retrieving concordance resulted in error.")
+	assert.True(t, reflect.DeepEqual(expiringModel, newModel), "Failed to create expiring concordance record")
+
+	status, _, err := c.Write(goodModel, "test_transaction_id")
+	updatedModel, err := c.Read(UUID, "test_transaction_id")
+	assert.Equal(t, CONCORDANCE_UPDATED, status)
+	assert.Nil(t, updatedModel.ExpiresAt, "Expiry of a concordance re-confirmed without expiry was not removed")
+}
+
+func TestReadExpiredConcordance(t *testing.T) {
+	tearDownTestCase := setupTestCase(t)
+	defer tearDownTestCase(t)
+
+	expiresAt := time.Now().Add(-time.Hour)
+	_, _, err := c.Write(ConcordancesModel{UUID: UUID, ConcordedIds: goodModel.ConcordedIds, ExpiresAt: &expiresAt}, "test_transaction_id")
+	assert.NoError(t, err, "Failed to write concordance.")
+
+	model, err := c.Read(UUID, "test_transaction_id")
+	assert.NoError(t, err, "Retrieving concordance resulted in error.")
+	assert.Equal(t, ConcordancesModel{}, model, "Expired concordance was not hidden")
+
+	expired := []string{}
+	err = c.ScanExpired(func(uuid string) error {
+		expired = append(expired, uuid)
+		return nil
+	})
+	assert.NoError(t, err, "Scanning expired concordances resulted in error.")
+	assert.Equal(t, []string{UUID}, expired)
+
+	model, err = c.Expire(UUID, "test_transaction_id")
+	assert.NoError(t, err, "Expiring concordance resulted in error.")
+	assert.True(t, model.Expired, "Expired concordance was not reported as expired")
+	assert.Equal(t, goodModel.ConcordedIds, model.ConcordedIds, "Expired concordance should be reported with its concorded UUIDs")
+
+	model, err = c.Expire(UUID, "test_transaction_id")
+	assert.NoError(t, err, "Expiring concordance resulted in error.")
+	assert.Equal(t, ConcordancesModel{}, model, "Expired concordance should only be reported as expired once")
+}
+
 func TestUpdateConcordance(t *testing.T) {
 	tearDownTestCase := setupTestCase(t)
 	defer tearDownTestCase(t)
 
-	_, err := c.Write(goodModel, "test_transaction_id")
+	_, _, err := c.Write(goodModel, "test_transaction_id")
 	assert.NoError(t, err, "Failed to write concordance.")
 	newModel := ConcordancesModel{
 		UUID:         "4f50b156-6c50-4693-b835-02f70d3f3bc0",
 		ConcordedIds: []string{"7c4b3931-361f-4ea4-b694-75d1630d7746"},
 	}
-	status, err := c.Write(newModel, "test_transaction_id")
+	status, previous, err := c.Write(newModel, "test_transaction_id")
 
 	updatedModel, err := c.Read(UUID, "test_transaction_id")
 
 	assert.Equal(t, status, CONCORDANCE_UPDATED)
+	assert.True(t, reflect.DeepEqual(goodModel, previous), "Write did not return the replaced concordance record")
 	assert.True(t, reflect.DeepEqual(newModel, updatedModel), "Failed to update concordance record")
 }
 
@@ -157,20 +254,21 @@ func TestDeleteExistingConcordance(t *testing.T) {
 	tearDownTestCase := setupTestCase(t)
 	defer tearDownTestCase(t)
 
-	_, err := c.Write(goodModel, "test_transaction_id")
+	_, _, err := c.Write(goodModel, "test_transaction_id")
 	assert.NoError(t, err, "Failed to set up concordance to be deleted")
 
-	status, err := c.Delete(UUID, "test_transaction_id")
+	status, previous, err := c.Delete(UUID, "test_transaction_id")
 
 	assert.NoError(t, err, "Deletion operation resulted in error.")
 	assert.Equal(t, status, CONCORDANCE_DELETED,  "Unexpected status on deleting existing concordance")
+	assert.True(t, reflect.DeepEqual(goodModel, previous), "Delete did not return the deleted concordance record")
 }
 
 func TestDeleteNonExistingConcordance(t *testing.T) {
 	tearDownTestCase := setupTestCase(t)
 	defer tearDownTestCase(t)
 
-	status, err := c.Delete(UUID, "test_transaction_id")
+	status, _, err := c.Delete(UUID, "test_transaction_id")
 
 	assert.NoError(t, err, "Deletion operation resulted in error.")
 	assert.Equal(t, status, CONCORDANCE_NOT_FOUND, "Unexpected status, expected to not find a concordance")
@@ -180,7 +278,7 @@ func TestReadExistingConcordance(t *testing.T) {
 	tearDownTestCase := setupTestCase(t)
 	defer tearDownTestCase(t)
 
-	_, err := c.Write(goodModel, "test_transaction_id")
+	_, _, err := c.Write(goodModel, "test_transaction_id")
 	assert.NoError(t, err, "failed to set up concordance to be read.")
 
 	model, err := c.Read(UUID, "test_transaction_id")
@@ -200,6 +298,26 @@ func TestReadNonExistingConcordance(t *testing.T) {
 	assert.Empty(t, model.ConcordedIds, "Failed to retrive old concordance record upon deletion")
 }
 
+func TestScanConcordances(t *testing.T) {
+	tearDownTestCase := setupTestCase(t)
+	defer tearDownTestCase(t)
+
+	otherModel := ConcordancesModel{UUID: "7c4b3931-361f-4ea4-b694-75d1630d7746", ConcordedIds: []string{UUID}}
+	_, _, err := c.Write(goodModel, "test_transaction_id")
+	assert.NoError(t, err, "Failed to set up concordance to be scanned.")
+	_, _, err = c.Write(otherModel, "test_transaction_id")
+	assert.NoError(t, err, "Failed to set up concordance to be scanned.")
+
+	scanned := map[string]ConcordancesModel{}
+	err = c.Scan(func(m ConcordancesModel) error {
+		scanned[m.UUID] = m
+		return nil
+	})
+
+	assert.NoError(t, err, "Scanning concordances resulted in error.")
+	assert.Equal(t, map[string]ConcordancesModel{UUID: goodModel, otherModel.UUID: otherModel}, scanned)
+}
+
 func TestClient_Healthcheck(t *testing.T) {
 	tearDownTestCase := setupTestCase(t)
 	defer tearDownTestCase(t)
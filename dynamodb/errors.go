@@ -0,0 +1,27 @@
+package dynamodb
+
+import (
+	"github.com/Financial-Times/concordances-rw-dynamodb/awserrors"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// errorKinds are the kinds of the error codes of DynamoDB, besides throttling and timeouts.
+var errorKinds = map[string]awserrors.ErrorKind{
+	"AccessDeniedException":                                  awserrors.KindAccessDenied,
+	"UnrecognizedClientException":                            awserrors.KindAccessDenied,
+	"InvalidSignatureException":                              awserrors.KindAccessDenied,
+	"IncompleteSignatureException":                           awserrors.KindAccessDenied,
+	"MissingAuthenticationTokenException":                    awserrors.KindAccessDenied,
+	"ExpiredTokenException":                                  awserrors.KindAccessDenied,
+	"NoCredentialProviders":                                  awserrors.KindAccessDenied,
+	"MissingRegion":                                          awserrors.KindAccessDenied,
+	"ValidationException":                                    awserrors.KindValidation,
+	dynamodb.ErrCodeItemCollectionSizeLimitExceededException: awserrors.KindValidation,
+	dynamodb.ErrCodeResourceNotFoundException:                awserrors.KindNotFound,
+}
+
+// classify returns the errors of DynamoDB of a known kind as an awserrors.Error, as returned by the Read, Write and Delete
+// methods of the client, and any other error as it is.
+func classify(err error) error {
+	return awserrors.Classify(awserrors.ServiceDynamoDB, err, errorKinds)
+}
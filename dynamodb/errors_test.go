@@ -0,0 +1,87 @@
+package dynamodb
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/awserrors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+type failingAPI struct {
+	dynamodbiface.DynamoDBAPI
+	err error
+}
+
+func (f *failingAPI) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return nil, f.err
+}
+
+func (f *failingAPI) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	return nil, f.err
+}
+
+func (f *failingAPI) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	return nil, f.err
+}
+
+func TestClassify(t *testing.T) {
+	testCases := []struct {
+		description  string
+		err          error
+		expectedKind awserrors.ErrorKind
+	}{
+		{"Provisioned throughput exceeded", awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "throughput exceeded", nil), awserrors.KindThrottled},
+		{"Request limit exceeded", awserr.New(dynamodb.ErrCodeRequestLimitExceeded, "limit exceeded", nil), awserrors.KindThrottled},
+		{"Access denied", awserr.New("AccessDeniedException", "not authorized", nil), awserrors.KindAccessDenied},
+		{"Unrecognized client", awserr.New("UnrecognizedClientException", "invalid token", nil), awserrors.KindAccessDenied},
+		{"No credentials", awserr.New("NoCredentialProviders", "no valid providers in chain", nil), awserrors.KindAccessDenied},
+		{"Validation", awserr.New("ValidationException", "item size has exceeded the maximum allowed size", nil), awserrors.KindValidation},
+		{"Missing table", awserr.New(dynamodb.ErrCodeResourceNotFoundException, "requested resource not found", nil), awserrors.KindNotFound},
+		{"Cancelled", awserr.New(request.CanceledErrorCode, "request context canceled", nil), awserrors.KindTimeout},
+		{"Network timeout", awserr.New(request.ErrCodeRequestError, "send request failed", &url.Error{Op: "Post", URL: "https://dynamodb", Err: timeoutError{}}), awserrors.KindTimeout},
+		{"Internal error", awserr.New(dynamodb.ErrCodeInternalServerError, "internal server error", nil), awserrors.KindUnknown},
+		{"Other error", errors.New("not an AWS error"), awserrors.KindUnknown},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			err := classify(testCase.err)
+
+			assert.Equal(t, testCase.expectedKind, awserrors.KindOf(err))
+			if testCase.expectedKind != awserrors.KindUnknown {
+				assert.Equal(t, awserrors.ServiceDynamoDB, awserrors.ServiceOf(err))
+			}
+			assert.Equal(t, testCase.err.Error(), err.Error())
+			if testCase.expectedKind == awserrors.KindUnknown {
+				assert.Equal(t, testCase.err, err, "Errors of unknown kind should be returned as they are")
+			}
+		})
+	}
+}
+
+func TestClientClassifiesErrors(t *testing.T) {
+	throttled := awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "throughput exceeded", nil)
+	for _, outbox := range []bool{false, true} {
+		client := Client{dynamoDbTable: DDB_TABLE, ddb: &failingAPI{err: throttled}, outbox: outbox}
+
+		_, err := client.Read(identifiersModel.UUID, "test_transaction_id")
+		assert.Equal(t, awserrors.KindThrottled, awserrors.KindOf(err), "Read errors should be classified")
+		status, _, err := client.Write(identifiersModel, "test_transaction_id")
+		assert.Equal(t, CONCORDANCE_ERROR, status)
+		assert.Equal(t, awserrors.KindThrottled, awserrors.KindOf(err), "Write errors should be classified")
+		status, _, err = client.Delete(identifiersModel.UUID, "test_transaction_id")
+		assert.Equal(t, CONCORDANCE_ERROR, status)
+		assert.Equal(t, awserrors.KindThrottled, awserrors.KindOf(err), "Delete errors should be classified")
+	}
+}
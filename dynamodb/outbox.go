@@ -0,0 +1,410 @@
+package dynamodb
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outboxAttribute        = "outbox"
+	versionAttribute       = "version"
+	deletedAttribute       = "deleted"
+	heldExpiresAtAttribute = "heldExpiresAt"
+
+	// Writes are retried when the record was changed by another writer since it was read.
+	outboxMaxAttempts = 3
+	// MaxPendingChanges bounds the outbox of a record, so that a record whose changes cannot be delivered does not
+	// outgrow the size limit of DynamoDB items. Once it is reached, every change is merged into the newest pending one.
+	MaxPendingChanges = 10
+)
+
+var errNoOutbox = errors.New("primary table has no outbox")
+
+// Change is a change to a concordance record waiting in the outbox of the record to be announced.
+type Change struct {
+	ID              string    `json:"id"`
+	Status          Status    `json:"status"`
+	TransactionID   string    `json:"transactionId"`
+	Timestamp       time.Time `json:"timestamp"`
+	OldConcordedIds []string  `json:"oldConcordedIds,omitempty"`
+	NewConcordedIds []string  `json:"newConcordedIds,omitempty"`
+	Authorities     []string  `json:"authorities,omitempty"`
+}
+
+// Outbox is implemented by clients that record every change in the outbox of the changed record, as part of the same
+// conditional write as the change itself, so that a change is never stored without also being recorded for announcement.
+// Deleted records are kept, without their concordance, until their outbox is empty. The expiry of a record is held out
+// of the TTL attribute until its outbox is empty too, so that DynamoDB does not purge a record with pending changes.
+type Outbox interface {
+	// PendingChanges returns the changes of a record that have not been acknowledged yet, oldest first.
+	PendingChanges(uuid string) ([]Change, error)
+	// AcknowledgeChange removes the oldest change from the outbox of a record, once it has been delivered.
+	AcknowledgeChange(uuid string, changeId string) error
+	// ScanPending calls fn with the UUID of every record that has pending changes.
+	ScanPending(fn func(uuid string) error) error
+}
+
+// Authorities returns the distinct authorities of the identifiers of the given concordances, in order of appearance.
+func Authorities(models ...ConcordancesModel) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range models {
+		for _, identifier := range m.Identifiers {
+			if !seen[identifier.Authority] {
+				seen[identifier.Authority] = true
+				names = append(names, identifier.Authority)
+			}
+		}
+	}
+	return names
+}
+
+func newChange(status Status, transactionId string, previous ConcordancesModel, current ConcordancesModel) Change {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return Change{
+		ID:              hex.EncodeToString(id),
+		Status:          status,
+		TransactionID:   transactionId,
+		Timestamp:       time.Now().UTC(),
+		OldConcordedIds: previous.ConcordedIds,
+		NewConcordedIds: current.ConcordedIds,
+		Authorities:     Authorities(previous, current),
+	}
+}
+
+// mergeChanges returns the change announcing both an older change and a newer one, from the concordance before
+// the older change to the concordance after the newer one.
+func mergeChanges(older Change, newer Change) Change {
+	merged := newer
+	merged.OldConcordedIds = older.OldConcordedIds
+	switch {
+	case older.Status == CONCORDANCE_CREATED && newer.Status != CONCORDANCE_DELETED:
+		merged.Status = CONCORDANCE_CREATED
+	case older.Status == CONCORDANCE_DELETED && newer.Status == CONCORDANCE_CREATED:
+		merged.Status = CONCORDANCE_UPDATED
+	}
+	merged.Authorities = append([]string{}, older.Authorities...)
+	for _, authority := range newer.Authorities {
+		found := false
+		for _, name := range merged.Authorities {
+			found = found || name == authority
+		}
+		if !found {
+			merged.Authorities = append(merged.Authorities, authority)
+		}
+	}
+	return merged
+}
+
+// live reports whether the record holds a concordance, rather than being absent, deleted or expired.
+func (m DynamoConcordancesModel) live() bool {
+	return m.UUID != "" && !m.Deleted && !m.expired()
+}
+
+func (s *Client) writeWithChange(m ConcordancesModel, transactionId string) (Status, ConcordancesModel, error) {
+	for attempt := 1; ; attempt++ {
+		current, err := s.current(m.UUID)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"UUID": m.UUID, "transaction_id": transactionId}).Error("Error reading concordance record before writing it")
+			return CONCORDANCE_ERROR, ConcordancesModel{}, err
+		}
+
+		status, previous := CONCORDANCE_CREATED, ConcordancesModel{}
+		if current.live() {
+			status, previous = CONCORDANCE_UPDATED, current.toModel()
+		}
+		set, remove, values, err := updateClauses(m)
+		if err != nil {
+			return CONCORDANCE_ERROR, ConcordancesModel{}, err
+		}
+		set, remove = holdExpiry(set, remove)
+		remove = append(remove, "#deleted")
+
+		err = s.recordChange(m.UUID, current, newChange(status, transactionId, previous, m), set, remove, values)
+		if isConditionalCheckFailed(err) && attempt < outboxMaxAttempts {
+			log.WithFields(log.Fields{"UUID": m.UUID, "transaction_id": transactionId, "attempts": attempt}).Info("Concordance record was changed while writing it, retrying")
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"UUID": m.UUID, "transaction_id": transactionId}).Error("Error writing concordance record and its change")
+			return CONCORDANCE_ERROR, ConcordancesModel{}, err
+		}
+		log.WithFields(log.Fields{"UUID": m.UUID, "transaction_id": transactionId, "status": status}).Info("Concordance written and its change recorded")
+		return status, previous, nil
+	}
+}
+
+func (s *Client) deleteWithChange(uuid string, transactionId string) (Status, ConcordancesModel, error) {
+	for attempt := 1; ; attempt++ {
+		current, err := s.current(uuid)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error reading concordance record before deleting it")
+			return CONCORDANCE_ERROR, ConcordancesModel{}, err
+		}
+		if !current.live() {
+			return CONCORDANCE_NOT_FOUND, ConcordancesModel{}, nil
+		}
+
+		previous := current.toModel()
+		err = s.tombstone(current, newChange(CONCORDANCE_DELETED, transactionId, previous, ConcordancesModel{}))
+		if isConditionalCheckFailed(err) && attempt < outboxMaxAttempts {
+			log.WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId, "attempts": attempt}).Info("Concordance record was changed while deleting it, retrying")
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error deleting concordance record and recording its change")
+			return CONCORDANCE_ERROR, ConcordancesModel{}, err
+		}
+		return CONCORDANCE_DELETED, previous, nil
+	}
+}
+
+// tombstone marks a record as deleted, dropping its concordance, and records the change.
+func (s *Client) tombstone(current DynamoConcordancesModel, change Change) error {
+	set := []string{"#deleted = :deleted"}
+	remove := []string{"concordedIds", "identifiers", TTLAttribute, "#heldExpiresAt"}
+	values := map[string]*dynamodb.AttributeValue{":deleted": {BOOL: aws.Bool(true)}}
+	return s.recordChange(current.UUID, current, change, set, remove, values)
+}
+
+// recordChange applies an update to a record and appends the change to its outbox, on condition that the record
+// has not been changed since it was read. When the outbox is full, the change is merged into the newest pending change
+// instead, on condition that no change was acknowledged since, the oldest being the one that may be in delivery.
+func (s *Client) recordChange(uuid string, current DynamoConcordancesModel, change Change, set []string, remove []string, values map[string]*dynamodb.AttributeValue) error {
+	k, err := dynamodbattribute.Marshal(uuid)
+	if err != nil {
+		return err
+	}
+
+	pending := len(current.Outbox)
+	collapse := current.Version > 0 && pending >= MaxPendingChanges
+	outboxClause := "#outbox = list_append(if_not_exists(#outbox, :noChanges), :change)"
+	var changes *dynamodb.AttributeValue
+	if collapse {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": change.TransactionID, "pending": pending}).Warn("Outbox of concordance record is full, merging the change into the newest pending change")
+		outboxClause = "#outbox[" + strconv.Itoa(pending-1) + "] = :change"
+		changes, err = dynamodbattribute.Marshal(mergeChanges(current.Outbox[pending-1], change))
+		values[":pending"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(pending))}
+	} else {
+		changes, err = dynamodbattribute.Marshal([]Change{change})
+		values[":noChanges"] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}
+	}
+	if err != nil {
+		return err
+	}
+
+	values[":change"] = changes
+	values[":version"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(current.Version+1, 10))}
+	set, values = stamp(set, values, change.TransactionID)
+	set = append(set, outboxClause, "#version = :version")
+
+	input := &dynamodb.UpdateItemInput{}
+	input.SetTableName(s.dynamoDbTable)
+	input.SetKey(map[string]*dynamodb.AttributeValue{TableHashKey: k})
+	input.SetUpdateExpression(updateExpression(set, remove))
+	switch {
+	case current.UUID == "":
+		input.SetConditionExpression("attribute_not_exists(" + TableHashKey + ")")
+	case current.Version == 0:
+		input.SetConditionExpression("attribute_not_exists(#version)")
+	default:
+		condition := "#version = :currentVersion"
+		if collapse {
+			condition += " AND size(#outbox) = :pending"
+		}
+		input.SetConditionExpression(condition)
+		values[":currentVersion"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(current.Version, 10))}
+	}
+	input.SetExpressionAttributeNames(map[string]*string{
+		"#deleted":       aws.String(deletedAttribute),
+		"#outbox":        aws.String(outboxAttribute),
+		"#version":       aws.String(versionAttribute),
+		"#heldExpiresAt": aws.String(heldExpiresAtAttribute),
+	})
+	input.SetExpressionAttributeValues(values)
+	input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityTotal)
+
+	output, err := s.ddb.UpdateItem(input)
+	if err != nil {
+		return err
+	}
+	s.consumed(output.ConsumedCapacity, true)
+	return nil
+}
+
+// holdExpiry moves the expiry set by an update out of the TTL attribute, into the attribute it is held in until the
+// outbox of the record is empty.
+func holdExpiry(set []string, remove []string) ([]string, []string) {
+	for i, clause := range set {
+		if clause == TTLAttribute+" = :expiresAt" {
+			set[i] = "#heldExpiresAt = :expiresAt"
+			return set, append(remove, TTLAttribute)
+		}
+	}
+	return set, append(remove, "#heldExpiresAt")
+}
+
+// releaseExpiry moves the expiry of a record into the TTL attribute, on condition that its outbox is still empty.
+func (s *Client) releaseExpiry(uuid string, expiresAt int64) error {
+	k, err := dynamodbattribute.Marshal(uuid)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.UpdateItemInput{}
+	input.SetTableName(s.dynamoDbTable)
+	input.SetKey(map[string]*dynamodb.AttributeValue{TableHashKey: k})
+	input.SetUpdateExpression("SET " + TTLAttribute + " = :expiresAt REMOVE #heldExpiresAt")
+	input.SetConditionExpression("#heldExpiresAt = :expiresAt AND size(#outbox) = :zero")
+	input.SetExpressionAttributeNames(map[string]*string{"#heldExpiresAt": aws.String(heldExpiresAtAttribute), "#outbox": aws.String(outboxAttribute)})
+	input.SetExpressionAttributeValues(map[string]*dynamodb.AttributeValue{
+		":expiresAt": {N: aws.String(strconv.FormatInt(expiresAt, 10))},
+		":zero":      {N: aws.String("0")},
+	})
+	input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityTotal)
+
+	output, err := s.ddb.UpdateItem(input)
+	if isConditionalCheckFailed(err) {
+		return nil
+	}
+	if err != nil {
+		log.WithError(err).WithField("UUID", uuid).Error("Error releasing the expiry of a concordance record")
+		return err
+	}
+	s.consumed(output.ConsumedCapacity, true)
+	return nil
+}
+
+// current reads a record as it is stored, with a strongly consistent read so that it can be updated conditionally.
+func (s *Client) current(uuid string) (DynamoConcordancesModel, error) {
+	m := DynamoConcordancesModel{}
+	k, err := dynamodbattribute.Marshal(uuid)
+	if err != nil {
+		return m, err
+	}
+
+	input := &dynamodb.GetItemInput{}
+	input.SetTableName(s.dynamoDbTable)
+	input.SetKey(map[string]*dynamodb.AttributeValue{TableHashKey: k})
+	input.SetConsistentRead(true)
+	input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityTotal)
+	output, err := s.ddb.GetItem(input)
+	if err != nil {
+		return m, err
+	}
+	s.consumed(output.ConsumedCapacity, false)
+
+	err = dynamodbattribute.UnmarshalMap(output.Item, &m)
+	return m, err
+}
+
+func (s *Client) PendingChanges(uuid string) ([]Change, error) {
+	m, err := s.current(uuid)
+	if err != nil {
+		log.WithError(err).WithField("UUID", uuid).Error("Error reading the outbox of a concordance record")
+		return nil, err
+	}
+	return m.Outbox, nil
+}
+
+func (s *Client) AcknowledgeChange(uuid string, changeId string) error {
+	k, err := dynamodbattribute.Marshal(uuid)
+	if err != nil {
+		return err
+	}
+	key := map[string]*dynamodb.AttributeValue{TableHashKey: k}
+	names := map[string]*string{"#outbox": aws.String(outboxAttribute), "#id": aws.String("id")}
+
+	input := &dynamodb.UpdateItemInput{}
+	input.SetTableName(s.dynamoDbTable)
+	input.SetKey(key)
+	input.SetUpdateExpression("REMOVE #outbox[0]")
+	input.SetConditionExpression("#outbox[0].#id = :id")
+	input.SetExpressionAttributeNames(names)
+	input.SetExpressionAttributeValues(map[string]*dynamodb.AttributeValue{":id": {S: aws.String(changeId)}})
+	input.SetReturnValues(dynamodb.ReturnValueAllNew)
+	input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityTotal)
+
+	output, err := s.ddb.UpdateItem(input)
+	if isConditionalCheckFailed(err) {
+		log.WithFields(log.Fields{"UUID": uuid, "change_id": changeId}).Info("Change was already acknowledged")
+		return nil
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "change_id": changeId}).Error("Error acknowledging change of a concordance record")
+		return err
+	}
+	s.consumed(output.ConsumedCapacity, true)
+
+	m := DynamoConcordancesModel{}
+	if err := dynamodbattribute.UnmarshalMap(output.Attributes, &m); err != nil {
+		return err
+	}
+	if len(m.Outbox) > 0 {
+		return nil
+	}
+	if !m.Deleted {
+		if m.HeldExpiresAt > 0 {
+			return s.releaseExpiry(uuid, m.HeldExpiresAt)
+		}
+		return nil
+	}
+
+	// The deletion of the record has been announced, so it is no longer needed.
+	deleteInput := &dynamodb.DeleteItemInput{}
+	deleteInput.SetTableName(s.dynamoDbTable)
+	deleteInput.SetKey(key)
+	deleteInput.SetConditionExpression("#deleted = :deleted AND size(#outbox) = :zero")
+	deleteInput.SetExpressionAttributeNames(map[string]*string{"#deleted": aws.String(deletedAttribute), "#outbox": aws.String(outboxAttribute)})
+	deleteInput.SetExpressionAttributeValues(map[string]*dynamodb.AttributeValue{":deleted": {BOOL: aws.Bool(true)}, ":zero": {N: aws.String("0")}})
+	deleteInput.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityTotal)
+	deleteOutput, err := s.ddb.DeleteItem(deleteInput)
+	if isConditionalCheckFailed(err) {
+		return nil
+	}
+	if err != nil {
+		log.WithError(err).WithField("UUID", uuid).Error("Error removing deleted concordance record")
+		return err
+	}
+	s.consumed(deleteOutput.ConsumedCapacity, true)
+	return nil
+}
+
+func (s *Client) ScanPending(fn func(uuid string) error) error {
+	input := &dynamodb.ScanInput{}
+	input.SetTableName(s.dynamoDbTable)
+	input.SetFilterExpression("size(#outbox) > :zero")
+	input.SetProjectionExpression(TableHashKey)
+	input.SetExpressionAttributeNames(map[string]*string{"#outbox": aws.String(outboxAttribute)})
+	input.SetExpressionAttributeValues(map[string]*dynamodb.AttributeValue{":zero": {N: aws.String("0")}})
+
+	var fnErr error
+	err := s.ddb.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if fnErr = fn(aws.StringValue(item[TableHashKey].S)); fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		log.WithError(err).WithField("table", s.dynamoDbTable).Error("Error scanning for concordance records with pending changes")
+		return err
+	}
+	return fnErr
+}
+
+func isConditionalCheckFailed(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
@@ -0,0 +1,384 @@
+package dynamodb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockOutboxAPI struct {
+	dynamodbiface.DynamoDBAPI
+	item             DynamoConcordancesModel
+	conflicts        int
+	updates          []*dynamodb.UpdateItemInput
+	deletes          []*dynamodb.DeleteItemInput
+	acknowledgedItem DynamoConcordancesModel
+}
+
+func (m *mockOutboxAPI) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	if m.item.UUID == "" {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	item, err := dynamodbattribute.MarshalMap(m.item)
+	return &dynamodb.GetItemOutput{Item: item}, err
+}
+
+func (m *mockOutboxAPI) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	m.updates = append(m.updates, input)
+	if m.conflicts > 0 {
+		m.conflicts--
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	attributes, err := dynamodbattribute.MarshalMap(m.acknowledgedItem)
+	return &dynamodb.UpdateItemOutput{Attributes: attributes}, err
+}
+
+func (m *mockOutboxAPI) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	m.deletes = append(m.deletes, input)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func recordedChange(t *testing.T, input *dynamodb.UpdateItemInput) Change {
+	changes := []Change{}
+	assert.NoError(t, dynamodbattribute.Unmarshal(input.ExpressionAttributeValues[":change"], &changes))
+	assert.Len(t, changes, 1, "One change should be appended to the outbox")
+	return changes[0]
+}
+
+func TestWriteWithOutbox_Create(t *testing.T) {
+	api := &mockOutboxAPI{}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	status, previous, err := client.Write(identifiersModel, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, CONCORDANCE_CREATED, status)
+	assert.Equal(t, ConcordancesModel{}, previous)
+	assert.Len(t, api.updates, 1)
+
+	input := api.updates[0]
+	assert.NoError(t, input.Validate(), "Update Input is not valid")
+	assert.Equal(t, "SET concordedIds = :concordedIds, identifiers = :identifiers, lastModified = :lastModified, transactionId = :transactionId, #outbox = list_append(if_not_exists(#outbox, :noChanges), :change), #version = :version REMOVE expiresAt, #heldExpiresAt, #deleted", *input.UpdateExpression)
+	assert.Equal(t, "attribute_not_exists(conceptId)", *input.ConditionExpression)
+	assert.Equal(t, "1", *input.ExpressionAttributeValues[":version"].N)
+	assert.Equal(t, "test_transaction_id", *input.ExpressionAttributeValues[":transactionId"].S, "Transaction id should be stamped on the record")
+
+	change := recordedChange(t, input)
+	assert.NotEmpty(t, change.ID)
+	assert.Equal(t, CONCORDANCE_CREATED, change.Status)
+	assert.Equal(t, "test_transaction_id", change.TransactionID)
+	assert.Empty(t, change.OldConcordedIds)
+	assert.Equal(t, identifiersModel.ConcordedIds, change.NewConcordedIds)
+	assert.Equal(t, []string{"TME", "FACTSET"}, change.Authorities)
+}
+
+func TestWriteWithOutbox_UpdateIsConditionalOnVersion(t *testing.T) {
+	api := &mockOutboxAPI{item: DynamoConcordancesModel{UUID: UUID, ConcordedIds: []string{"A"}, Version: 2}}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	status, previous, err := client.Write(goodModel, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, CONCORDANCE_UPDATED, status)
+	assert.Equal(t, []string{"A"}, previous.ConcordedIds)
+
+	input := api.updates[0]
+	assert.Equal(t, "#version = :currentVersion", *input.ConditionExpression)
+	assert.Equal(t, "2", *input.ExpressionAttributeValues[":currentVersion"].N)
+	assert.Equal(t, "3", *input.ExpressionAttributeValues[":version"].N)
+	assert.Equal(t, []string{"A"}, recordedChange(t, input).OldConcordedIds)
+}
+
+func TestWriteWithOutbox_MergesChangeIntoFullOutbox(t *testing.T) {
+	item := DynamoConcordancesModel{UUID: UUID, ConcordedIds: []string{"B"}, Version: 12}
+	for i := 0; i < MaxPendingChanges; i++ {
+		item.Outbox = append(item.Outbox, Change{ID: strconv.Itoa(i), Status: CONCORDANCE_UPDATED, OldConcordedIds: []string{"A"}, NewConcordedIds: []string{"B"}, Authorities: []string{"TME"}})
+	}
+	api := &mockOutboxAPI{item: item}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	status, _, err := client.Write(identifiersModel, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, CONCORDANCE_UPDATED, status)
+	input := api.updates[0]
+	assert.NoError(t, input.Validate(), "Update Input is not valid")
+	assert.Contains(t, *input.UpdateExpression, "#outbox[9] = :change", "Change should be merged into the newest pending change")
+	assert.NotContains(t, *input.UpdateExpression, "list_append", "Full outbox should not grow")
+	assert.Equal(t, "#version = :currentVersion AND size(#outbox) = :pending", *input.ConditionExpression, "Merge should fail when a change was acknowledged since")
+	assert.Equal(t, "10", *input.ExpressionAttributeValues[":pending"].N)
+
+	merged := Change{}
+	assert.NoError(t, dynamodbattribute.Unmarshal(input.ExpressionAttributeValues[":change"], &merged))
+	assert.NotEqual(t, "9", merged.ID)
+	assert.Equal(t, CONCORDANCE_UPDATED, merged.Status)
+	assert.Equal(t, "test_transaction_id", merged.TransactionID)
+	assert.Equal(t, []string{"A"}, merged.OldConcordedIds, "Merged change should be from the concordance before the pending change")
+	assert.Equal(t, identifiersModel.ConcordedIds, merged.NewConcordedIds)
+	assert.Equal(t, []string{"TME", "FACTSET"}, merged.Authorities)
+}
+
+func TestMergeChanges(t *testing.T) {
+	testCases := []struct {
+		older    Status
+		newer    Status
+		expected Status
+	}{
+		{CONCORDANCE_CREATED, CONCORDANCE_UPDATED, CONCORDANCE_CREATED},
+		{CONCORDANCE_CREATED, CONCORDANCE_DELETED, CONCORDANCE_DELETED},
+		{CONCORDANCE_UPDATED, CONCORDANCE_UPDATED, CONCORDANCE_UPDATED},
+		{CONCORDANCE_UPDATED, CONCORDANCE_DELETED, CONCORDANCE_DELETED},
+		{CONCORDANCE_DELETED, CONCORDANCE_CREATED, CONCORDANCE_UPDATED},
+	}
+	for _, testCase := range testCases {
+		merged := mergeChanges(Change{Status: testCase.older}, Change{Status: testCase.newer})
+		assert.Equal(t, testCase.expected, merged.Status, "Merging %v and %v", testCase.older, testCase.newer)
+	}
+}
+
+func TestWriteWithOutbox_RecordWrittenWithoutOutbox(t *testing.T) {
+	api := &mockOutboxAPI{item: DynamoConcordancesModel{UUID: UUID, ConcordedIds: []string{"A"}}}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	_, _, err := client.Write(goodModel, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "attribute_not_exists(#version)", *api.updates[0].ConditionExpression)
+}
+
+func TestWriteWithOutbox_RetriesConcurrentChange(t *testing.T) {
+	api := &mockOutboxAPI{conflicts: 1}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	status, _, err := client.Write(goodModel, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, CONCORDANCE_CREATED, status)
+	assert.Len(t, api.updates, 2, "Write should be retried when the record changed since it was read")
+
+	api = &mockOutboxAPI{conflicts: outboxMaxAttempts}
+	client = Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	status, _, err = client.Write(goodModel, "test_transaction_id")
+
+	assert.Error(t, err)
+	assert.Equal(t, CONCORDANCE_ERROR, status)
+	assert.Len(t, api.updates, outboxMaxAttempts)
+}
+
+func TestWriteWithOutbox_HoldsExpiry(t *testing.T) {
+	api := &mockOutboxAPI{}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+	model := identifiersModel
+	expiresAt := time.Unix(1893456000, 0)
+	model.ExpiresAt = &expiresAt
+
+	_, _, err := client.Write(model, "test_transaction_id")
+
+	assert.NoError(t, err)
+	input := api.updates[0]
+	assert.NoError(t, input.Validate(), "Update Input is not valid")
+	assert.Equal(t, "SET concordedIds = :concordedIds, identifiers = :identifiers, #heldExpiresAt = :expiresAt, lastModified = :lastModified, transactionId = :transactionId, #outbox = list_append(if_not_exists(#outbox, :noChanges), :change), #version = :version REMOVE expiresAt, #deleted", *input.UpdateExpression, "Expiry should be held until the change has been delivered")
+	assert.Equal(t, "1893456000", *input.ExpressionAttributeValues[":expiresAt"].N)
+}
+
+func TestReadWithOutbox_HidesRecordWithHeldExpiry(t *testing.T) {
+	api := &mockOutboxAPI{item: DynamoConcordancesModel{UUID: UUID, ConcordedIds: []string{"A"}, Version: 1, HeldExpiresAt: time.Now().Add(-time.Minute).Unix()}}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	model, err := client.Read(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, ConcordancesModel{}, model)
+}
+
+func TestDeleteWithOutbox(t *testing.T) {
+	api := &mockOutboxAPI{item: DynamoConcordancesModel{UUID: UUID, ConcordedIds: []string{"A"}, Version: 1}}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	status, previous, err := client.Delete(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, CONCORDANCE_DELETED, status)
+	assert.Equal(t, []string{"A"}, previous.ConcordedIds)
+	assert.Empty(t, api.deletes, "Record should be kept until its deletion has been announced")
+
+	input := api.updates[0]
+	assert.NoError(t, input.Validate(), "Update Input is not valid")
+	assert.Equal(t, "SET #deleted = :deleted, lastModified = :lastModified, transactionId = :transactionId, #outbox = list_append(if_not_exists(#outbox, :noChanges), :change), #version = :version REMOVE concordedIds, identifiers, expiresAt, #heldExpiresAt", *input.UpdateExpression)
+	change := recordedChange(t, input)
+	assert.Equal(t, CONCORDANCE_DELETED, change.Status)
+	assert.Equal(t, []string{"A"}, change.OldConcordedIds)
+	assert.Empty(t, change.NewConcordedIds)
+}
+
+func TestDeleteWithOutbox_NotFound(t *testing.T) {
+	for desc, item := range map[string]DynamoConcordancesModel{
+		"Missing record": {},
+		"Deleted record": {UUID: UUID, Deleted: true, Version: 1},
+		"Expired record": {UUID: UUID, ConcordedIds: []string{"A"}, ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			api := &mockOutboxAPI{item: item}
+			client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+			status, _, err := client.Delete(UUID, "test_transaction_id")
+
+			assert.NoError(t, err)
+			assert.Equal(t, CONCORDANCE_NOT_FOUND, status)
+			assert.Empty(t, api.updates, "Nothing should be recorded for a record that does not exist")
+		})
+	}
+}
+
+func TestReadDeletedRecord(t *testing.T) {
+	api := &mockOutboxAPI{item: DynamoConcordancesModel{UUID: UUID, Deleted: true, Version: 1}}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	model, err := client.Read(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, ConcordancesModel{}, model, "Deleted record should not be found")
+}
+
+func TestExpireRecordWithOutbox(t *testing.T) {
+	api := &mockOutboxAPI{item: DynamoConcordancesModel{UUID: UUID, ConcordedIds: []string{"A"}, ExpiresAt: time.Now().Add(-time.Minute).Unix()}}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	model, err := client.Read(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, ConcordancesModel{}, model, "Expired record was not hidden")
+	assert.Empty(t, api.updates, "Reading an expired record should not change it")
+
+	model, err = client.Expire(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.True(t, model.Expired)
+	assert.Empty(t, api.deletes, "Expired record should be kept until its deletion has been announced")
+	assert.Len(t, api.updates, 1)
+	assert.Equal(t, CONCORDANCE_DELETED, recordedChange(t, api.updates[0]).Status, "Expiry should be recorded as a deletion")
+}
+
+func TestExpireReconfirmedRecordWithOutbox(t *testing.T) {
+	api := &mockOutboxAPI{item: DynamoConcordancesModel{UUID: UUID, ConcordedIds: []string{"A"}, ExpiresAt: time.Now().Add(time.Hour).Unix()}}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	model, err := client.Expire(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, ConcordancesModel{}, model)
+	assert.Empty(t, api.updates, "Re-confirmed record should not be expired")
+}
+
+func TestAcknowledgeChange(t *testing.T) {
+	api := &mockOutboxAPI{acknowledgedItem: DynamoConcordancesModel{UUID: UUID, ConcordedIds: []string{"A"}, Version: 1}}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	err := client.AcknowledgeChange(UUID, "change-1")
+
+	assert.NoError(t, err)
+	input := api.updates[0]
+	assert.NoError(t, input.Validate(), "Update Input is not valid")
+	assert.Equal(t, "REMOVE #outbox[0]", *input.UpdateExpression)
+	assert.Equal(t, "#outbox[0].#id = :id", *input.ConditionExpression)
+	assert.Equal(t, "change-1", *input.ExpressionAttributeValues[":id"].S)
+	assert.Empty(t, api.deletes, "Record should not be deleted")
+}
+
+func TestAcknowledgeChange_RemovesAnnouncedDeletion(t *testing.T) {
+	api := &mockOutboxAPI{acknowledgedItem: DynamoConcordancesModel{UUID: UUID, Deleted: true, Version: 2}}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	err := client.AcknowledgeChange(UUID, "change-1")
+
+	assert.NoError(t, err)
+	assert.Len(t, api.deletes, 1, "Deleted record should be removed once its deletion has been announced")
+	assert.Equal(t, "#deleted = :deleted AND size(#outbox) = :zero", *api.deletes[0].ConditionExpression)
+}
+
+func TestAcknowledgeChange_ReleasesHeldExpiry(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	api := &mockOutboxAPI{acknowledgedItem: DynamoConcordancesModel{UUID: UUID, ConcordedIds: []string{"A"}, Version: 1, HeldExpiresAt: expiresAt}}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	err := client.AcknowledgeChange(UUID, "change-1")
+
+	assert.NoError(t, err)
+	assert.Len(t, api.updates, 2, "Expiry should be released once the outbox is empty")
+	input := api.updates[1]
+	assert.NoError(t, input.Validate(), "Update Input is not valid")
+	assert.Equal(t, "SET expiresAt = :expiresAt REMOVE #heldExpiresAt", *input.UpdateExpression)
+	assert.Equal(t, "#heldExpiresAt = :expiresAt AND size(#outbox) = :zero", *input.ConditionExpression)
+	assert.Equal(t, strconv.FormatInt(expiresAt, 10), *input.ExpressionAttributeValues[":expiresAt"].N)
+}
+
+func TestAcknowledgeChange_KeepsExpiryHeldWhileChangesArePending(t *testing.T) {
+	api := &mockOutboxAPI{acknowledgedItem: DynamoConcordancesModel{UUID: UUID, ConcordedIds: []string{"A"}, Version: 2, HeldExpiresAt: time.Now().Add(time.Hour).Unix(), Outbox: []Change{{ID: "change-2"}}}}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	err := client.AcknowledgeChange(UUID, "change-1")
+
+	assert.NoError(t, err)
+	assert.Len(t, api.updates, 1, "Expiry should be held while changes are pending")
+}
+
+func TestAcknowledgeChange_AlreadyAcknowledged(t *testing.T) {
+	api := &mockOutboxAPI{conflicts: 1}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api, outbox: true}
+
+	err := client.AcknowledgeChange(UUID, "change-1")
+
+	assert.NoError(t, err, "Acknowledging a change twice should not fail")
+}
+
+func TestAuthorities(t *testing.T) {
+	assert.Equal(t, []string{"TME", "FACTSET", "WIKIDATA"}, Authorities(identifiersModel, ConcordancesModel{Identifiers: []Identifier{
+		{Authority: "WIKIDATA", IdentifierValue: "Q1", UUID: "A"},
+		{Authority: "TME", IdentifierValue: "T1", UUID: "B"},
+	}}))
+	assert.Empty(t, Authorities(goodModel))
+}
+
+func TestOutboxWriteDeleteAndAcknowledge(t *testing.T) {
+	tearDownTestCase := setupTestCase(t)
+	defer tearDownTestCase(t)
+	client := Client{dynamoDbTable: DDB_TABLE, awsRegion: AWS_REGION, ddb: db, outbox: true}
+
+	_, _, err := client.Write(goodModel, "test_transaction_id_1")
+	assert.NoError(t, err, "Failed to write concordance.")
+	status, _, err := client.Delete(UUID, "test_transaction_id_2")
+	assert.NoError(t, err, "Failed to delete concordance.")
+	assert.Equal(t, CONCORDANCE_DELETED, status)
+
+	model, err := client.Read(UUID, "test_transaction_id")
+	assert.NoError(t, err)
+	assert.Equal(t, ConcordancesModel{}, model, "Deleted concordance should not be found")
+
+	pending := []string{}
+	assert.NoError(t, client.ScanPending(func(uuid string) error {
+		pending = append(pending, uuid)
+		return nil
+	}))
+	assert.Equal(t, []string{UUID}, pending)
+
+	changes, err := client.PendingChanges(UUID)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, CONCORDANCE_CREATED, changes[0].Status)
+	assert.Equal(t, CONCORDANCE_DELETED, changes[1].Status)
+
+	for _, change := range changes {
+		assert.NoError(t, client.AcknowledgeChange(UUID, change.ID))
+	}
+	output, err := db.GetItem(&dynamodb.GetItemInput{TableName: aws.String(DDB_TABLE), Key: map[string]*dynamodb.AttributeValue{TableHashKey: {S: aws.String(UUID)}}})
+	assert.NoError(t, err)
+	assert.Nil(t, output.Item, "Deleted record should be removed once its deletion has been announced")
+}
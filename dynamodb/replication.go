@@ -0,0 +1,254 @@
+package dynamodb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ReplicationSync  = "sync"
+	ReplicationAsync = "async"
+
+	replicationQueueSize   = 1000
+	replicationMaxAttempts = 5
+)
+
+var errNoExpiry = errors.New("primary table cannot expire records")
+
+// Replicator is implemented by clients that copy every change to a secondary table.
+type Replicator interface {
+	SecondaryHealthcheck() error
+	Pending() int
+	Divergences() int64
+}
+
+type replicationJob struct {
+	delete        bool
+	model         ConcordancesModel
+	uuid          string
+	transactionId string
+	primaryStatus Status
+	// primaryPrevious is the record the primary table held before the change.
+	primaryPrevious ConcordancesModel
+	// expiry is set for the deletion of an expired record, which DynamoDB may already have purged from the secondary table.
+	expiry   bool
+	attempts int
+}
+
+// ReplicatingClient writes to a primary table and replicates every write and delete to a secondary table,
+// either synchronously or asynchronously through a retry queue. Reads are served from the primary table only.
+// Changes the secondary table could not take synchronously are retried through the queue as well, since the primary
+// table is already written by then.
+type ReplicatingClient struct {
+	primary     Clienter
+	secondary   Clienter
+	mode        string
+	queue       chan replicationJob
+	retryDelay  time.Duration
+	pending     int64
+	divergences int64
+}
+
+func NewReplicatingClient(primary Clienter, secondary Clienter, mode string) (*ReplicatingClient, error) {
+	if mode != ReplicationSync && mode != ReplicationAsync {
+		return nil, fmt.Errorf("unknown replication mode (%s), expected %s or %s", mode, ReplicationSync, ReplicationAsync)
+	}
+	c := &ReplicatingClient{primary: primary, secondary: secondary, mode: mode, retryDelay: time.Second, queue: make(chan replicationJob, replicationQueueSize)}
+	go c.replicate()
+	return c, nil
+}
+
+func (c *ReplicatingClient) Read(uuid string, transactionId string) (ConcordancesModel, error) {
+	return c.primary.Read(uuid, transactionId)
+}
+
+func (c *ReplicatingClient) Write(m ConcordancesModel, transactionId string) (Status, ConcordancesModel, error) {
+	status, previous, err := c.primary.Write(m, transactionId)
+	if err != nil {
+		return status, previous, err
+	}
+	return c.replicateOrQueue(replicationJob{model: m, uuid: m.UUID, transactionId: transactionId, primaryStatus: status, primaryPrevious: previous}), previous, nil
+}
+
+func (c *ReplicatingClient) Delete(uuid string, transactionId string) (Status, ConcordancesModel, error) {
+	status, previous, err := c.primary.Delete(uuid, transactionId)
+	if err != nil {
+		return status, previous, err
+	}
+	return c.replicateOrQueue(replicationJob{delete: true, uuid: uuid, transactionId: transactionId, primaryStatus: status, primaryPrevious: previous}), previous, nil
+}
+
+func (c *ReplicatingClient) Healthcheck() error {
+	return c.primary.Healthcheck()
+}
+
+func (c *ReplicatingClient) Stats() (TableStats, error) {
+	return c.primary.Stats()
+}
+
+// Scan reads every concordance record of the primary table.
+func (c *ReplicatingClient) Scan(fn func(ConcordancesModel) error) error {
+	scanner, ok := c.primary.(Scanner)
+	if !ok {
+		return errors.New("primary table cannot be scanned")
+	}
+	return scanner.Scan(fn)
+}
+
+// PendingChanges, AcknowledgeChange and ScanPending use the outbox of the primary table. Deletes are replicated as such,
+// so the secondary table holds no outbox.
+func (c *ReplicatingClient) PendingChanges(uuid string) ([]Change, error) {
+	outbox, ok := c.primary.(Outbox)
+	if !ok {
+		return nil, errNoOutbox
+	}
+	return outbox.PendingChanges(uuid)
+}
+
+func (c *ReplicatingClient) AcknowledgeChange(uuid string, changeId string) error {
+	outbox, ok := c.primary.(Outbox)
+	if !ok {
+		return errNoOutbox
+	}
+	return outbox.AcknowledgeChange(uuid, changeId)
+}
+
+func (c *ReplicatingClient) ScanPending(fn func(uuid string) error) error {
+	outbox, ok := c.primary.(Outbox)
+	if !ok {
+		return errNoOutbox
+	}
+	return outbox.ScanPending(fn)
+}
+
+// ScanExpired and Expire purge expired records from the primary table, and replicate their deletion to the secondary table.
+func (c *ReplicatingClient) ScanExpired(fn func(uuid string) error) error {
+	expirer, ok := c.primary.(Expirer)
+	if !ok {
+		return errNoExpiry
+	}
+	return expirer.ScanExpired(fn)
+}
+
+func (c *ReplicatingClient) Expire(uuid string, transactionId string) (ConcordancesModel, error) {
+	expirer, ok := c.primary.(Expirer)
+	if !ok {
+		return ConcordancesModel{}, errNoExpiry
+	}
+	expired, err := expirer.Expire(uuid, transactionId)
+	if err != nil || !expired.Expired {
+		return expired, err
+	}
+	c.replicateOrQueue(replicationJob{delete: true, expiry: true, uuid: uuid, transactionId: transactionId, primaryStatus: CONCORDANCE_DELETED, primaryPrevious: expired})
+	return expired, nil
+}
+
+func (c *ReplicatingClient) SecondaryHealthcheck() error {
+	if err := c.secondary.Healthcheck(); err != nil {
+		return err
+	}
+	if c.Pending() >= replicationQueueSize {
+		return errors.New("replication queue to the secondary table is full")
+	}
+	return nil
+}
+
+// Pending returns the number of changes queued for replication to the secondary table.
+func (c *ReplicatingClient) Pending() int {
+	return int(atomic.LoadInt64(&c.pending))
+}
+
+// Divergences returns the number of changes for which the secondary table was found to differ from the primary.
+func (c *ReplicatingClient) Divergences() int64 {
+	return atomic.LoadInt64(&c.divergences)
+}
+
+// replicateOrQueue never fails the change, which is committed to the primary table: in sync mode a change the secondary
+// table could not take is queued for retry like in async mode.
+func (c *ReplicatingClient) replicateOrQueue(job replicationJob) Status {
+	if c.mode == ReplicationSync && c.apply(&job) == nil {
+		return job.primaryStatus
+	}
+
+	atomic.AddInt64(&c.pending, 1)
+	select {
+	case c.queue <- job:
+	default:
+		atomic.AddInt64(&c.pending, -1)
+		atomic.AddInt64(&c.divergences, 1)
+		log.WithFields(log.Fields{"UUID": job.uuid, "transaction_id": job.transactionId}).Error("Replication queue is full, change will not be replicated to the secondary table")
+	}
+	return job.primaryStatus
+}
+
+func (c *ReplicatingClient) replicate() {
+	for job := range c.queue {
+		err := c.apply(&job)
+		if err != nil && job.attempts < replicationMaxAttempts {
+			go c.retry(job)
+			continue
+		}
+		if err != nil {
+			atomic.AddInt64(&c.divergences, 1)
+			log.WithError(err).WithFields(log.Fields{"UUID": job.uuid, "transaction_id": job.transactionId, "attempts": job.attempts}).Error("Giving up replicating change to the secondary table")
+		}
+		atomic.AddInt64(&c.pending, -1)
+	}
+}
+
+func (c *ReplicatingClient) retry(job replicationJob) {
+	time.Sleep(c.retryDelay * time.Duration(job.attempts))
+	c.queue <- job
+}
+
+func (c *ReplicatingClient) apply(job *replicationJob) error {
+	job.attempts++
+
+	var status Status
+	var previous ConcordancesModel
+	var err error
+	if job.delete {
+		status, previous, err = c.secondary.Delete(job.uuid, job.transactionId)
+	} else {
+		status, previous, err = c.secondary.Write(job.model, job.transactionId)
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"UUID": job.uuid, "transaction_id": job.transactionId, "attempts": job.attempts}).Warn("Error replicating change to the secondary table")
+		return err
+	}
+
+	if diverged(*job, status, previous) {
+		atomic.AddInt64(&c.divergences, 1)
+		log.WithFields(log.Fields{"UUID": job.uuid, "transaction_id": job.transactionId, "primary_status": job.primaryStatus, "secondary_status": status}).Warn("Secondary table has diverged from the primary table")
+	}
+	return nil
+}
+
+// diverged reports whether the secondary table held a different version of the record than the primary before the change,
+// e.g. the record was created in the primary table but already existed in the secondary table, or was updated from
+// different concordances.
+func diverged(job replicationJob, secondaryStatus Status, secondaryPrevious ConcordancesModel) bool {
+	// A retried change may already have been applied to the secondary table by an earlier attempt.
+	if job.attempts > 1 {
+		return false
+	}
+	if job.expiry && secondaryStatus == CONCORDANCE_NOT_FOUND {
+		return false
+	}
+	return secondaryStatus != job.primaryStatus || !sameConcordance(job.primaryPrevious, secondaryPrevious)
+}
+
+// sameConcordance compares the concordances of two records, leaving out when each table last modified them.
+func sameConcordance(a ConcordancesModel, b ConcordancesModel) bool {
+	a.LastModified, b.LastModified = nil, nil
+	a.Expired, b.Expired = false, false
+	if a.ExpiresAt != nil && b.ExpiresAt != nil && a.ExpiresAt.Equal(*b.ExpiresAt) {
+		a.ExpiresAt, b.ExpiresAt = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
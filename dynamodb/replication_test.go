@@ -0,0 +1,225 @@
+package dynamodb
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	sync.Mutex
+	records  map[string]ConcordancesModel
+	failures int
+	calls    int
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{records: map[string]ConcordancesModel{}}
+}
+
+func (c *fakeClient) fail() error {
+	c.calls++
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("secondary table error")
+	}
+	return nil
+}
+
+func (c *fakeClient) Read(uuid string, transactionId string) (ConcordancesModel, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.records[uuid], nil
+}
+
+func (c *fakeClient) Write(m ConcordancesModel, transactionId string) (Status, ConcordancesModel, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.fail(); err != nil {
+		return CONCORDANCE_ERROR, ConcordancesModel{}, err
+	}
+	previous, found := c.records[m.UUID]
+	c.records[m.UUID] = m
+	if found {
+		return CONCORDANCE_UPDATED, previous, nil
+	}
+	return CONCORDANCE_CREATED, previous, nil
+}
+
+func (c *fakeClient) Delete(uuid string, transactionId string) (Status, ConcordancesModel, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.fail(); err != nil {
+		return CONCORDANCE_ERROR, ConcordancesModel{}, err
+	}
+	previous, found := c.records[uuid]
+	if !found {
+		return CONCORDANCE_NOT_FOUND, previous, nil
+	}
+	delete(c.records, uuid)
+	return CONCORDANCE_DELETED, previous, nil
+}
+
+func (c *fakeClient) Healthcheck() error {
+	return nil
+}
+
+func (c *fakeClient) Stats() (TableStats, error) {
+	return TableStats{}, nil
+}
+
+func (c *fakeClient) ScanExpired(fn func(uuid string) error) error {
+	for _, uuid := range []string{UUID} {
+		if err := fn(uuid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Expire treats every record as expired.
+func (c *fakeClient) Expire(uuid string, transactionId string) (ConcordancesModel, error) {
+	c.Lock()
+	defer c.Unlock()
+	expired, found := c.records[uuid]
+	if !found {
+		return ConcordancesModel{}, nil
+	}
+	delete(c.records, uuid)
+	expired.Expired = true
+	return expired, nil
+}
+
+func (c *fakeClient) record(uuid string) (ConcordancesModel, bool) {
+	c.Lock()
+	defer c.Unlock()
+	m, found := c.records[uuid]
+	return m, found
+}
+
+func TestNewReplicatingClient_UnknownMode(t *testing.T) {
+	_, err := NewReplicatingClient(newFakeClient(), newFakeClient(), "eventually")
+	assert.Error(t, err, "Unknown replication mode was accepted")
+}
+
+func TestReplicatingClient_SyncWritesBothTables(t *testing.T) {
+	primary, secondary := newFakeClient(), newFakeClient()
+	c, _ := NewReplicatingClient(primary, secondary, ReplicationSync)
+
+	status, _, err := c.Write(goodModel, "test_transaction_id")
+
+	assert.NoError(t, err, "Failed to write concordance.")
+	assert.Equal(t, CONCORDANCE_CREATED, status)
+	replicated, found := secondary.record(UUID)
+	assert.True(t, found, "Concordance was not replicated to the secondary table")
+	assert.Equal(t, goodModel, replicated)
+
+	status, _, err = c.Delete(UUID, "test_transaction_id")
+
+	assert.NoError(t, err, "Failed to delete concordance.")
+	assert.Equal(t, CONCORDANCE_DELETED, status)
+	_, found = secondary.record(UUID)
+	assert.False(t, found, "Deletion was not replicated to the secondary table")
+	assert.Equal(t, int64(0), c.Divergences())
+}
+
+func TestReplicatingClient_SyncQueuesRetryWhenSecondaryFails(t *testing.T) {
+	primary, secondary := newFakeClient(), newFakeClient()
+	secondary.failures = 1
+	c, _ := NewReplicatingClient(primary, secondary, ReplicationSync)
+	c.retryDelay = time.Millisecond
+
+	status, _, err := c.Write(goodModel, "test_transaction_id")
+
+	assert.NoError(t, err, "Secondary failure should not fail a change committed to the primary table")
+	assert.Equal(t, CONCORDANCE_CREATED, status)
+	waitForReplication(t, c)
+	replicated, found := secondary.record(UUID)
+	assert.True(t, found, "Concordance was not replicated after retrying")
+	assert.Equal(t, goodModel, replicated)
+	assert.Equal(t, int64(0), c.Divergences())
+}
+
+func TestReplicatingClient_DetectsDivergence(t *testing.T) {
+	primary, secondary := newFakeClient(), newFakeClient()
+	secondary.records[UUID] = ConcordancesModel{UUID: UUID, ConcordedIds: []string{"stale"}}
+	c, _ := NewReplicatingClient(primary, secondary, ReplicationSync)
+
+	status, _, err := c.Write(goodModel, "test_transaction_id")
+
+	assert.NoError(t, err, "Failed to write concordance.")
+	assert.Equal(t, CONCORDANCE_CREATED, status)
+	assert.Equal(t, int64(1), c.Divergences(), "Record existing only in the secondary table was not detected")
+}
+
+func TestReplicatingClient_DetectsDivergentUpdate(t *testing.T) {
+	primary, secondary := newFakeClient(), newFakeClient()
+	lastModified := time.Now()
+	primary.records[UUID] = ConcordancesModel{UUID: UUID, ConcordedIds: []string{"current"}, LastModified: &lastModified}
+	secondary.records[UUID] = ConcordancesModel{UUID: UUID, ConcordedIds: []string{"current"}}
+	c, _ := NewReplicatingClient(primary, secondary, ReplicationSync)
+
+	_, _, err := c.Write(goodModel, "test_transaction_id")
+
+	assert.NoError(t, err, "Failed to write concordance.")
+	assert.Equal(t, int64(0), c.Divergences(), "Records differing only by their modification time should not diverge")
+
+	secondary.records[UUID] = ConcordancesModel{UUID: UUID, ConcordedIds: []string{"stale"}}
+
+	status, _, err := c.Write(goodModel, "test_transaction_id")
+
+	assert.NoError(t, err, "Failed to write concordance.")
+	assert.Equal(t, CONCORDANCE_UPDATED, status)
+	assert.Equal(t, int64(1), c.Divergences(), "Record updated from different concordances was not detected")
+}
+
+func TestReplicatingClient_ExpiresFromBothTables(t *testing.T) {
+	primary, secondary := newFakeClient(), newFakeClient()
+	c, _ := NewReplicatingClient(primary, secondary, ReplicationSync)
+	_, _, err := c.Write(goodModel, "test_transaction_id")
+	assert.NoError(t, err, "Failed to write concordance.")
+
+	expired, err := c.Expire(UUID, "test_transaction_id")
+
+	assert.NoError(t, err, "Failed to expire concordance.")
+	assert.True(t, expired.Expired)
+	_, found := secondary.record(UUID)
+	assert.False(t, found, "Expiry was not replicated to the secondary table")
+
+	primary.records[UUID] = goodModel
+	_, err = c.Expire(UUID, "test_transaction_id")
+
+	assert.NoError(t, err, "Failed to expire concordance.")
+	assert.Equal(t, int64(0), c.Divergences(), "Record already purged from the secondary table should not diverge")
+}
+
+func TestReplicatingClient_AsyncRetriesSecondary(t *testing.T) {
+	primary, secondary := newFakeClient(), newFakeClient()
+	secondary.failures = 2
+	c, _ := NewReplicatingClient(primary, secondary, ReplicationAsync)
+	c.retryDelay = time.Millisecond
+
+	status, _, err := c.Write(goodModel, "test_transaction_id")
+
+	assert.NoError(t, err, "Secondary failure should not fail asynchronous writes")
+	assert.Equal(t, CONCORDANCE_CREATED, status)
+	_, found := primary.record(UUID)
+	assert.True(t, found, "Concordance was not written to the primary table")
+
+	waitForReplication(t, c)
+	_, found = secondary.record(UUID)
+	assert.True(t, found, "Concordance was not replicated after retrying")
+	assert.Equal(t, int64(0), c.Divergences())
+	assert.NoError(t, c.SecondaryHealthcheck())
+}
+
+func waitForReplication(t *testing.T, c *ReplicatingClient) {
+	deadline := time.Now().Add(time.Second)
+	for c.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, c.Pending(), "Replication queue was not drained")
+}
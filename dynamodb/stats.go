@@ -0,0 +1,83 @@
+package dynamodb
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	defaultStatsTTL = time.Minute
+
+	BillingModeProvisioned   = "PROVISIONED"
+	BillingModePayPerRequest = "PAY_PER_REQUEST"
+)
+
+// TableStats describes the state of a DynamoDB table, together with the capacity consumed by this client since it started.
+type TableStats struct {
+	Name                          string    `json:"name"`
+	Status                        string    `json:"status"`
+	ItemCount                     int64     `json:"itemCount"`
+	SizeBytes                     int64     `json:"sizeBytes"`
+	BillingMode                   string    `json:"billingMode"`
+	ProvisionedReadCapacityUnits  int64     `json:"provisionedReadCapacityUnits"`
+	ProvisionedWriteCapacityUnits int64     `json:"provisionedWriteCapacityUnits"`
+	ConsumedReadCapacityUnits     float64   `json:"consumedReadCapacityUnits"`
+	ConsumedWriteCapacityUnits    float64   `json:"consumedWriteCapacityUnits"`
+	DescribedAt                   time.Time `json:"describedAt"`
+}
+
+// Stats describes the table, reusing the last description of the table until it is older than the stats TTL
+// so that polling the stats does not exhaust the DescribeTable rate limit.
+func (s *Client) Stats() (TableStats, error) {
+	s.statsLock.Lock()
+	if s.statsUpdated.IsZero() || time.Since(s.statsUpdated) > s.statsTTL {
+		s.stats, s.statsErr = s.describeTable()
+		s.statsUpdated = time.Now()
+	}
+	stats, err := s.stats, s.statsErr
+	s.statsLock.Unlock()
+
+	s.consumedLock.Lock()
+	defer s.consumedLock.Unlock()
+	stats.ConsumedReadCapacityUnits = s.consumedReadCapacity
+	stats.ConsumedWriteCapacityUnits = s.consumedWriteCapacity
+	return stats, err
+}
+
+func (s *Client) describeTable() (TableStats, error) {
+	stats := TableStats{Name: s.dynamoDbTable, DescribedAt: time.Now()}
+	output, err := s.ddb.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(s.dynamoDbTable)})
+	if err != nil {
+		return stats, err
+	}
+
+	table := output.Table
+	stats.Status = aws.StringValue(table.TableStatus)
+	stats.ItemCount = aws.Int64Value(table.ItemCount)
+	stats.SizeBytes = aws.Int64Value(table.TableSizeBytes)
+	if table.ProvisionedThroughput != nil {
+		stats.ProvisionedReadCapacityUnits = aws.Int64Value(table.ProvisionedThroughput.ReadCapacityUnits)
+		stats.ProvisionedWriteCapacityUnits = aws.Int64Value(table.ProvisionedThroughput.WriteCapacityUnits)
+	}
+	// Tables which have always been provisioned may have no billing mode summary.
+	stats.BillingMode = BillingModeProvisioned
+	if table.BillingModeSummary != nil && table.BillingModeSummary.BillingMode != nil {
+		stats.BillingMode = aws.StringValue(table.BillingModeSummary.BillingMode)
+	}
+	return stats, nil
+}
+
+func (s *Client) consumed(capacity *dynamodb.ConsumedCapacity, write bool) {
+	if capacity == nil {
+		return
+	}
+	s.consumedLock.Lock()
+	defer s.consumedLock.Unlock()
+	if write {
+		s.consumedWriteCapacity += aws.Float64Value(capacity.CapacityUnits)
+	} else {
+		s.consumedReadCapacity += aws.Float64Value(capacity.CapacityUnits)
+	}
+}
@@ -0,0 +1,144 @@
+package dynamodb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockDescribeTableAPI struct {
+	dynamodbiface.DynamoDBAPI
+	describeCalls int
+	throughput    *dynamodb.ProvisionedThroughputDescription
+	billingMode   *dynamodb.BillingModeSummary
+	described     chan struct{}
+	err           error
+}
+
+func (m *mockDescribeTableAPI) DescribeTable(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	m.describeCalls++
+	if m.described != nil {
+		<-m.described
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &dynamodb.DescribeTableOutput{Table: &dynamodb.TableDescription{
+		TableName:             input.TableName,
+		TableStatus:           aws.String(dynamodb.TableStatusActive),
+		ItemCount:             aws.Int64(42),
+		TableSizeBytes:        aws.Int64(4096),
+		ProvisionedThroughput: m.throughput,
+		BillingModeSummary:    m.billingMode,
+	}}, nil
+}
+
+func (m *mockDescribeTableAPI) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{ConsumedCapacity: &dynamodb.ConsumedCapacity{CapacityUnits: aws.Float64(0.5)}}, nil
+}
+
+func (m *mockDescribeTableAPI) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	return &dynamodb.DeleteItemOutput{ConsumedCapacity: &dynamodb.ConsumedCapacity{CapacityUnits: aws.Float64(1)}}, nil
+}
+
+func TestClient_StatsDescribesTable(t *testing.T) {
+	api := &mockDescribeTableAPI{throughput: &dynamodb.ProvisionedThroughputDescription{ReadCapacityUnits: aws.Int64(5), WriteCapacityUnits: aws.Int64(10)}}
+	client := Client{dynamoDbTable: DDB_TABLE, awsRegion: AWS_REGION, ddb: api, statsTTL: time.Minute}
+
+	stats, err := client.Stats()
+
+	assert.NoError(t, err, "Failed to describe table")
+	assert.Equal(t, DDB_TABLE, stats.Name)
+	assert.Equal(t, dynamodb.TableStatusActive, stats.Status)
+	assert.Equal(t, int64(42), stats.ItemCount)
+	assert.Equal(t, int64(4096), stats.SizeBytes)
+	assert.Equal(t, BillingModeProvisioned, stats.BillingMode)
+	assert.Equal(t, int64(5), stats.ProvisionedReadCapacityUnits)
+	assert.Equal(t, int64(10), stats.ProvisionedWriteCapacityUnits)
+}
+
+func TestClient_StatsOnDemandTable(t *testing.T) {
+	api := &mockDescribeTableAPI{
+		throughput:  &dynamodb.ProvisionedThroughputDescription{ReadCapacityUnits: aws.Int64(0), WriteCapacityUnits: aws.Int64(0)},
+		billingMode: &dynamodb.BillingModeSummary{BillingMode: aws.String(dynamodb.BillingModePayPerRequest)},
+	}
+	client := Client{dynamoDbTable: DDB_TABLE, awsRegion: AWS_REGION, ddb: api, statsTTL: time.Minute}
+
+	stats, _ := client.Stats()
+
+	assert.Equal(t, BillingModePayPerRequest, stats.BillingMode)
+}
+
+func TestClient_StatsSwitchedToProvisioned(t *testing.T) {
+	api := &mockDescribeTableAPI{
+		throughput:  &dynamodb.ProvisionedThroughputDescription{ReadCapacityUnits: aws.Int64(0), WriteCapacityUnits: aws.Int64(0)},
+		billingMode: &dynamodb.BillingModeSummary{BillingMode: aws.String(dynamodb.BillingModeProvisioned)},
+	}
+	client := Client{dynamoDbTable: DDB_TABLE, awsRegion: AWS_REGION, ddb: api, statsTTL: time.Minute}
+
+	stats, _ := client.Stats()
+
+	assert.Equal(t, BillingModeProvisioned, stats.BillingMode, "Billing mode should not be guessed from the provisioned capacity")
+}
+
+func TestClient_StatsAreCached(t *testing.T) {
+	api := &mockDescribeTableAPI{err: errors.New("throttled")}
+	client := Client{dynamoDbTable: DDB_TABLE, awsRegion: AWS_REGION, ddb: api, statsTTL: time.Minute}
+
+	_, err := client.Stats()
+	assert.Error(t, err, "DescribeTable error was not reported")
+	api.err = nil
+	_, err = client.Stats()
+
+	assert.Error(t, err, "Cached DescribeTable error was not reported")
+	assert.Equal(t, 1, api.describeCalls, "Table was described again before the stats expired")
+
+	client.statsUpdated = time.Now().Add(-2 * time.Minute)
+	_, err = client.Stats()
+	assert.NoError(t, err, "Expired stats were not refreshed")
+	assert.Equal(t, 2, api.describeCalls)
+}
+
+func TestClient_StatsCountConsumedCapacity(t *testing.T) {
+	api := &mockDescribeTableAPI{}
+	client := Client{dynamoDbTable: DDB_TABLE, awsRegion: AWS_REGION, ddb: api, statsTTL: time.Minute}
+
+	client.Read(UUID, "test_transaction_id")
+	client.Read(UUID, "test_transaction_id")
+	client.Delete(UUID, "test_transaction_id")
+	stats, _ := client.Stats()
+
+	assert.Equal(t, 1.0, stats.ConsumedReadCapacityUnits)
+	assert.Equal(t, 1.0, stats.ConsumedWriteCapacityUnits)
+}
+
+func TestClient_StatsDoNotHoldUpRequests(t *testing.T) {
+	api := &mockDescribeTableAPI{described: make(chan struct{})}
+	client := Client{dynamoDbTable: DDB_TABLE, awsRegion: AWS_REGION, ddb: api, statsTTL: time.Minute}
+	done := make(chan struct{})
+	go func() {
+		client.Stats()
+		close(done)
+	}()
+
+	read := make(chan struct{})
+	go func() {
+		client.Read(UUID, "test_transaction_id")
+		close(read)
+	}()
+	select {
+	case <-read:
+	case <-time.After(time.Second):
+		t.Error("Read was held up while the table was described")
+	}
+
+	close(api.described)
+	<-done
+	stats, _ := client.Stats()
+	assert.Equal(t, 0.5, stats.ConsumedReadCapacityUnits)
+}
@@ -0,0 +1,381 @@
+package dynamodb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// StreamStartLatest and StreamStartTrimHorizon are where shards are read from the first time the stream is consumed.
+	StreamStartLatest      = "latest"
+	StreamStartTrimHorizon = "trim_horizon"
+
+	StreamInsert = "INSERT"
+	StreamModify = "MODIFY"
+	StreamRemove = "REMOVE"
+
+	streamBatchSize = 1000
+)
+
+// StreamChange is a change of a concordance record read from the DynamoDB Stream of its table.
+// Old is nil for created records, New is nil for removed records.
+type StreamChange struct {
+	EventName      string
+	SequenceNumber string
+	ShardID        string
+	UUID           string
+	Timestamp      time.Time
+	Old            *ConcordancesModel
+	New            *ConcordancesModel
+}
+
+// Checkpoint is how far a shard of a stream has been read.
+type Checkpoint struct {
+	SequenceNumber string `json:"sequenceNumber,omitempty"`
+	// Finished is set once a closed shard has been read to its end.
+	Finished bool `json:"finished,omitempty"`
+}
+
+// Checkpoints keeps the progress of a stream reader, so that it carries on where it stopped after a restart.
+type Checkpoints interface {
+	Get(shardId string) (Checkpoint, bool)
+	Set(shardId string, checkpoint Checkpoint) error
+	Empty() bool
+}
+
+// FileCheckpoints keeps the checkpoints of every shard in memory and, unless its path is empty, in a JSON file.
+type FileCheckpoints struct {
+	path string
+
+	sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+func NewFileCheckpoints(path string) (*FileCheckpoints, error) {
+	c := &FileCheckpoints{path: path, checkpoints: map[string]Checkpoint{}}
+	if path == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.checkpoints); err != nil {
+		return nil, fmt.Errorf("stream checkpoints %s are not valid JSON: %v", path, err)
+	}
+	return c, nil
+}
+
+func (c *FileCheckpoints) Get(shardId string) (Checkpoint, bool) {
+	c.Lock()
+	defer c.Unlock()
+	checkpoint, found := c.checkpoints[shardId]
+	return checkpoint, found
+}
+
+func (c *FileCheckpoints) Set(shardId string, checkpoint Checkpoint) error {
+	c.Lock()
+	defer c.Unlock()
+	c.checkpoints[shardId] = checkpoint
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (c *FileCheckpoints) Empty() bool {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.checkpoints) == 0
+}
+
+// StreamReader reads the changes of a table from its DynamoDB Stream, shard by shard, reading parent shards before
+// their children so that the changes of each record are read in order, and checkpointing every change it has handled.
+type StreamReader struct {
+	client        dynamodbstreamsiface.DynamoDBStreamsAPI
+	streamArn     string
+	checkpoints   Checkpoints
+	startPosition string
+
+	sync.Mutex
+	// iterators are where each open shard will be read from on the next poll.
+	iterators map[string]string
+	polled    bool
+}
+
+// LatestStreamArn returns the ARN of the stream of a table, which must be enabled with new and old images.
+func LatestStreamArn(table string, region string) (string, error) {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String(region)}))
+	output, err := dynamodb.New(sess).DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return "", err
+	}
+	if output.Table.StreamSpecification == nil || !aws.BoolValue(output.Table.StreamSpecification.StreamEnabled) {
+		return "", fmt.Errorf("table %s has no stream", table)
+	}
+	if aws.StringValue(output.Table.StreamSpecification.StreamViewType) != dynamodbstreams.StreamViewTypeNewAndOldImages {
+		return "", fmt.Errorf("stream of table %s does not have new and old images", table)
+	}
+	return aws.StringValue(output.Table.LatestStreamArn), nil
+}
+
+func NewStreamReader(streamArn string, region string, checkpoints Checkpoints, startPosition string) *StreamReader {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String(region)}))
+	return NewStreamReaderWithClient(dynamodbstreams.New(sess), streamArn, checkpoints, startPosition)
+}
+
+func NewStreamReaderWithClient(client dynamodbstreamsiface.DynamoDBStreamsAPI, streamArn string, checkpoints Checkpoints, startPosition string) *StreamReader {
+	if startPosition != StreamStartTrimHorizon {
+		startPosition = StreamStartLatest
+	}
+	return &StreamReader{client: client, streamArn: streamArn, checkpoints: checkpoints, startPosition: startPosition, iterators: map[string]string{}}
+}
+
+// ValidateStartPosition checks the position shards are first read from.
+func ValidateStartPosition(position string) error {
+	if position != StreamStartLatest && position != StreamStartTrimHorizon {
+		return fmt.Errorf("unknown stream start position %s, expected %s or %s", position, StreamStartLatest, StreamStartTrimHorizon)
+	}
+	return nil
+}
+
+// Poll reads the changes made since the last poll from every shard that is ready to be read, handing them to fn in order.
+// A shard is checkpointed up to the last change fn handled, and is read again from there by the next poll when fn fails.
+func (r *StreamReader) Poll(fn func(StreamChange) error) error {
+	r.Lock()
+	defer r.Unlock()
+
+	shards, err := r.shards()
+	if err != nil {
+		return err
+	}
+	known := map[string]bool{}
+	for _, shard := range shards {
+		known[aws.StringValue(shard.ShardId)] = true
+	}
+	// The first poll of a stream that was never read starts from the configured position, every other shard from its start,
+	// so that no change is missed once the reader has started.
+	initial := !r.polled && r.checkpoints.Empty()
+	r.polled = true
+
+	var firstErr error
+	for _, shard := range orderShards(shards) {
+		id := aws.StringValue(shard.ShardId)
+		if checkpoint, _ := r.checkpoints.Get(id); checkpoint.Finished {
+			delete(r.iterators, id)
+			continue
+		}
+		if parent := aws.StringValue(shard.ParentShardId); parent != "" && known[parent] {
+			if checkpoint, _ := r.checkpoints.Get(parent); !checkpoint.Finished {
+				continue
+			}
+		}
+		if err := r.readShard(id, initial, fn); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (r *StreamReader) shards() ([]*dynamodbstreams.Shard, error) {
+	shards := []*dynamodbstreams.Shard{}
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(r.streamArn)}
+	for {
+		output, err := r.client.DescribeStream(input)
+		if err != nil {
+			log.WithError(err).WithField("stream", r.streamArn).Error("Error describing DynamoDB stream")
+			return nil, err
+		}
+		shards = append(shards, output.StreamDescription.Shards...)
+		if output.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		input.ExclusiveStartShardId = output.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// orderShards puts parent shards before their children.
+func orderShards(shards []*dynamodbstreams.Shard) []*dynamodbstreams.Shard {
+	byId := map[string]*dynamodbstreams.Shard{}
+	for _, shard := range shards {
+		byId[aws.StringValue(shard.ShardId)] = shard
+	}
+	ordered := []*dynamodbstreams.Shard{}
+	added := map[string]bool{}
+	var add func(shard *dynamodbstreams.Shard)
+	add = func(shard *dynamodbstreams.Shard) {
+		id := aws.StringValue(shard.ShardId)
+		if added[id] {
+			return
+		}
+		added[id] = true
+		if parent, found := byId[aws.StringValue(shard.ParentShardId)]; found {
+			add(parent)
+		}
+		ordered = append(ordered, shard)
+	}
+	for _, shard := range shards {
+		add(shard)
+	}
+	return ordered
+}
+
+func (r *StreamReader) readShard(shardId string, initial bool, fn func(StreamChange) error) error {
+	logEntry := log.WithFields(log.Fields{"stream": r.streamArn, "shard": shardId})
+	iterator, found := r.iterators[shardId]
+	if !found {
+		var err error
+		iterator, err = r.shardIterator(shardId, initial)
+		if isAWSError(err, dynamodbstreams.ErrCodeTrimmedDataAccessException) {
+			logEntry.Warn("Changes were trimmed from the DynamoDB stream before being read, reading the shard from its oldest change")
+			r.checkpoints.Set(shardId, Checkpoint{})
+			iterator, err = r.shardIterator(shardId, false)
+		}
+		if err != nil {
+			logEntry.WithError(err).Error("Error getting DynamoDB stream shard iterator")
+			return err
+		}
+	}
+
+	for iterator != "" {
+		output, err := r.client.GetRecords(&dynamodbstreams.GetRecordsInput{ShardIterator: aws.String(iterator), Limit: aws.Int64(streamBatchSize)})
+		if isAWSError(err, dynamodbstreams.ErrCodeExpiredIteratorException) {
+			// Read again from the checkpoint by the next poll.
+			logEntry.Info("DynamoDB stream shard iterator expired")
+			delete(r.iterators, shardId)
+			return nil
+		}
+		if isAWSError(err, dynamodbstreams.ErrCodeTrimmedDataAccessException) {
+			logEntry.Warn("Changes were trimmed from the DynamoDB stream before being read, reading the shard from its oldest change")
+			r.checkpoints.Set(shardId, Checkpoint{})
+			delete(r.iterators, shardId)
+			return nil
+		}
+		if err != nil {
+			logEntry.WithError(err).Error("Error getting DynamoDB stream records")
+			delete(r.iterators, shardId)
+			return err
+		}
+
+		for _, record := range output.Records {
+			change, err := toStreamChange(shardId, record)
+			if err == nil {
+				err = fn(change)
+			}
+			if err != nil {
+				delete(r.iterators, shardId)
+				return err
+			}
+			if err := r.checkpoints.Set(shardId, Checkpoint{SequenceNumber: change.SequenceNumber}); err != nil {
+				logEntry.WithError(err).Error("Error checkpointing DynamoDB stream shard")
+			}
+		}
+
+		next := aws.StringValue(output.NextShardIterator)
+		if next == "" {
+			// The shard was closed by a resharding and every change in it has been read.
+			checkpoint, _ := r.checkpoints.Get(shardId)
+			checkpoint.Finished = true
+			if err := r.checkpoints.Set(shardId, checkpoint); err != nil {
+				logEntry.WithError(err).Error("Error checkpointing DynamoDB stream shard")
+			}
+			delete(r.iterators, shardId)
+			logEntry.Info("Finished reading closed DynamoDB stream shard")
+			return nil
+		}
+		r.iterators[shardId] = next
+		if len(output.Records) == 0 {
+			// Caught up with the open shard.
+			return nil
+		}
+		iterator = next
+	}
+	return nil
+}
+
+func (r *StreamReader) shardIterator(shardId string, initial bool) (string, error) {
+	input := &dynamodbstreams.GetShardIteratorInput{StreamArn: aws.String(r.streamArn), ShardId: aws.String(shardId)}
+	checkpoint, _ := r.checkpoints.Get(shardId)
+	switch {
+	case checkpoint.SequenceNumber != "":
+		input.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeAfterSequenceNumber)
+		input.SequenceNumber = aws.String(checkpoint.SequenceNumber)
+	case initial && r.startPosition == StreamStartLatest:
+		input.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeLatest)
+	default:
+		input.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeTrimHorizon)
+	}
+	output, err := r.client.GetShardIterator(input)
+	if err != nil {
+		return "", err
+	}
+	if output.ShardIterator == nil {
+		return "", errors.New("no shard iterator was returned")
+	}
+	return *output.ShardIterator, nil
+}
+
+func toStreamChange(shardId string, record *dynamodbstreams.Record) (StreamChange, error) {
+	change := StreamChange{EventName: aws.StringValue(record.EventName), ShardID: shardId}
+	if record.Dynamodb == nil {
+		return change, errors.New("stream record has no change")
+	}
+	change.SequenceNumber = aws.StringValue(record.Dynamodb.SequenceNumber)
+	change.Timestamp = aws.TimeValue(record.Dynamodb.ApproximateCreationDateTime)
+
+	var err error
+	if change.Old, err = imageModel(record.Dynamodb.OldImage); err != nil {
+		return change, err
+	}
+	if change.New, err = imageModel(record.Dynamodb.NewImage); err != nil {
+		return change, err
+	}
+	key := DynamoConcordancesModel{}
+	if err := dynamodbattribute.UnmarshalMap(record.Dynamodb.Keys, &key); err != nil {
+		return change, err
+	}
+	change.UUID = key.UUID
+	return change, nil
+}
+
+func imageModel(image map[string]*dynamodb.AttributeValue) (*ConcordancesModel, error) {
+	if len(image) == 0 {
+		return nil, nil
+	}
+	m := DynamoConcordancesModel{}
+	if err := dynamodbattribute.UnmarshalMap(image, &m); err != nil {
+		return nil, err
+	}
+	model := m.toModel()
+	return &model, nil
+}
+
+func isAWSError(err error, code string) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == code
+}
@@ -0,0 +1,241 @@
+package dynamodb_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	streamArn = "arn:aws:dynamodb:eu-west-1:027104099916:table/concordances/stream/2017-11-01T00:00:00.000"
+	shardA    = "shardId-00000001-000000000000000000000a"
+	shardB    = "shardId-00000002-000000000000000000000b"
+	shardC    = "shardId-00000003-000000000000000000000c"
+)
+
+type streamHandler struct {
+	changes []db.StreamChange
+	failAt  int
+}
+
+func (h *streamHandler) handle(change db.StreamChange) error {
+	if h.failAt > 0 && len(h.changes)+1 == h.failAt {
+		h.failAt = 0
+		return errors.New("notification failed")
+	}
+	h.changes = append(h.changes, change)
+	return nil
+}
+
+func (h *streamHandler) uuids() []string {
+	uuids := []string{}
+	for _, change := range h.changes {
+		uuids = append(uuids, change.UUID)
+	}
+	return uuids
+}
+
+func concordance(uuid string, ids ...string) *db.ConcordancesModel {
+	return &db.ConcordancesModel{UUID: uuid, ConcordedIds: ids}
+}
+
+func newCheckpoints(t *testing.T) *db.FileCheckpoints {
+	checkpoints, err := db.NewFileCheckpoints("")
+	assert.NoError(t, err)
+	return checkpoints
+}
+
+func TestStreamReaderChanges(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(shardA, "")
+	reader := db.NewStreamReaderWithClient(streams, streamArn, newCheckpoints(t), db.StreamStartLatest)
+	handler := &streamHandler{}
+
+	assert.NoError(t, reader.Poll(handler.handle))
+	assert.Empty(t, handler.changes)
+
+	streams.Put(shardA, nil, concordance("uuid-1", "A"))
+	streams.Put(shardA, concordance("uuid-1", "A"), concordance("uuid-1", "A", "B"))
+	streams.Put(shardA, concordance("uuid-1", "A", "B"), nil)
+	assert.NoError(t, reader.Poll(handler.handle))
+
+	assert.Len(t, handler.changes, 3)
+	created, updated, removed := handler.changes[0], handler.changes[1], handler.changes[2]
+	assert.Equal(t, db.StreamInsert, created.EventName)
+	assert.Equal(t, "uuid-1", created.UUID)
+	assert.Nil(t, created.Old)
+	assert.Equal(t, []string{"A"}, created.New.ConcordedIds)
+	assert.Equal(t, db.StreamModify, updated.EventName)
+	assert.Equal(t, []string{"A"}, updated.Old.ConcordedIds)
+	assert.Equal(t, []string{"A", "B"}, updated.New.ConcordedIds)
+	assert.Equal(t, db.StreamRemove, removed.EventName)
+	assert.Equal(t, "uuid-1", removed.UUID)
+	assert.Nil(t, removed.New)
+	assert.Equal(t, shardA, removed.ShardID)
+
+	assert.NoError(t, reader.Poll(handler.handle))
+	assert.Len(t, handler.changes, 3, "Changes should only be read once")
+}
+
+func TestStreamReaderStartPosition(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(shardA, "")
+	streams.Put(shardA, nil, concordance("uuid-1", "A"))
+
+	handler := &streamHandler{}
+	assert.NoError(t, db.NewStreamReaderWithClient(streams, streamArn, newCheckpoints(t), db.StreamStartLatest).Poll(handler.handle))
+	assert.Empty(t, handler.changes, "Changes made before the first poll should be skipped from latest")
+
+	assert.NoError(t, db.NewStreamReaderWithClient(streams, streamArn, newCheckpoints(t), db.StreamStartTrimHorizon).Poll(handler.handle))
+	assert.Len(t, handler.changes, 1, "Changes made before the first poll should be read from the trim horizon")
+}
+
+func TestStreamReaderPaging(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.PageSize = 1
+	streams.AddShard(shardA, "")
+	streams.AddShard(shardB, "")
+	for _, uuid := range []string{"uuid-1", "uuid-2", "uuid-3"} {
+		streams.Put(shardA, nil, concordance(uuid, "A"))
+	}
+	streams.Put(shardB, nil, concordance("uuid-4", "A"))
+	handler := &streamHandler{}
+
+	assert.NoError(t, db.NewStreamReaderWithClient(streams, streamArn, newCheckpoints(t), db.StreamStartTrimHorizon).Poll(handler.handle))
+	assert.Equal(t, []string{"uuid-1", "uuid-2", "uuid-3", "uuid-4"}, handler.uuids(), "Every page of shards and records should be read")
+}
+
+func TestStreamReaderCheckpoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoints.json")
+
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(shardA, "")
+	streams.Put(shardA, nil, concordance("uuid-1", "A"))
+	streams.Put(shardA, nil, concordance("uuid-2", "A"))
+	streams.Put(shardA, nil, concordance("uuid-3", "A"))
+
+	checkpoints, err := db.NewFileCheckpoints(path)
+	assert.NoError(t, err)
+	handler := &streamHandler{failAt: 2}
+	reader := db.NewStreamReaderWithClient(streams, streamArn, checkpoints, db.StreamStartTrimHorizon)
+	assert.Error(t, reader.Poll(handler.handle))
+	assert.Equal(t, []string{"uuid-1"}, handler.uuids())
+
+	// A restarted reader carries on from the last change that was handled.
+	checkpoints, err = db.NewFileCheckpoints(path)
+	assert.NoError(t, err)
+	checkpoint, found := checkpoints.Get(shardA)
+	assert.True(t, found)
+	assert.Equal(t, "000000000000000000001", checkpoint.SequenceNumber)
+
+	reader = db.NewStreamReaderWithClient(streams, streamArn, checkpoints, db.StreamStartLatest)
+	assert.NoError(t, reader.Poll(handler.handle))
+	assert.Equal(t, []string{"uuid-1", "uuid-2", "uuid-3"}, handler.uuids(), "Failed change should be read again")
+}
+
+func TestStreamReaderResharding(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(shardA, "")
+	checkpoints := newCheckpoints(t)
+	reader := db.NewStreamReaderWithClient(streams, streamArn, checkpoints, db.StreamStartTrimHorizon)
+	handler := &streamHandler{}
+
+	streams.Put(shardA, nil, concordance("uuid-1", "A"))
+	assert.NoError(t, reader.Poll(handler.handle))
+
+	// shardA splits into shardB and shardC, but its last change is only read after they were opened.
+	streams.Put(shardA, concordance("uuid-1", "A"), concordance("uuid-1", "A", "B"))
+	streams.CloseShard(shardA)
+	streams.AddShard(shardB, shardA)
+	streams.AddShard(shardC, shardA)
+	streams.Put(shardB, concordance("uuid-1", "A", "B"), concordance("uuid-1", "A", "B", "C"))
+	streams.Put(shardC, nil, concordance("uuid-2", "D"))
+
+	assert.NoError(t, reader.Poll(handler.handle))
+	assert.Len(t, handler.changes, 4)
+	assert.Equal(t, shardA, handler.changes[1].ShardID, "Parent shard should be read to its end before its children")
+	assert.Equal(t, []string{"A", "B", "C"}, handler.changes[2].New.ConcordedIds)
+
+	checkpoint, _ := checkpoints.Get(shardA)
+	assert.True(t, checkpoint.Finished, "Closed shard should be finished")
+
+	streams.Put(shardB, nil, concordance("uuid-3", "E"))
+	assert.NoError(t, reader.Poll(handler.handle))
+	assert.Equal(t, "uuid-3", handler.changes[4].UUID)
+}
+
+func TestStreamReaderWaitsForParentShard(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(shardA, "")
+	streams.AddShard(shardB, shardA)
+	streams.Put(shardA, nil, concordance("uuid-1", "A"))
+	streams.Put(shardB, concordance("uuid-1", "A"), concordance("uuid-1", "B"))
+	reader := db.NewStreamReaderWithClient(streams, streamArn, newCheckpoints(t), db.StreamStartTrimHorizon)
+	handler := &streamHandler{}
+
+	assert.NoError(t, reader.Poll(handler.handle))
+	assert.Equal(t, []string{"uuid-1"}, handler.uuids(), "Child shard should not be read before its parent is closed")
+
+	streams.CloseShard(shardA)
+	assert.NoError(t, reader.Poll(handler.handle))
+	assert.Len(t, handler.changes, 2)
+	assert.Equal(t, []string{"B"}, handler.changes[1].New.ConcordedIds)
+}
+
+func TestStreamReaderExpiredIterator(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(shardA, "")
+	reader := db.NewStreamReaderWithClient(streams, streamArn, newCheckpoints(t), db.StreamStartTrimHorizon)
+	handler := &streamHandler{}
+
+	streams.Put(shardA, nil, concordance("uuid-1", "A"))
+	assert.NoError(t, reader.Poll(handler.handle))
+	streams.ExpireIterators()
+	streams.Put(shardA, nil, concordance("uuid-2", "A"))
+
+	assert.NoError(t, reader.Poll(handler.handle), "Expired iterator should not fail the poll")
+	assert.NoError(t, reader.Poll(handler.handle))
+	assert.Equal(t, []string{"uuid-1", "uuid-2"}, handler.uuids(), "Shard should be read again from its checkpoint")
+}
+
+func TestStreamReaderTrimmedChanges(t *testing.T) {
+	streams := testutil.NewFakeStreams()
+	streams.AddShard(shardA, "")
+	checkpoints := newCheckpoints(t)
+	handler := &streamHandler{}
+
+	streams.Put(shardA, nil, concordance("uuid-1", "A"))
+	assert.NoError(t, db.NewStreamReaderWithClient(streams, streamArn, checkpoints, db.StreamStartTrimHorizon).Poll(handler.handle))
+	streams.Put(shardA, nil, concordance("uuid-2", "A"))
+	streams.Put(shardA, nil, concordance("uuid-3", "A"))
+	streams.Trim(shardA, 2)
+
+	assert.NoError(t, db.NewStreamReaderWithClient(streams, streamArn, checkpoints, db.StreamStartTrimHorizon).Poll(handler.handle))
+	assert.Equal(t, []string{"uuid-1", "uuid-3"}, handler.uuids(), "Reader should carry on from the oldest change left")
+}
+
+func TestStreamCheckpointsInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoints.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+
+	_, err = db.NewFileCheckpoints(path)
+	assert.Error(t, err)
+}
+
+func TestStreamValidateStartPosition(t *testing.T) {
+	assert.NoError(t, db.ValidateStartPosition(db.StreamStartLatest))
+	assert.NoError(t, db.ValidateStartPosition(db.StreamStartTrimHorizon))
+	assert.Error(t, db.ValidateStartPosition("earliest"))
+}
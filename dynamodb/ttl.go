@@ -0,0 +1,137 @@
+package dynamodb
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	log "github.com/sirupsen/logrus"
+)
+
+// expiry returns when the record expires, in seconds since the epoch, whether the expiry is in the TTL attribute
+// or held out of it until the changes of the record are announced.
+func (m DynamoConcordancesModel) expiry() int64 {
+	if m.HeldExpiresAt > 0 {
+		return m.HeldExpiresAt
+	}
+	return m.ExpiresAt
+}
+
+func (m DynamoConcordancesModel) expired() bool {
+	return m.expiry() > 0 && m.expiry() <= time.Now().Unix()
+}
+
+func (m DynamoConcordancesModel) toModel() ConcordancesModel {
+	model := ConcordancesModel{UUID: m.UUID, ConcordedIds: m.ConcordedIds, Identifiers: m.Identifiers, TransactionID: m.TransactionID}
+	if m.expiry() > 0 {
+		expiresAt := time.Unix(m.expiry(), 0).UTC()
+		model.ExpiresAt = &expiresAt
+	}
+	if m.LastModified > 0 {
+		lastModified := time.Unix(m.LastModified, 0).UTC()
+		model.LastModified = &lastModified
+	}
+	return model
+}
+
+// Expirer is implemented by clients that purge expired records themselves, so that their expiry can be announced.
+// DynamoDB purges expired records up to a couple of days after they expire, and reads hide them until then.
+type Expirer interface {
+	// ScanExpired calls fn with the UUID of every record that has expired but has not been purged yet.
+	ScanExpired(fn func(uuid string) error) error
+	// Expire deletes a record that has expired, unless it has been re-confirmed or deleted since. The record is
+	// reported as Expired only to the caller that deleted it, so that its expiry is announced once.
+	Expire(uuid string, transactionId string) (ConcordancesModel, error)
+}
+
+// Expire deletes an expired record on condition that it is still expired. Clients with an outbox record the expiry
+// as the deletion of the record instead.
+func (s *Client) Expire(uuid string, transactionId string) (_ ConcordancesModel, err error) {
+	defer func() { err = classify(err) }()
+	if s.outbox {
+		return s.expireWithChange(uuid, transactionId)
+	}
+	k, err := dynamodbattribute.Marshal(uuid)
+	if err != nil {
+		return ConcordancesModel{}, err
+	}
+
+	input := &dynamodb.DeleteItemInput{}
+	input.SetTableName(s.dynamoDbTable)
+	input.SetKey(map[string]*dynamodb.AttributeValue{TableHashKey: k})
+	input.SetConditionExpression(TTLAttribute + " <= :now")
+	input.SetExpressionAttributeValues(map[string]*dynamodb.AttributeValue{":now": {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))}})
+	input.SetReturnValues(dynamodb.ReturnValueAllOld)
+	input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityTotal)
+
+	output, err := s.ddb.DeleteItem(input)
+	if isConditionalCheckFailed(err) {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Info("Expired concordance record was already deleted or re-confirmed")
+		return ConcordancesModel{}, nil
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error deleting expired concordance record")
+		return ConcordancesModel{}, err
+	}
+	s.consumed(output.ConsumedCapacity, true)
+
+	m := DynamoConcordancesModel{}
+	if err := dynamodbattribute.UnmarshalMap(output.Attributes, &m); err != nil {
+		return ConcordancesModel{}, err
+	}
+	expired := m.toModel()
+	expired.Expired = true
+	return expired, nil
+}
+
+func (s *Client) expireWithChange(uuid string, transactionId string) (ConcordancesModel, error) {
+	current, err := s.current(uuid)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error reading expired concordance record")
+		return ConcordancesModel{}, err
+	}
+	if current.Deleted || !current.expired() {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Info("Expired concordance record was already deleted or re-confirmed")
+		return ConcordancesModel{}, nil
+	}
+
+	expired := current.toModel()
+	err = s.tombstone(current, newChange(CONCORDANCE_DELETED, transactionId, expired, ConcordancesModel{}))
+	if isConditionalCheckFailed(err) {
+		log.WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Info("Expired concordance record was already deleted or re-confirmed")
+		return ConcordancesModel{}, nil
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"UUID": uuid, "transaction_id": transactionId}).Error("Error deleting expired concordance record")
+		return ConcordancesModel{}, err
+	}
+
+	expired.Expired = true
+	return expired, nil
+}
+
+func (s *Client) ScanExpired(fn func(uuid string) error) error {
+	input := &dynamodb.ScanInput{}
+	input.SetTableName(s.dynamoDbTable)
+	input.SetFilterExpression("(" + TTLAttribute + " <= :now OR #heldExpiresAt <= :now) AND attribute_not_exists(#deleted)")
+	input.SetProjectionExpression(TableHashKey)
+	input.SetExpressionAttributeNames(map[string]*string{"#deleted": aws.String(deletedAttribute), "#heldExpiresAt": aws.String(heldExpiresAtAttribute)})
+	input.SetExpressionAttributeValues(map[string]*dynamodb.AttributeValue{":now": {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))}})
+
+	var fnErr error
+	err := s.ddb.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if fnErr = fn(aws.StringValue(item[TableHashKey].S)); fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		log.WithError(err).WithField("table", s.dynamoDbTable).Error("Error scanning for expired concordance records")
+		return err
+	}
+	return fnErr
+}
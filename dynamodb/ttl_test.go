@@ -0,0 +1,174 @@
+package dynamodb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockExpiringItemAPI struct {
+	dynamodbiface.DynamoDBAPI
+	expiresAt time.Time
+	deleteErr error
+	deletes   []*dynamodb.DeleteItemInput
+	scans     []*dynamodb.ScanInput
+}
+
+func (m *mockExpiringItemAPI) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+		TableHashKey:   {S: aws.String(UUID)},
+		"concordedIds": {L: []*dynamodb.AttributeValue{{S: aws.String(goodModel.ConcordedIds[0])}}},
+		TTLAttribute:   {N: aws.String(strconv.FormatInt(m.expiresAt.Unix(), 10))},
+	}}, nil
+}
+
+func (m *mockExpiringItemAPI) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	m.deletes = append(m.deletes, input)
+	if m.deleteErr != nil {
+		return nil, m.deleteErr
+	}
+	item, _ := m.GetItem(&dynamodb.GetItemInput{})
+	return &dynamodb.DeleteItemOutput{Attributes: item.Item}, nil
+}
+
+func (m *mockExpiringItemAPI) ScanPages(input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	m.scans = append(m.scans, input)
+	item, _ := m.GetItem(&dynamodb.GetItemInput{})
+	fn(&dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{item.Item}}, true)
+	return nil
+}
+
+func TestUpdateInputWithExpiry(t *testing.T) {
+	expiresAt := time.Unix(1893456000, 0)
+	input, err := c.getUpdateInput(ConcordancesModel{UUID: UUID, ConcordedIds: goodModel.ConcordedIds, ExpiresAt: &expiresAt}, "test_transaction_id")
+
+	assert.NoError(t, err, "Received error")
+	assert.NoError(t, input.Validate(), "Update Input is valid.")
+	assert.Equal(t, "SET concordedIds = :concordedIds, expiresAt = :expiresAt, lastModified = :lastModified, transactionId = :transactionId REMOVE identifiers, #deleted", *input.UpdateExpression)
+	assert.Equal(t, "1893456000", *input.ExpressionAttributeValues[":expiresAt"].N, "Expiry was not stored in seconds since the epoch")
+}
+
+func TestReadUnexpiredRecord(t *testing.T) {
+	api := &mockExpiringItemAPI{expiresAt: time.Now().Add(time.Hour)}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api}
+
+	model, err := client.Read(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{goodModel.ConcordedIds[0]}, model.ConcordedIds)
+	assert.Equal(t, api.expiresAt.Unix(), model.ExpiresAt.Unix())
+	assert.False(t, model.Expired)
+	assert.Empty(t, api.deletes, "Unexpired record should not be deleted")
+}
+
+func TestReadHidesExpiredRecord(t *testing.T) {
+	api := &mockExpiringItemAPI{expiresAt: time.Now().Add(-time.Minute)}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api}
+
+	model, err := client.Read(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, ConcordancesModel{}, model, "Expired record was not hidden")
+	assert.Empty(t, api.deletes, "Reading an expired record should not delete it")
+}
+
+func TestExpireRecord(t *testing.T) {
+	api := &mockExpiringItemAPI{expiresAt: time.Now().Add(-time.Minute)}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api}
+
+	model, err := client.Expire(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.True(t, model.Expired, "Expired record was not reported as expired")
+	assert.Equal(t, []string{goodModel.ConcordedIds[0]}, model.ConcordedIds, "Expired record should be reported with its concorded UUIDs")
+	assert.Len(t, api.deletes, 1, "Expired record was not deleted")
+	assert.Equal(t, "expiresAt <= :now", *api.deletes[0].ConditionExpression, "Expired record should only be deleted if it was not re-confirmed")
+}
+
+func TestExpireRecordAlreadyDeleted(t *testing.T) {
+	api := &mockExpiringItemAPI{
+		expiresAt: time.Now().Add(-time.Minute),
+		deleteErr: awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil),
+	}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api}
+
+	model, err := client.Expire(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, ConcordancesModel{}, model, "Record deleted or re-confirmed by another writer should not be reported as expired")
+}
+
+type mockLastModifiedItemAPI struct {
+	dynamodbiface.DynamoDBAPI
+	lastModified time.Time
+}
+
+func (m *mockLastModifiedItemAPI) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+		TableHashKey:          {S: aws.String(UUID)},
+		"concordedIds":        {L: []*dynamodb.AttributeValue{{S: aws.String(goodModel.ConcordedIds[0])}}},
+		LastModifiedAttribute: {N: aws.String(strconv.FormatInt(m.lastModified.Unix(), 10))},
+	}}, nil
+}
+
+func TestReadLastModified(t *testing.T) {
+	api := &mockLastModifiedItemAPI{lastModified: time.Date(2017, 11, 1, 12, 0, 0, 0, time.UTC)}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api}
+
+	model, err := client.Read(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Equal(t, api.lastModified, *model.LastModified)
+	assert.Nil(t, model.ExpiresAt)
+}
+
+func TestReadWithoutLastModified(t *testing.T) {
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: &mockExpiringItemAPI{expiresAt: time.Now().Add(time.Hour)}}
+
+	model, err := client.Read(UUID, "test_transaction_id")
+
+	assert.NoError(t, err)
+	assert.Nil(t, model.LastModified, "Records without a modification time should not have one")
+}
+
+func TestScanSkipsExpiredRecords(t *testing.T) {
+	for _, testCase := range []struct {
+		expiresAt time.Time
+		scanned   int
+	}{
+		{time.Now().Add(time.Hour), 1},
+		{time.Now().Add(-time.Minute), 0},
+	} {
+		client := Client{dynamoDbTable: DDB_TABLE, ddb: &mockExpiringItemAPI{expiresAt: testCase.expiresAt}}
+
+		scanned := 0
+		err := client.Scan(func(m ConcordancesModel) error {
+			scanned++
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.scanned, scanned, "Expired records not purged yet should not be scanned")
+	}
+}
+
+func TestScanExpired(t *testing.T) {
+	api := &mockExpiringItemAPI{expiresAt: time.Now().Add(-time.Minute)}
+	client := Client{dynamoDbTable: DDB_TABLE, ddb: api}
+
+	uuids := []string{}
+	err := client.ScanExpired(func(uuid string) error {
+		uuids = append(uuids, uuid)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{UUID}, uuids)
+	assert.Equal(t, "(expiresAt <= :now OR #heldExpiresAt <= :now) AND attribute_not_exists(#deleted)", *api.scans[0].FilterExpression)
+}
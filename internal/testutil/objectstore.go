@@ -0,0 +1,98 @@
+package testutil
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FakeObjectStore is an in-memory S3-compatible object store serving path-style requests, e.g. PUT /bucket/key,
+// so that documents can be mirrored without AWS by running it with httptest.NewServer.
+type FakeObjectStore struct {
+	sync.Mutex
+	buckets map[string]map[string]fakeObject
+}
+
+type fakeObject struct {
+	body        []byte
+	contentType string
+}
+
+// NewFakeObjectStore creates a store holding the given, empty, buckets.
+func NewFakeObjectStore(buckets ...string) *FakeObjectStore {
+	store := &FakeObjectStore{buckets: map[string]map[string]fakeObject{}}
+	for _, bucket := range buckets {
+		store.buckets[bucket] = map[string]fakeObject{}
+	}
+	return store
+}
+
+// Object returns the document stored at key and its content type.
+func (f *FakeObjectStore) Object(bucket string, key string) ([]byte, string, bool) {
+	f.Lock()
+	defer f.Unlock()
+	object, found := f.buckets[bucket][key]
+	return object.body, object.contentType, found
+}
+
+// Keys returns the sorted keys of the documents of a bucket.
+func (f *FakeObjectStore) Keys(bucket string) []string {
+	f.Lock()
+	defer f.Unlock()
+	keys := []string{}
+	for key := range f.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *FakeObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	path := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	objects, found := f.buckets[path[0]]
+	if !found {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if len(path) == 1 || path[1] == "" {
+		if r.Method != http.MethodHead {
+			writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+		}
+		return
+	}
+
+	key := path[1]
+	switch r.Method {
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		objects[key] = fakeObject{body: body, contentType: r.Header.Get("Content-Type")}
+		w.Header().Set("ETag", `"fake"`)
+	case http.MethodGet:
+		object, found := objects[key]
+		if !found {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Write(object.body)
+	case http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>` + code + `</Code><Message>` + code + `</Message></Error>`))
+}
@@ -0,0 +1,223 @@
+// Package testutil holds in-memory doubles of the AWS services, shared by the tests of several packages.
+package testutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+)
+
+// FakeStreams is an in-memory DynamoDB Streams API, so that stream readers can be tested without AWS.
+// Shards are opened, closed and split with AddShard and CloseShard, and changes are appended to an open shard with Put.
+type FakeStreams struct {
+	dynamodbstreamsiface.DynamoDBStreamsAPI
+
+	sync.Mutex
+	// PageSize limits the number of shards described and records returned at once, to exercise paging.
+	PageSize   int
+	shards     []*fakeShard
+	sequence   int
+	generation int
+}
+
+type fakeShard struct {
+	id      string
+	parent  string
+	records []*dynamodbstreams.Record
+	// trimmed is the number of records removed from the start of the shard.
+	trimmed int
+	closed  bool
+}
+
+func NewFakeStreams() *FakeStreams {
+	return &FakeStreams{}
+}
+
+func (f *FakeStreams) AddShard(id string, parent string) {
+	f.Lock()
+	defer f.Unlock()
+	f.shards = append(f.shards, &fakeShard{id: id, parent: parent})
+}
+
+func (f *FakeStreams) CloseShard(id string) {
+	f.Lock()
+	defer f.Unlock()
+	f.shard(id).closed = true
+}
+
+// Put appends the change of a record to a shard. old is nil for created records and new is nil for removed records.
+func (f *FakeStreams) Put(shardId string, old *db.ConcordancesModel, new *db.ConcordancesModel) string {
+	f.Lock()
+	defer f.Unlock()
+	f.sequence++
+	sequenceNumber := fmt.Sprintf("%021d", f.sequence)
+
+	record := &dynamodbstreams.StreamRecord{
+		SequenceNumber:              aws.String(sequenceNumber),
+		ApproximateCreationDateTime: aws.Time(time.Now().Truncate(time.Second)),
+		StreamViewType:              aws.String(dynamodbstreams.StreamViewTypeNewAndOldImages),
+	}
+	eventName := db.StreamModify
+	var uuid string
+	if old != nil {
+		record.OldImage = fakeImage(*old)
+		uuid = old.UUID
+	} else {
+		eventName = db.StreamInsert
+	}
+	if new != nil {
+		record.NewImage = fakeImage(*new)
+		uuid = new.UUID
+	} else {
+		eventName = db.StreamRemove
+	}
+	record.Keys = map[string]*dynamodb.AttributeValue{db.TableHashKey: {S: aws.String(uuid)}}
+
+	shard := f.shard(shardId)
+	shard.records = append(shard.records, &dynamodbstreams.Record{EventName: aws.String(eventName), Dynamodb: record})
+	return sequenceNumber
+}
+
+// Trim removes the oldest records of a shard, as DynamoDB does after 24 hours.
+func (f *FakeStreams) Trim(shardId string, n int) {
+	f.Lock()
+	defer f.Unlock()
+	shard := f.shard(shardId)
+	shard.records = shard.records[n:]
+	shard.trimmed += n
+}
+
+// ExpireIterators makes every shard iterator returned so far expire, as DynamoDB does after 15 minutes.
+func (f *FakeStreams) ExpireIterators() {
+	f.Lock()
+	defer f.Unlock()
+	f.generation++
+}
+
+func fakeImage(m db.ConcordancesModel) map[string]*dynamodb.AttributeValue {
+	dm := db.DynamoConcordancesModel{UUID: m.UUID, ConcordedIds: m.ConcordedIds, Identifiers: m.Identifiers, TransactionID: m.TransactionID}
+	image, err := dynamodbattribute.MarshalMap(dm)
+	if err != nil {
+		panic(err)
+	}
+	return image
+}
+
+func (f *FakeStreams) shard(id string) *fakeShard {
+	for _, shard := range f.shards {
+		if shard.id == id {
+			return shard
+		}
+	}
+	panic("unknown shard " + id)
+}
+
+func (f *FakeStreams) DescribeStream(input *dynamodbstreams.DescribeStreamInput) (*dynamodbstreams.DescribeStreamOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	start := 0
+	if input.ExclusiveStartShardId != nil {
+		for i, shard := range f.shards {
+			if shard.id == *input.ExclusiveStartShardId {
+				start = i + 1
+			}
+		}
+	}
+	end := len(f.shards)
+	if f.PageSize > 0 && start+f.PageSize < end {
+		end = start + f.PageSize
+	}
+
+	description := &dynamodbstreams.StreamDescription{
+		StreamArn:      input.StreamArn,
+		StreamStatus:   aws.String(dynamodbstreams.StreamStatusEnabled),
+		StreamViewType: aws.String(dynamodbstreams.StreamViewTypeNewAndOldImages),
+		Shards:         []*dynamodbstreams.Shard{},
+	}
+	for _, shard := range f.shards[start:end] {
+		s := &dynamodbstreams.Shard{ShardId: aws.String(shard.id)}
+		if shard.parent != "" {
+			s.ParentShardId = aws.String(shard.parent)
+		}
+		description.Shards = append(description.Shards, s)
+	}
+	if end < len(f.shards) {
+		description.LastEvaluatedShardId = aws.String(f.shards[end-1].id)
+	}
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: description}, nil
+}
+
+func (f *FakeStreams) GetShardIterator(input *dynamodbstreams.GetShardIteratorInput) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	shard := f.shard(aws.StringValue(input.ShardId))
+
+	// Positions count the records of the shard, trimmed ones included.
+	var position int
+	switch aws.StringValue(input.ShardIteratorType) {
+	case dynamodbstreams.ShardIteratorTypeTrimHorizon:
+		position = shard.trimmed
+	case dynamodbstreams.ShardIteratorTypeLatest:
+		position = shard.trimmed + len(shard.records)
+	case dynamodbstreams.ShardIteratorTypeAfterSequenceNumber, dynamodbstreams.ShardIteratorTypeAtSequenceNumber:
+		position = -1
+		for i, record := range shard.records {
+			if *record.Dynamodb.SequenceNumber == aws.StringValue(input.SequenceNumber) {
+				position = shard.trimmed + i
+			}
+		}
+		if position < 0 {
+			return nil, awserr.New(dynamodbstreams.ErrCodeTrimmedDataAccessException, "sequence number is beyond the trim horizon", nil)
+		}
+		if aws.StringValue(input.ShardIteratorType) == dynamodbstreams.ShardIteratorTypeAfterSequenceNumber {
+			position++
+		}
+	default:
+		return nil, awserr.New("ValidationException", "unknown shard iterator type", nil)
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: aws.String(fmt.Sprintf("%s|%d|%d", shard.id, position, f.generation))}, nil
+}
+
+func (f *FakeStreams) GetRecords(input *dynamodbstreams.GetRecordsInput) (*dynamodbstreams.GetRecordsOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	parts := strings.Split(aws.StringValue(input.ShardIterator), "|")
+	if len(parts) != 3 {
+		return nil, awserr.New("ValidationException", "invalid shard iterator", nil)
+	}
+	position, _ := strconv.Atoi(parts[1])
+	generation, _ := strconv.Atoi(parts[2])
+	if generation != f.generation {
+		return nil, awserr.New(dynamodbstreams.ErrCodeExpiredIteratorException, "iterator expired", nil)
+	}
+	shard := f.shard(parts[0])
+	if position < shard.trimmed {
+		return nil, awserr.New(dynamodbstreams.ErrCodeTrimmedDataAccessException, "records were trimmed", nil)
+	}
+
+	start := position - shard.trimmed
+	end := len(shard.records)
+	limit := int(aws.Int64Value(input.Limit))
+	if f.PageSize > 0 && (limit == 0 || f.PageSize < limit) {
+		limit = f.PageSize
+	}
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	output := &dynamodbstreams.GetRecordsOutput{Records: shard.records[start:end]}
+	if !shard.closed || end < len(shard.records) {
+		output.NextShardIterator = aws.String(fmt.Sprintf("%s|%d|%d", shard.id, shard.trimmed+end, f.generation))
+	}
+	return output, nil
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"github.com/Financial-Times/concordances-rw-dynamodb/api"
 	"github.com/Financial-Times/concordances-rw-dynamodb/concordances"
+	db "github.com/Financial-Times/concordances-rw-dynamodb/dynamodb"
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/Financial-Times/concordances-rw-dynamodb/webhook"
 	log "github.com/sirupsen/logrus"
 	"github.com/gorilla/mux"
 	"github.com/jawher/mow.cli"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 const appDescription = "Reads / Writes concorded concepts to DynamoDB"
@@ -34,6 +40,17 @@ func main() {
 		Desc:   "Port to listen on",
 		EnvVar: "APP_PORT",
 	})
+	grpcPort := app.String(cli.StringOpt{
+		Name:   "grpcPort",
+		Desc:   "Port the gRPC API listens on, the gRPC API is disabled when empty",
+		EnvVar: "GRPC_PORT",
+	})
+	validateRequests := app.Bool(cli.BoolOpt{
+		Name:   "validateRequests",
+		Value:  true,
+		Desc:   "Reject requests which do not match the OpenAPI definition served at /__api before they are handled, only to be turned off while diagnosing a client",
+		EnvVar: "VALIDATE_REQUESTS",
+	})
 	awsRegion := app.String(cli.StringOpt{
 		Name:   "awsRegion",
 		Value:  "eu-west-1",
@@ -46,11 +63,204 @@ func main() {
 		Desc:   "Name of DynamoDB Table",
 		EnvVar: "DYNAMODB_TABLE_NAME",
 	})
+	secondaryAwsRegion := app.String(cli.StringOpt{
+		Name:   "secondaryAwsRegion",
+		Desc:   "AWS region of the secondary DynamoDB table, defaults to awsRegion",
+		EnvVar: "SECONDARY_AWS_REGION",
+	})
+	secondaryDynamoDbTableName := app.String(cli.StringOpt{
+		Name:   "secondaryDynamoDbTableName",
+		Desc:   "Name of the DynamoDB Table concordances are replicated to, replication is disabled when empty",
+		EnvVar: "SECONDARY_DYNAMODB_TABLE_NAME",
+	})
+	replicationMode := app.String(cli.StringOpt{
+		Name:   "replicationMode",
+		Value:  "sync",
+		Desc:   "Consistency of the replication to the secondary table: sync (write both tables) or async (write the secondary table in the background)",
+		EnvVar: "REPLICATION_MODE",
+	})
 	snsTopicArn := app.String(cli.StringOpt{
 		Name:   "snsTopicArn",
 		Desc:   "SNS Topic to notify about concordances events",
 		EnvVar: "SNS_TOPIC_ARN",
 	})
+	snsMessageFormat := app.String(cli.StringOpt{
+		Name:   "snsMessageFormat",
+		Value:  sns.MessageFormatLegacy,
+		Desc:   "Format of the messages sent to the SNS topic: legacy (fake S3 event with the UUID as key) or v1 (versioned concordance event)",
+		EnvVar: "SNS_MESSAGE_FORMAT",
+	})
+	snsMessageAttributes := app.String(cli.StringOpt{
+		Name:   "snsMessageAttributes",
+		Value:  strings.Join(sns.DefaultMessageAttributes, ","),
+		Desc:   "Comma separated message attributes sent with SNS messages for subscriber filter policies, any of eventType, transactionId, authority and schemaVersion",
+		EnvVar: "SNS_MESSAGE_ATTRIBUTES",
+	})
+	snsKeyPrefix := app.String(cli.StringOpt{
+		Name:   "snsKeyPrefix",
+		Desc:   "Prefix of the object keys of legacy SNS messages, e.g. concordances/",
+		EnvVar: "SNS_KEY_PREFIX",
+	})
+	snsKeySeparator := app.String(cli.StringOpt{
+		Name:   "snsKeySeparator",
+		Value:  sns.DefaultKeySeparator,
+		Desc:   "Separator the dashes of the UUID are replaced with in the object keys of legacy SNS messages, - keeps the UUID as it is",
+		EnvVar: "SNS_KEY_SEPARATOR",
+	})
+	snsKeySuffix := app.String(cli.StringOpt{
+		Name:   "snsKeySuffix",
+		Desc:   "Suffix of the object keys of legacy SNS messages, e.g. .json",
+		EnvVar: "SNS_KEY_SUFFIX",
+	})
+	snsKeyShardChars := app.Int(cli.IntOpt{
+		Name:   "snsKeyShardChars",
+		Value:  0,
+		Desc:   "Number of leading characters of the UUID the object keys of legacy SNS messages are sharded by, not sharded when 0",
+		EnvVar: "SNS_KEY_SHARD_CHARS",
+	})
+	notifier := app.String(cli.StringOpt{
+		Name:   "notifier",
+		Value:  concordances.NotifierSNS,
+		Desc:   "Where concordances events are sent: sns (the SNS topic) or webhook (the webhook URL)",
+		EnvVar: "NOTIFIER",
+	})
+	webhookUrl := app.String(cli.StringOpt{
+		Name:   "webhookUrl",
+		Desc:   "URL concordances events are posted to by the webhook notifier",
+		EnvVar: "WEBHOOK_URL",
+	})
+	webhookHeaders := app.String(cli.StringOpt{
+		Name:   "webhookHeaders",
+		Desc:   "JSON object of headers sent with every webhook request, e.g. {\"Authorization\":\"Bearer ...\"}",
+		EnvVar: "WEBHOOK_HEADERS",
+	})
+	webhookTimeout := app.String(cli.StringOpt{
+		Name:   "webhookTimeout",
+		Value:  webhook.DefaultTimeout.String(),
+		Desc:   "Timeout of webhook requests",
+		EnvVar: "WEBHOOK_TIMEOUT",
+	})
+	webhookRetries := app.Int(cli.IntOpt{
+		Name:   "webhookRetries",
+		Value:  webhook.DefaultRetries,
+		Desc:   "Number of times a failed webhook request is retried",
+		EnvVar: "WEBHOOK_RETRIES",
+	})
+	webhookMaxRetryTime := app.String(cli.StringOpt{
+		Name:   "webhookMaxRetryTime",
+		Value:  webhook.DefaultMaxRetryTime.String(),
+		Desc:   "Maximum time spent delivering an event to the webhook, retries included",
+		EnvVar: "WEBHOOK_MAX_RETRY_TIME",
+	})
+	webhookSecret := app.String(cli.StringOpt{
+		Name:   "webhookSecret",
+		Desc:   "Secret the body of webhook requests is signed with (HMAC-SHA256), requests are not signed when empty",
+		EnvVar: "WEBHOOK_SECRET",
+	})
+	tenants := app.String(cli.StringOpt{
+		Name:   "tenants",
+		Desc:   "JSON array of tenants stored in their own DynamoDB table, e.g. [{\"name\":\"factset\",\"dynamoDbTableName\":\"...\",\"snsTopicArn\":\"...\"}]",
+		EnvVar: "TENANTS",
+	})
+	maxConcordedIds := app.Int(cli.IntOpt{
+		Name:   "maxConcordedIds",
+		Value:  concordances.DefaultMaxConcordedIds,
+		Desc:   "Maximum number of concorded UUIDs accepted in a concordance",
+		EnvVar: "MAX_CONCORDED_IDS",
+	})
+	auditInterval := app.String(cli.StringOpt{
+		Name:   "auditInterval",
+		Desc:   "Interval between audits of the concordances tables, e.g. 24h, auditing is disabled when empty. Every instance audits, so set it on one instance only",
+		EnvVar: "AUDIT_INTERVAL",
+	})
+	auditReportDir := app.String(cli.StringOpt{
+		Name:   "auditReportDir",
+		Desc:   "Directory the JSON reports of scheduled audits are written to, reports are only kept in memory when empty",
+		EnvVar: "AUDIT_REPORT_DIR",
+	})
+	notificationOutbox := app.Bool(cli.BoolOpt{
+		Name:   "notificationOutbox",
+		Value:  false,
+		Desc:   "Record SNS notifications in the outbox of the changed record and deliver them in the background, so that every change is announced at least once",
+		EnvVar: "NOTIFICATION_OUTBOX",
+	})
+	outboxSweepInterval := app.String(cli.StringOpt{
+		Name:   "outboxSweepInterval",
+		Value:  concordances.DefaultOutboxSweepInterval.String(),
+		Desc:   "Interval between sweeps of the table for notifications that could not be delivered",
+		EnvVar: "OUTBOX_SWEEP_INTERVAL",
+	})
+	expirySweepInterval := app.String(cli.StringOpt{
+		Name:   "expirySweepInterval",
+		Value:  concordances.DefaultExpirySweepInterval.String(),
+		Desc:   "Interval between sweeps of the table for expired concordances, which are deleted and announced, sweeping is disabled when empty",
+		EnvVar: "EXPIRY_SWEEP_INTERVAL",
+	})
+	notificationFanOut := app.Bool(cli.BoolOpt{
+		Name:   "notificationFanOut",
+		Value:  false,
+		Desc:   "Announce changes to every concept added to or removed from a concordance too, in batches where the notifier supports it",
+		EnvVar: "NOTIFICATION_FAN_OUT",
+	})
+	notificationSource := app.String(cli.StringOpt{
+		Name:   "notificationSource",
+		Value:  concordances.NotificationSourceRequest,
+		Desc:   "Where changes are announced from, request for the changes made through the service, stream for every change read from the DynamoDB Stream of the table, which only one instance may do",
+		EnvVar: "NOTIFICATION_SOURCE",
+	})
+	streamArn := app.String(cli.StringOpt{
+		Name:   "streamArn",
+		Desc:   "ARN of the DynamoDB Stream changes are read from, the latest stream of the table when empty",
+		EnvVar: "STREAM_ARN",
+	})
+	streamCheckpointDir := app.String(cli.StringOpt{
+		Name:   "streamCheckpointDir",
+		Desc:   "Directory the positions reached in the DynamoDB Streams are kept in, they are only kept in memory when empty",
+		EnvVar: "STREAM_CHECKPOINT_DIR",
+	})
+	streamStartPosition := app.String(cli.StringOpt{
+		Name:   "streamStartPosition",
+		Value:  db.StreamStartLatest,
+		Desc:   "Where DynamoDB Streams are read from when no position was kept, latest or trim_horizon",
+		EnvVar: "STREAM_START_POSITION",
+	})
+	streamPollInterval := app.String(cli.StringOpt{
+		Name:   "streamPollInterval",
+		Value:  concordances.DefaultStreamPollInterval.String(),
+		Desc:   "Interval between polls of the DynamoDB Streams",
+		EnvVar: "STREAM_POLL_INTERVAL",
+	})
+	mirrorBucket := app.String(cli.StringOpt{
+		Name:   "mirrorBucket",
+		Desc:   "S3 bucket concordances are copied to, at the key legacy SNS messages announce, not copied when empty",
+		EnvVar: "MIRROR_BUCKET",
+	})
+	mirrorRegion := app.String(cli.StringOpt{
+		Name:   "mirrorRegion",
+		Desc:   "AWS region of the S3 mirror bucket, the region of the DynamoDB table when empty",
+		EnvVar: "MIRROR_REGION",
+	})
+	mirrorEndpoint := app.String(cli.StringOpt{
+		Name:   "mirrorEndpoint",
+		Desc:   "Endpoint of an S3-compatible object store holding the mirror bucket, e.g. http://localhost:9000, S3 when empty",
+		EnvVar: "MIRROR_ENDPOINT",
+	})
+	deadLetterDir := app.String(cli.StringOpt{
+		Name:   "deadLetterDir",
+		Desc:   "Directory notifications that could not be delivered are kept in as dead letters, dead letters are disabled when empty",
+		EnvVar: "DEAD_LETTER_DIR",
+	})
+	suppressionKey := app.String(cli.StringOpt{
+		Name:   "suppressionKey",
+		Desc:   "Key allowing requests with the X-Suppress-Notification header to change concordances without notifying downstream services, suppression is disabled when empty",
+		EnvVar: "SUPPRESSION_KEY",
+	})
+	republishRate := app.Int(cli.IntOpt{
+		Name:   "republishRate",
+		Value:  concordances.DefaultRepublishRate,
+		Desc:   "Number of notifications sent per second when republishing existing concordances",
+		EnvVar: "REPUBLISH_RATE",
+	})
 	logLevel := app.String(cli.StringOpt{
 		Name:   "logLevel",
 		Value:  "info",
@@ -60,7 +270,7 @@ func main() {
 
 	lvl, err := log.ParseLevel(*logLevel)
 	if err != nil {
-		log.Warnf("Log level %s could not be parsed, defaulting to info")
+		log.Warnf("Log level %s could not be parsed, defaulting to info", *logLevel)
 		lvl = log.InfoLevel
 	}
 	log.SetLevel(lvl)
@@ -68,29 +278,199 @@ func main() {
 
 	log.Infof("[Startup] %s is starting", *appSystemCode)
 
+	appConfig := func() concordances.AppConfig {
+		tenantConfigs, err := concordances.ParseTenants(*tenants)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid tenants configuration")
+		}
+
+		if err := sns.ValidateMessageFormat(*snsMessageFormat); err != nil {
+			log.WithError(err).Fatal("Invalid SNS message format")
+		}
+		attributes, err := sns.ParseMessageAttributes(*snsMessageAttributes)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid SNS message attributes")
+		}
+		keyLayout := sns.KeyLayout{Prefix: *snsKeyPrefix, Separator: *snsKeySeparator, Suffix: *snsKeySuffix, ShardChars: *snsKeyShardChars}
+		if err := keyLayout.Validate(); err != nil {
+			log.WithError(err).Fatal("Invalid SNS key layout")
+		}
+
+		var interval time.Duration
+		if *auditInterval != "" {
+			interval, err = time.ParseDuration(*auditInterval)
+			if err != nil {
+				log.WithError(err).Fatal("Invalid audit interval")
+			}
+		}
+
+		if *notifier != concordances.NotifierSNS && *notifier != concordances.NotifierWebhook {
+			log.WithField("notifier", *notifier).Fatal("Unknown notifier, expected sns or webhook")
+		}
+		if *notifier == concordances.NotifierWebhook && *webhookUrl == "" {
+			log.Fatal("The webhook notifier needs a webhook URL")
+		}
+		headers, err := webhook.ParseHeaders(*webhookHeaders)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid webhook headers")
+		}
+		timeout, err := time.ParseDuration(*webhookTimeout)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid webhook timeout")
+		}
+		maxRetryTime, err := time.ParseDuration(*webhookMaxRetryTime)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid webhook max retry time")
+		}
+
+		if *notificationSource != concordances.NotificationSourceRequest && *notificationSource != concordances.NotificationSourceStream {
+			log.WithField("notificationSource", *notificationSource).Fatal("Unknown notification source, expected request or stream")
+		}
+		if *notificationSource == concordances.NotificationSourceStream && *notificationOutbox {
+			log.Fatal("Notifications cannot be sent from both the DynamoDB stream and the outbox")
+		}
+		if err := db.ValidateStartPosition(*streamStartPosition); err != nil {
+			log.WithError(err).Fatal("Invalid stream start position")
+		}
+		pollInterval, err := time.ParseDuration(*streamPollInterval)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid stream poll interval")
+		}
+
+		// Dead letters are only kept where they survive a restart, as a request whose notification is kept succeeds.
+		var deadLetters *concordances.DeadLetterStore
+		if *deadLetterDir == "" {
+			log.Warn("No dead letter directory is configured, undelivered notifications will not be kept and requests will fail when their notification cannot be delivered")
+		} else if deadLetters, err = concordances.NewDeadLetterStore(*deadLetterDir); err != nil {
+			log.WithError(err).Fatal("Unable to load the dead letters")
+		}
+
+		sweepInterval, err := time.ParseDuration(*outboxSweepInterval)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid outbox sweep interval")
+		}
+
+		var expiryInterval time.Duration
+		if *expirySweepInterval != "" {
+			expiryInterval, err = time.ParseDuration(*expirySweepInterval)
+			if err != nil {
+				log.WithError(err).Fatal("Invalid expiry sweep interval")
+			}
+		}
+
+		return concordances.AppConfig{
+			AWSRegion:                  *awsRegion,
+			DynamoDbTableName:          *dynamoDbTableName,
+			SecondaryAWSRegion:         *secondaryAwsRegion,
+			SecondaryDynamoDbTableName: *secondaryDynamoDbTableName,
+			ReplicationMode:            *replicationMode,
+			SNSTopic:                   *snsTopicArn,
+			SNSMessageFormat:           *snsMessageFormat,
+			SNSMessageAttributes:       attributes,
+			SNSKeyLayout:               keyLayout,
+			MirrorBucket:               *mirrorBucket,
+			MirrorRegion:               *mirrorRegion,
+			MirrorEndpoint:             *mirrorEndpoint,
+			AppSystemCode:              *appSystemCode,
+			AppName:                    *appName,
+			Port:                       *port,
+			GRPCPort:                   *grpcPort,
+			Tenants:                    tenantConfigs,
+			MaxConcordedIds:            *maxConcordedIds,
+			AuditInterval:              interval,
+			AuditReportDir:             *auditReportDir,
+			RepublishRate:              *republishRate,
+			DeadLetters:                deadLetters,
+			SuppressionKey:             *suppressionKey,
+			NotificationOutbox:         *notificationOutbox,
+			OutboxSweepInterval:        sweepInterval,
+			ExpirySweepInterval:        expiryInterval,
+			NotificationSource:         *notificationSource,
+			NotificationFanOut:         *notificationFanOut,
+			StreamArn:                  *streamArn,
+			StreamCheckpointDir:        *streamCheckpointDir,
+			StreamStartPosition:        *streamStartPosition,
+			StreamPollInterval:         pollInterval,
+			Notifier:                   *notifier,
+			Webhook: webhook.Config{
+				URL:          *webhookUrl,
+				Headers:      headers,
+				Timeout:      timeout,
+				Retries:      *webhookRetries,
+				MaxRetryTime: maxRetryTime,
+				Secret:       *webhookSecret,
+			},
+		}
+	}
+
+	app.Command("audit", "Scans the concordances tables for data problems and writes a JSON report", func(cmd *cli.Cmd) {
+		output := cmd.String(cli.StringOpt{
+			Name:  "output",
+			Value: "-",
+			Desc:  "File the JSON report is written to, - for stdout",
+		})
+
+		cmd.Action = func() {
+			auditor := concordances.NewTableAuditor(appConfig())
+			reports := auditor.AuditAll()
+			if err := concordances.WriteAuditReports(*output, reports); err != nil {
+				log.WithError(err).Fatal("Unable to write audit report")
+			}
+
+			for _, report := range reports {
+				if report.Error != "" || report.Problems() > 0 {
+					cli.Exit(1)
+				}
+			}
+		}
+	})
+
 	app.Action = func() {
 		log.WithFields(log.Fields{
 			"System code": 	*appSystemCode,
 			"App Name": *appName,
 			"Port": *port,
+			"gRPC Port": *grpcPort,
+			"Validate Requests": *validateRequests,
 			"DynamoDb Table": *dynamoDbTableName,
 			"AWS Region": *awsRegion,
+			"Secondary DynamoDb Table": *secondaryDynamoDbTableName,
+			"Replication Mode": *replicationMode,
+			"Notification Outbox": *notificationOutbox,
+			"Notification Source": *notificationSource,
+			"Mirror Bucket": *mirrorBucket,
+			"Notification Fan-out": *notificationFanOut,
 			"SNS Topic": *snsTopicArn,
+			"Notifier": *notifier,
+			"Webhook URL": *webhookUrl,
+			"SNS Message Format": *snsMessageFormat,
 
 		}).Infof("Logging set to %s level", *logLevel)
 
-		conf := concordances.AppConfig{
-			AWSRegion:         *awsRegion,
-			DynamoDbTableName: *dynamoDbTableName,
-			SNSTopic:          *snsTopicArn,
-			AppSystemCode:     *appSystemCode,
-			AppName:           *appName,
-			Port:              *port,
-		}
+		conf := appConfig()
 
 		router := mux.NewRouter()
 		srv := concordances.NewConcordancesRwService(conf)
-		concordances.NewHandler(router, conf, srv)
+		tenantServices := concordances.NewTenantServices(conf)
+		concordances.NewHandler(router, conf, srv, tenantServices)
+
+		if *validateRequests {
+			validator, err := concordances.NewSpecValidator(api.Spec)
+			if err != nil {
+				log.WithError(err).Fatal("Invalid API definition")
+			}
+			router.Use(validator.Middleware)
+		}
+
+		if conf.GRPCPort != "" {
+			grpcServer := concordances.NewGRPCServer(conf, srv, tenantServices)
+			go func() {
+				log.Infof("gRPC API listening on %v", conf.GRPCPort)
+				if err := grpcServer.ListenAndServe(); err != nil {
+					log.WithError(err).Fatal("Unable to start gRPC server")
+				}
+			}()
+		}
 
 		log.Infof("Listening on %v", *port)
 		if err := http.ListenAndServe(":"+*port, router); err != nil {
@@ -0,0 +1,69 @@
+package s3
+
+import (
+	"bytes"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	log "github.com/sirupsen/logrus"
+)
+
+const contentType = "application/json"
+
+// Client stores documents in a bucket of S3 or of an S3-compatible object store.
+type Client struct {
+	client s3iface.S3API
+	bucket string
+}
+
+// NewS3Client stores documents in a bucket of S3, or of the S3-compatible object store at endpoint when it is set,
+// which is then addressed with path-style URLs, e.g. http://localhost:9000/bucket/key
+func NewS3Client(bucket string, region string, endpoint string) *Client {
+	return newS3Client(bucket, s3Config(region, endpoint))
+}
+
+func s3Config(region string, endpoint string) *aws.Config {
+	config := &aws.Config{Region: aws.String(region)}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+	return config
+}
+
+func newS3Client(bucket string, config *aws.Config) *Client {
+	sess := session.Must(session.NewSession(config))
+	return &Client{client: s3.New(sess), bucket: bucket}
+}
+
+// Put stores a JSON document at key, replacing the document stored there.
+func (c *Client) Put(key string, document []byte) error {
+	_, err := c.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(c.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(document),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"bucket": c.bucket, "key": key}).Error("Error storing concordance document in S3")
+	}
+	return err
+}
+
+// Delete removes the document at key, which is not an error when there is none.
+func (c *Client) Delete(key string) error {
+	_, err := c.client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(key)})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"bucket": c.bucket, "key": key}).Error("Error deleting concordance document from S3")
+	}
+	return err
+}
+
+func (c *Client) Healthcheck() (bool, error) {
+	if _, err := c.client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(c.bucket)}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
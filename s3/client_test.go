@@ -0,0 +1,61 @@
+package s3
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/internal/testutil"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	BUCKET = "concordances"
+	KEY    = "9b40e89c/e87b/3d4f/b72c/2cf7511d2146"
+)
+
+func newFakeClient(bucket string) (*Client, *testutil.FakeObjectStore, func()) {
+	store := testutil.NewFakeObjectStore(BUCKET)
+	server := httptest.NewServer(store)
+	config := s3Config("eu-west-1", server.URL)
+	config.Credentials = credentials.NewStaticCredentials("key", "secret", "")
+	return newS3Client(bucket, config), store, server.Close
+}
+
+func TestPutAndDelete(t *testing.T) {
+	client, store, stop := newFakeClient(BUCKET)
+	defer stop()
+
+	assert.NoError(t, client.Put(KEY, []byte(`{"uuid":"9b40e89c-e87b-3d4f-b72c-2cf7511d2146"}`)))
+	body, contentType, found := store.Object(BUCKET, KEY)
+	assert.True(t, found, "Document should be stored at its key")
+	assert.Equal(t, `{"uuid":"9b40e89c-e87b-3d4f-b72c-2cf7511d2146"}`, string(body))
+	assert.Equal(t, "application/json", contentType)
+
+	assert.NoError(t, client.Put(KEY, []byte(`{}`)))
+	body, _, _ = store.Object(BUCKET, KEY)
+	assert.Equal(t, `{}`, string(body), "Document should be replaced")
+
+	assert.NoError(t, client.Delete(KEY))
+	assert.Empty(t, store.Keys(BUCKET))
+	assert.NoError(t, client.Delete(KEY), "Deleting a missing document should not fail")
+}
+
+func TestUnknownBucket(t *testing.T) {
+	client, _, stop := newFakeClient("missing")
+	defer stop()
+
+	assert.Error(t, client.Put(KEY, []byte(`{}`)))
+	healthy, err := client.Healthcheck()
+	assert.False(t, healthy)
+	assert.Error(t, err)
+}
+
+func TestHealthcheck(t *testing.T) {
+	client, _, stop := newFakeClient(BUCKET)
+	defer stop()
+
+	healthy, err := client.Healthcheck()
+	assert.True(t, healthy)
+	assert.NoError(t, err)
+}
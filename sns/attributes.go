@@ -0,0 +1,71 @@
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// Message attributes subscribers can match in their SNS filter policies.
+const (
+	AttributeEventType     = "eventType"
+	AttributeTransactionID = "transactionId"
+	AttributeAuthority     = "authority"
+	AttributeSchemaVersion = "schemaVersion"
+)
+
+var DefaultMessageAttributes = []string{AttributeEventType, AttributeTransactionID, AttributeAuthority, AttributeSchemaVersion}
+
+// ParseMessageAttributes reads a comma separated list of message attribute names. An empty list disables message attributes.
+func ParseMessageAttributes(attributes string) ([]string, error) {
+	names := []string{}
+	for _, name := range strings.Split(attributes, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		switch name {
+		case AttributeEventType, AttributeTransactionID, AttributeAuthority, AttributeSchemaVersion:
+			names = append(names, name)
+		default:
+			return nil, fmt.Errorf("unknown SNS message attribute %q, expected any of %s", name, strings.Join(DefaultMessageAttributes, ", "))
+		}
+	}
+	return names, nil
+}
+
+// messageAttributes returns the configured attributes of an event. Attributes without a value are left out, as SNS rejects empty attributes,
+// and the legacy message format has no schema version.
+func (c *Client) messageAttributes(event Event) map[string]*sns.MessageAttributeValue {
+	attributes := map[string]*sns.MessageAttributeValue{}
+	for _, name := range c.attributes {
+		switch name {
+		case AttributeEventType:
+			setStringAttribute(attributes, name, event.Type)
+		case AttributeTransactionID:
+			setStringAttribute(attributes, name, event.TransactionID)
+		case AttributeSchemaVersion:
+			if c.format == MessageFormatV1 {
+				setStringAttribute(attributes, name, event.SchemaVersion)
+			}
+		case AttributeAuthority:
+			if len(event.Authorities) > 0 {
+				authorities, _ := json.Marshal(event.Authorities)
+				attributes[name] = &sns.MessageAttributeValue{DataType: aws.String("String.Array"), StringValue: aws.String(string(authorities))}
+			}
+		}
+	}
+	if len(attributes) == 0 {
+		return nil
+	}
+	return attributes
+}
+
+func setStringAttribute(attributes map[string]*sns.MessageAttributeValue, name string, value string) {
+	if value != "" {
+		attributes[name] = &sns.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+	}
+}
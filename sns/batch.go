@@ -0,0 +1,68 @@
+package sns
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxBatchSize is the most messages SNS publishes at once.
+const maxBatchSize = 10
+
+// SendMessages publishes events in batches, failing if any of them could not be published.
+func (c *Client) SendMessages(events []Event) error {
+	for start := 0; start < len(events); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(events) {
+			end = len(events)
+		}
+		if err := c.sendBatch(events[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) sendBatch(events []Event) error {
+	transactionId := events[0].TransactionID
+	entries := make([]*sns.PublishBatchRequestEntry, 0, len(events))
+	for i, event := range events {
+		message, err := c.message(event)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"transaction_id": event.TransactionID, "UUID": event.UUID, "Topic": c.topicArn}).Error("Error formatting concordance event record")
+			return err
+		}
+		entry := &sns.PublishBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			Message:           message,
+			MessageAttributes: c.messageAttributes(event),
+		}
+		if c.fifo {
+			entry.MessageGroupId = aws.String(event.UUID)
+			entry.MessageDeduplicationId = aws.String(deduplicationID(event.TransactionID, *message))
+		}
+		entries = append(entries, entry)
+	}
+
+	resp, err := c.client.PublishBatch(&sns.PublishBatchInput{PublishBatchRequestEntries: entries, TopicArn: aws.String(c.topicArn)})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"transaction_id": transactionId, "Topic": c.topicArn}).Error("Error sending concordance event records to SNS")
+		return classify(err)
+	}
+	if len(resp.Failed) > 0 {
+		failed := resp.Failed[0]
+		uuid := ""
+		if i, err := strconv.Atoi(aws.StringValue(failed.Id)); err == nil && i < len(events) {
+			uuid = events[i].UUID
+		}
+		err := fmt.Errorf("%d of %d concordance event records could not be sent to SNS, e.g. %s: %s", len(resp.Failed), len(events), uuid, aws.StringValue(failed.Message))
+		log.WithError(err).WithFields(log.Fields{"transaction_id": transactionId, "Topic": c.topicArn}).Error("Error sending concordance event records to SNS")
+		return err
+	}
+
+	log.WithFields(log.Fields{"transaction_id": transactionId, "Topic": c.topicArn, "Messages": len(events)}).Info("Successfully sent concordance event records to SNS")
+	return nil
+}
@@ -0,0 +1,84 @@
+package sns
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/stretchr/testify/assert"
+)
+
+type capturePublishBatchInput struct {
+	snsiface.SNSAPI
+	inputs []*sns.PublishBatchInput
+	failed []*sns.BatchResultErrorEntry
+	err    error
+}
+
+func (c *capturePublishBatchInput) PublishBatch(in *sns.PublishBatchInput) (*sns.PublishBatchOutput, error) {
+	c.inputs = append(c.inputs, in)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &sns.PublishBatchOutput{Failed: c.failed}, nil
+}
+
+func batchEvents(n int) []Event {
+	events := []Event{}
+	for i := 0; i < n; i++ {
+		events = append(events, NewEvent(EventConcorded, fmt.Sprintf("uuid-%d", i), "testing_transaction_id", nil, nil))
+	}
+	return events
+}
+
+func TestSendMessagesInBatches(t *testing.T) {
+	mockSnsService := capturePublishBatchInput{}
+	client := Client{client: &mockSnsService, topicArn: TOPIC, awsRegion: AWS_REGION, format: MessageFormatV1, attributes: DefaultMessageAttributes}
+
+	assert.NoError(t, client.SendMessages(batchEvents(12)))
+
+	assert.Len(t, mockSnsService.inputs, 2, "Events should be sent ten at a time")
+	assert.Len(t, mockSnsService.inputs[0].PublishBatchRequestEntries, 10)
+	assert.Len(t, mockSnsService.inputs[1].PublishBatchRequestEntries, 2)
+	for _, input := range mockSnsService.inputs {
+		assert.NoError(t, input.Validate(), "PublishBatchInput is not valid")
+		assert.Equal(t, TOPIC, *input.TopicArn)
+	}
+	entry := mockSnsService.inputs[1].PublishBatchRequestEntries[1]
+	assert.Contains(t, *entry.Message, "uuid-11")
+	assert.Equal(t, EventConcorded, *entry.MessageAttributes[AttributeEventType].StringValue)
+	assert.Nil(t, entry.MessageGroupId)
+}
+
+func TestSendMessagesToFIFOTopic(t *testing.T) {
+	mockSnsService := capturePublishBatchInput{}
+	client := Client{client: &mockSnsService, topicArn: FIFO_TOPIC, awsRegion: AWS_REGION, format: MessageFormatV1, fifo: true}
+
+	assert.NoError(t, client.SendMessages(batchEvents(2)))
+
+	entries := mockSnsService.inputs[0].PublishBatchRequestEntries
+	assert.Equal(t, "uuid-0", *entries[0].MessageGroupId)
+	assert.Equal(t, "uuid-1", *entries[1].MessageGroupId)
+	assert.NotEqual(t, *entries[0].MessageDeduplicationId, *entries[1].MessageDeduplicationId)
+}
+
+func TestSendMessagesFailedEntries(t *testing.T) {
+	mockSnsService := capturePublishBatchInput{failed: []*sns.BatchResultErrorEntry{{Id: aws.String("1"), Code: aws.String("InternalError"), Message: aws.String("internal error"), SenderFault: aws.Bool(false)}}}
+	client := Client{client: &mockSnsService, topicArn: TOPIC, awsRegion: AWS_REGION, format: MessageFormatV1}
+
+	err := client.SendMessages(batchEvents(2))
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "uuid-1")
+}
+
+func TestSendMessagesError(t *testing.T) {
+	mockSnsService := capturePublishBatchInput{err: errors.New("SNS error")}
+	client := Client{client: &mockSnsService, topicArn: TOPIC, awsRegion: AWS_REGION, format: MessageFormatV1}
+
+	assert.Error(t, client.SendMessages(batchEvents(12)))
+	assert.Len(t, mockSnsService.inputs, 1, "Sending should stop at the first failed batch")
+}
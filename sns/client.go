@@ -1,13 +1,11 @@
 package sns
 
 import (
-	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/sns/snsiface"
-	"strings"
 )
 
 const (
@@ -16,43 +14,59 @@ const (
 )
 
 type Clienter interface {
-	SendMessage(uuid string, transactionId string) error
+	SendMessage(event Event) error
 	Healthcheck() (bool, error)
 }
 
 type Client struct {
-	client    snsiface.SNSAPI
-	topicArn  string
-	awsRegion string
+	client     snsiface.SNSAPI
+	topicArn   string
+	awsRegion  string
+	format     string
+	attributes []string
+	// keyLayout is the layout of the object keys of legacy messages.
+	keyLayout KeyLayout
+	// fifo topics deliver the messages of each concept in the order they were sent.
+	fifo bool
 }
 
-func NewSNSClient(topic string, region string) *Client {
+func NewSNSClient(topic string, region string, format string, attributes []string, keyLayout KeyLayout) *Client {
 	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String(region)}))
 	svc := sns.New(sess)
-	snsClient := Client{client: svc, topicArn: topic, awsRegion: region}
+	snsClient := Client{client: svc, topicArn: topic, awsRegion: region, format: format, attributes: attributes, keyLayout: keyLayout, fifo: IsFIFOTopic(topic)}
 	return &snsClient
 }
 
-func (c *Client) message(uuid string) *string {
-	n := strings.Replace(uuid, "-", "/", -1)
-	m := fmt.Sprintf(SNS_MSG, n)
-	return aws.String(m)
+func (c *Client) message(event Event) (*string, error) {
+	m, err := formatMessage(c.format, c.keyLayout, event)
+	return aws.String(m), err
 }
 
-func (c *Client) SendMessage(uuid string, transactionId string) (err error) {
+func (c *Client) SendMessage(event Event) (err error) {
+	uuid, transactionId := event.UUID, event.TransactionID
+	message, err := c.message(event)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"transaction_id": transactionId, "UUID": uuid, "Topic": c.topicArn}).Error("Error formatting concordance event record")
+		return err
+	}
 
 	params := &sns.PublishInput{
-		Message:  c.message(uuid),
-		TopicArn: aws.String(c.topicArn),
+		Message:           message,
+		MessageAttributes: c.messageAttributes(event),
+		TopicArn:          aws.String(c.topicArn),
+	}
+	if c.fifo {
+		params.MessageGroupId = aws.String(uuid)
+		params.MessageDeduplicationId = aws.String(deduplicationID(transactionId, *message))
 	}
 	resp, err := c.client.Publish(params)
 
 	if err != nil {
-		log.WithError(err).WithFields(log.Fields{"transaction_id": transactionId, "UUID": uuid, "Topic": c.topicArn}).Info("Error sending concordance event record to SNS")
-		return err
+		log.WithError(err).WithFields(log.Fields{"transaction_id": transactionId, "UUID": uuid, "Topic": c.topicArn}).Error("Error sending concordance event record to SNS")
+		return classify(err)
 	}
 
-	log.WithFields(log.Fields{"transaction_id":transactionId, "UUID": uuid, "Topic": c.topicArn, "SNS_Response": resp}).Info("Successfully sent concordance event record to SNS")
+	log.WithFields(log.Fields{"transaction_id":transactionId, "UUID": uuid, "Topic": c.topicArn, "SNS_Response": resp, "Event_Type": event.Type}).Info("Successfully sent concordance event record to SNS")
 	return nil
 }
 
@@ -61,6 +75,9 @@ func (c *Client) Healthcheck() (bool, error) {
 	output, err := c.client.GetTopicAttributes(params)
 	var attributes map[string]*string = output.Attributes
 	if len(attributes) > 0 {
+		if err := validateTopicType(c.topicArn, attributes); err != nil {
+			return false, err
+		}
 		return true, nil
 	}
 	return false, err
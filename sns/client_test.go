@@ -1,6 +1,7 @@
 package sns
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/sns/snsiface"
 	"github.com/stretchr/testify/assert"
@@ -43,14 +44,15 @@ func (c AssertPublishInput) GetTopicAttributes(input *sns.GetTopicAttributesInpu
 func TestMessageFormattedCorrectly(t *testing.T) {
 	mockSnsService := AssertPublishInput{}
 	client := Client{client: &mockSnsService, topicArn: TOPIC, awsRegion: AWS_REGION}
-	actualMessage := client.message(UUID)
+	actualMessage, err := client.message(NewEvent(EventUpdated, UUID, "testing_transaction_id", nil, nil))
+	assert.NoError(t, err, "Received error")
 	assert.Equal(t, ExpectedMessage, *actualMessage, "Expected and Actual messages did not match.")
 }
 
 func TestPublishInputHasData(t *testing.T) {
 	mockSnsService := AssertPublishInput{tT: t}
 	client := Client{client: &mockSnsService, topicArn: TOPIC, awsRegion: AWS_REGION}
-	err := client.SendMessage(UUID, "testing_transaction_id")
+	err := client.SendMessage(NewEvent(EventUpdated, UUID, "testing_transaction_id", nil, nil))
 	assert.NoError(t, err, "Received error")
 }
 
@@ -68,4 +70,137 @@ func TestSNSClient_HealthcheckUnhappy(t *testing.T) {
 	happy, err := client.Healthcheck()
 	assert.NotEmpty(t, err.Error())
 	assert.False(t, happy)
-}
\ No newline at end of file
+}
+type capturePublishInput struct {
+	snsiface.SNSAPI
+	input *sns.PublishInput
+}
+
+func (c *capturePublishInput) Publish(in *sns.PublishInput) (*sns.PublishOutput, error) {
+	c.input = in
+	return &sns.PublishOutput{}, nil
+}
+
+func TestPublishInputHasMessageAttributes(t *testing.T) {
+	mockSnsService := capturePublishInput{}
+	client := Client{client: &mockSnsService, topicArn: TOPIC, awsRegion: AWS_REGION, format: MessageFormatV1, attributes: DefaultMessageAttributes}
+	event := NewEvent(EventCreated, UUID, "testing_transaction_id", nil, []string{"A"})
+	event.Authorities = []string{"FACTSET", "TME"}
+
+	err := client.SendMessage(event)
+
+	assert.NoError(t, err, "Received error")
+	assert.NoError(t, mockSnsService.input.Validate(), "PublishInput is not valid")
+	attributes := mockSnsService.input.MessageAttributes
+	assert.Len(t, attributes, 4)
+	assert.Equal(t, "String", *attributes[AttributeEventType].DataType)
+	assert.Equal(t, EventCreated, *attributes[AttributeEventType].StringValue)
+	assert.Equal(t, "testing_transaction_id", *attributes[AttributeTransactionID].StringValue)
+	assert.Equal(t, SchemaVersion, *attributes[AttributeSchemaVersion].StringValue)
+	assert.Equal(t, "String.Array", *attributes[AttributeAuthority].DataType)
+	assert.Equal(t, `["FACTSET","TME"]`, *attributes[AttributeAuthority].StringValue)
+}
+
+func TestPublishInputLeavesOutEmptyAttributes(t *testing.T) {
+	mockSnsService := capturePublishInput{}
+	client := Client{client: &mockSnsService, topicArn: TOPIC, awsRegion: AWS_REGION, format: MessageFormatLegacy, attributes: DefaultMessageAttributes}
+
+	err := client.SendMessage(NewEvent(EventDeleted, UUID, "", nil, nil))
+
+	assert.NoError(t, err, "Received error")
+	assert.NoError(t, mockSnsService.input.Validate(), "PublishInput is not valid")
+	attributes := mockSnsService.input.MessageAttributes
+	assert.Len(t, attributes, 1, "Attributes without a value, and the schema version of legacy messages, should be left out")
+	assert.Equal(t, EventDeleted, *attributes[AttributeEventType].StringValue)
+}
+
+func TestPublishInputWithoutAttributes(t *testing.T) {
+	mockSnsService := capturePublishInput{}
+	client := Client{client: &mockSnsService, topicArn: TOPIC, awsRegion: AWS_REGION}
+
+	err := client.SendMessage(NewEvent(EventDeleted, UUID, "testing_transaction_id", nil, nil))
+
+	assert.NoError(t, err, "Received error")
+	assert.Nil(t, mockSnsService.input.MessageAttributes, "No message attributes were configured")
+}
+
+func TestParseMessageAttributes(t *testing.T) {
+	attributes, err := ParseMessageAttributes(" eventType, authority ,")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{AttributeEventType, AttributeAuthority}, attributes)
+
+	attributes, err = ParseMessageAttributes("")
+	assert.NoError(t, err)
+	assert.Empty(t, attributes)
+
+	_, err = ParseMessageAttributes("eventType,colour")
+	assert.Error(t, err, "Unknown attribute was accepted")
+}
+
+const FIFO_TOPIC = "arn:aws:sns:eu-west-1:027104099916:upp-concordance-semantic-SNSTopic-SCOTT1234.fifo"
+
+func TestPublishInputForFIFOTopic(t *testing.T) {
+	mockSnsService := capturePublishInput{}
+	client := Client{client: &mockSnsService, topicArn: FIFO_TOPIC, awsRegion: AWS_REGION, format: MessageFormatV1, fifo: true}
+	event := NewEvent(EventUpdated, UUID, "testing_transaction_id", nil, []string{"A"})
+
+	err := client.SendMessage(event)
+
+	assert.NoError(t, err, "Received error")
+	assert.NoError(t, mockSnsService.input.Validate(), "PublishInput is not valid")
+	assert.Equal(t, UUID, *mockSnsService.input.MessageGroupId, "Messages of a concept should be ordered in their own group")
+	deduplicationId := *mockSnsService.input.MessageDeduplicationId
+	assert.Len(t, deduplicationId, 64)
+
+	assert.NoError(t, client.SendMessage(event))
+	assert.Equal(t, deduplicationId, *mockSnsService.input.MessageDeduplicationId, "The same event sent again should be deduplicated")
+
+	event.TransactionID = "another_transaction_id"
+	assert.NoError(t, client.SendMessage(event))
+	assert.NotEqual(t, deduplicationId, *mockSnsService.input.MessageDeduplicationId, "Events of different transactions should not be deduplicated")
+}
+
+func TestPublishInputForStandardTopic(t *testing.T) {
+	mockSnsService := capturePublishInput{}
+	client := Client{client: &mockSnsService, topicArn: TOPIC, awsRegion: AWS_REGION}
+
+	assert.NoError(t, client.SendMessage(NewEvent(EventUpdated, UUID, "testing_transaction_id", nil, nil)))
+	assert.Nil(t, mockSnsService.input.MessageGroupId)
+	assert.Nil(t, mockSnsService.input.MessageDeduplicationId)
+}
+
+type topicAttributes struct {
+	snsiface.SNSAPI
+	attributes map[string]*string
+}
+
+func (c topicAttributes) GetTopicAttributes(input *sns.GetTopicAttributesInput) (*sns.GetTopicAttributesOutput, error) {
+	return &sns.GetTopicAttributesOutput{Attributes: c.attributes}, nil
+}
+
+func TestSNSClient_HealthcheckValidatesTopicType(t *testing.T) {
+	fifo := map[string]*string{"TopicArn": aws.String(FIFO_TOPIC), "FifoTopic": aws.String("true")}
+	standard := map[string]*string{"TopicArn": aws.String(TOPIC)}
+	testCases := []struct {
+		description string
+		topicArn    string
+		attributes  map[string]*string
+		healthy     bool
+	}{
+		{"FIFO topic", FIFO_TOPIC, fifo, true},
+		{"Standard topic", TOPIC, standard, true},
+		{"FIFO topic without .fifo ARN", TOPIC, fifo, false},
+		{"Standard topic with .fifo ARN", FIFO_TOPIC, standard, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			client := Client{client: topicAttributes{attributes: testCase.attributes}, topicArn: testCase.topicArn, awsRegion: AWS_REGION, fifo: IsFIFOTopic(testCase.topicArn)}
+			healthy, err := client.Healthcheck()
+			assert.Equal(t, testCase.healthy, healthy)
+			if !testCase.healthy {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package sns
+
+import (
+	"github.com/Financial-Times/concordances-rw-dynamodb/awserrors"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// errorKinds are the kinds of the error codes of SNS, besides throttling and timeouts.
+var errorKinds = map[string]awserrors.ErrorKind{
+	sns.ErrCodeThrottledException:             awserrors.KindThrottled,
+	sns.ErrCodeKMSThrottlingException:         awserrors.KindThrottled,
+	sns.ErrCodeAuthorizationErrorException:    awserrors.KindAccessDenied,
+	sns.ErrCodeKMSAccessDeniedException:       awserrors.KindAccessDenied,
+	sns.ErrCodeInvalidSecurityException:       awserrors.KindAccessDenied,
+	"InvalidClientTokenId":                    awserrors.KindAccessDenied,
+	"SignatureDoesNotMatch":                   awserrors.KindAccessDenied,
+	"ExpiredToken":                            awserrors.KindAccessDenied,
+	"NoCredentialProviders":                   awserrors.KindAccessDenied,
+	"MissingRegion":                           awserrors.KindAccessDenied,
+	sns.ErrCodeInvalidParameterException:      awserrors.KindValidation,
+	sns.ErrCodeInvalidParameterValueException: awserrors.KindValidation,
+	sns.ErrCodeValidationException:            awserrors.KindValidation,
+	sns.ErrCodeBatchRequestTooLongException:   awserrors.KindValidation,
+	sns.ErrCodeNotFoundException:              awserrors.KindNotFound,
+	sns.ErrCodeResourceNotFoundException:      awserrors.KindNotFound,
+}
+
+// classify returns the errors of SNS of a known kind as an awserrors.Error, and any other error as it is.
+func classify(err error) error {
+	return awserrors.Classify(awserrors.ServiceSNS, err, errorKinds)
+}
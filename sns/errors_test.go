@@ -0,0 +1,77 @@
+package sns
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/awserrors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+type failingPublish struct {
+	snsiface.SNSAPI
+	err error
+}
+
+func (f *failingPublish) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	return nil, f.err
+}
+
+func TestClassify(t *testing.T) {
+	testCases := []struct {
+		description  string
+		err          error
+		expectedKind awserrors.ErrorKind
+	}{
+		{"Throttled", awserr.New(sns.ErrCodeThrottledException, "rate exceeded", nil), awserrors.KindThrottled},
+		{"Throttling", awserr.New("Throttling", "rate exceeded", nil), awserrors.KindThrottled},
+		{"Authorization error", awserr.New(sns.ErrCodeAuthorizationErrorException, "not authorized to perform SNS:Publish", nil), awserrors.KindAccessDenied},
+		{"KMS access denied", awserr.New(sns.ErrCodeKMSAccessDeniedException, "access denied to the key", nil), awserrors.KindAccessDenied},
+		{"Invalid parameter", awserr.New(sns.ErrCodeInvalidParameterException, "message too long", nil), awserrors.KindValidation},
+		{"Missing topic", awserr.New(sns.ErrCodeNotFoundException, "topic does not exist", nil), awserrors.KindNotFound},
+		{"Response timeout", awserr.New(request.ErrCodeResponseTimeout, "read on body has reached the timeout limit", nil), awserrors.KindTimeout},
+		{"Network timeout", awserr.New(request.ErrCodeRequestError, "send request failed", &url.Error{Op: "Post", URL: "https://sns", Err: timeoutError{}}), awserrors.KindTimeout},
+		{"Internal error", awserr.New(sns.ErrCodeInternalErrorException, "internal error", nil), awserrors.KindUnknown},
+		{"Other error", errors.New("not an AWS error"), awserrors.KindUnknown},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			err := classify(testCase.err)
+
+			assert.Equal(t, testCase.expectedKind, awserrors.KindOf(err))
+			if testCase.expectedKind != awserrors.KindUnknown {
+				assert.Equal(t, awserrors.ServiceSNS, awserrors.ServiceOf(err))
+			}
+			assert.Equal(t, testCase.err.Error(), err.Error())
+			if testCase.expectedKind == awserrors.KindUnknown {
+				assert.Equal(t, testCase.err, err, "Errors of unknown kind should be returned as they are")
+			}
+		})
+	}
+}
+
+func TestSendMessageClassifiesErrors(t *testing.T) {
+	client := Client{client: &failingPublish{err: awserr.New(sns.ErrCodeNotFoundException, "topic does not exist", nil)}, topicArn: TOPIC, awsRegion: AWS_REGION}
+
+	err := client.SendMessage(NewEvent(EventCreated, "uuid", "testing_transaction_id", nil, []string{"concorded-uuid"}))
+
+	assert.Equal(t, awserrors.KindNotFound, awserrors.KindOf(err))
+}
+
+func TestSendMessagesClassifiesErrors(t *testing.T) {
+	mockSnsService := capturePublishBatchInput{err: awserr.New(sns.ErrCodeThrottledException, "rate exceeded", nil)}
+	client := Client{client: &mockSnsService, topicArn: TOPIC, awsRegion: AWS_REGION, format: MessageFormatV1}
+
+	assert.Equal(t, awserrors.KindThrottled, awserrors.KindOf(client.SendMessages(batchEvents(2))))
+}
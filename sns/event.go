@@ -0,0 +1,71 @@
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// MessageFormatLegacy is the fake S3 event consumers originally expected, which only carries the UUID.
+	MessageFormatLegacy = "legacy"
+	// MessageFormatV1 is the versioned concordance event, see Event.
+	MessageFormatV1 = "v1"
+
+	SchemaVersion = "1"
+
+	EventCreated = "CREATED"
+	EventUpdated = "UPDATED"
+	EventDeleted = "DELETED"
+)
+
+// Event describes a change to the concordance record of a concept.
+type Event struct {
+	SchemaVersion   string    `json:"schemaVersion"`
+	Type            string    `json:"eventType"`
+	UUID            string    `json:"uuid"`
+	TransactionID   string    `json:"transactionId"`
+	Timestamp       time.Time `json:"timestamp"`
+	OldConcordedIds []string  `json:"oldConcordedIds"`
+	NewConcordedIds []string  `json:"newConcordedIds"`
+	// ConcordedBy is the concept whose concordance changed, for the events of the concepts it affects.
+	ConcordedBy string `json:"concordedBy,omitempty"`
+	// Authorities of the identifiers of the concordance before and after the change, only sent as a message attribute.
+	Authorities []string `json:"-"`
+}
+
+// NewEvent creates an event of the current schema version, timestamped now.
+func NewEvent(eventType string, uuid string, transactionId string, oldConcordedIds []string, newConcordedIds []string) Event {
+	if oldConcordedIds == nil {
+		oldConcordedIds = []string{}
+	}
+	if newConcordedIds == nil {
+		newConcordedIds = []string{}
+	}
+	return Event{
+		SchemaVersion:   SchemaVersion,
+		Type:            eventType,
+		UUID:            uuid,
+		TransactionID:   transactionId,
+		Timestamp:       time.Now().UTC(),
+		OldConcordedIds: oldConcordedIds,
+		NewConcordedIds: newConcordedIds,
+	}
+}
+
+// ValidateMessageFormat returns an error unless format is one of the supported message formats.
+func ValidateMessageFormat(format string) error {
+	switch format {
+	case MessageFormatLegacy, MessageFormatV1:
+		return nil
+	}
+	return fmt.Errorf("unknown SNS message format %q, expected %s or %s", format, MessageFormatLegacy, MessageFormatV1)
+}
+
+func formatMessage(format string, layout KeyLayout, event Event) (string, error) {
+	if format == MessageFormatV1 {
+		data, err := json.Marshal(event)
+		return string(data), err
+	}
+	return fmt.Sprintf(SNS_MSG, layout.Key(event.UUID)), nil
+}
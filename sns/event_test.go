@@ -0,0 +1,70 @@
+package sns
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEvent(t *testing.T) {
+	before := time.Now()
+	event := NewEvent(EventCreated, UUID, "testing_transaction_id", nil, []string{"A"})
+
+	assert.Equal(t, SchemaVersion, event.SchemaVersion)
+	assert.Equal(t, EventCreated, event.Type)
+	assert.Equal(t, UUID, event.UUID)
+	assert.Equal(t, "testing_transaction_id", event.TransactionID)
+	assert.False(t, event.Timestamp.Before(before.Truncate(time.Second)), "Event was not timestamped")
+	assert.Equal(t, []string{}, event.OldConcordedIds, "Missing concorded UUIDs should be an empty list")
+	assert.Equal(t, []string{"A"}, event.NewConcordedIds)
+}
+
+func TestV1MessageFormat(t *testing.T) {
+	event := Event{
+		SchemaVersion:   SchemaVersion,
+		Type:            EventUpdated,
+		UUID:            UUID,
+		TransactionID:   "testing_transaction_id",
+		Timestamp:       time.Date(2017, 11, 1, 12, 0, 0, 0, time.UTC),
+		OldConcordedIds: []string{"A"},
+		NewConcordedIds: []string{"A", "B"},
+	}
+	client := Client{topicArn: TOPIC, awsRegion: AWS_REGION, format: MessageFormatV1}
+
+	message, err := client.message(event)
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"schemaVersion": "1",
+		"eventType": "UPDATED",
+		"uuid": "9b40e89c-e87b-3d4f-b72c-2cf7511d2146",
+		"transactionId": "testing_transaction_id",
+		"timestamp": "2017-11-01T12:00:00Z",
+		"oldConcordedIds": ["A"],
+		"newConcordedIds": ["A", "B"]
+	}`, *message)
+
+	decoded := Event{}
+	assert.NoError(t, json.Unmarshal([]byte(*message), &decoded))
+	assert.Equal(t, event, decoded)
+}
+
+func TestLegacyMessageFormatIsDefault(t *testing.T) {
+	event := NewEvent(EventDeleted, UUID, "testing_transaction_id", []string{"A"}, nil)
+
+	legacy, err := formatMessage(MessageFormatLegacy, KeyLayout{}, event)
+	assert.NoError(t, err)
+	assert.Equal(t, ExpectedMessage, legacy)
+
+	unset, err := formatMessage("", KeyLayout{}, event)
+	assert.NoError(t, err)
+	assert.Equal(t, ExpectedMessage, unset)
+}
+
+func TestValidateMessageFormat(t *testing.T) {
+	assert.NoError(t, ValidateMessageFormat(MessageFormatLegacy))
+	assert.NoError(t, ValidateMessageFormat(MessageFormatV1))
+	assert.Error(t, ValidateMessageFormat("v2"))
+}
@@ -0,0 +1,51 @@
+package sns
+
+const (
+	// EventConcorded announces that a concept was added to the concordance of another concept, EventUnconcorded that it was removed.
+	EventConcorded   = "CONCORDED"
+	EventUnconcorded = "UNCONCORDED"
+)
+
+// FanOut returns the event followed by an event for every concept added to or removed from the concordance,
+// as the canonical mapping of those concepts changed along with it.
+func FanOut(event Event) []Event {
+	events := []Event{event}
+	seen := map[string]bool{event.UUID: true}
+	for _, id := range difference(event.NewConcordedIds, event.OldConcordedIds) {
+		if !seen[id] {
+			seen[id] = true
+			events = append(events, affectedEvent(event, EventConcorded, id))
+		}
+	}
+	for _, id := range difference(event.OldConcordedIds, event.NewConcordedIds) {
+		if !seen[id] {
+			seen[id] = true
+			events = append(events, affectedEvent(event, EventUnconcorded, id))
+		}
+	}
+	return events
+}
+
+// affectedEvent announces the change of a concordance to one of the concepts it affects.
+func affectedEvent(event Event, eventType string, uuid string) Event {
+	affected := NewEvent(eventType, uuid, event.TransactionID, nil, nil)
+	affected.Timestamp = event.Timestamp
+	affected.ConcordedBy = event.UUID
+	affected.Authorities = event.Authorities
+	return affected
+}
+
+// difference returns the ids of a that are not in b.
+func difference(a []string, b []string) []string {
+	in := map[string]bool{}
+	for _, id := range b {
+		in[id] = true
+	}
+	var ids []string
+	for _, id := range a {
+		if !in[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,50 @@
+package sns
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanOut(t *testing.T) {
+	event := NewEvent(EventUpdated, "A", "tid_1", []string{"B", "C"}, []string{"C", "D"})
+	event.Authorities = []string{"TME"}
+
+	events := FanOut(event)
+
+	assert.Len(t, events, 3)
+	assert.Equal(t, event, events[0], "Changed concordance should be announced first")
+	assert.Equal(t, EventConcorded, events[1].Type)
+	assert.Equal(t, "D", events[1].UUID)
+	assert.Equal(t, EventUnconcorded, events[2].Type)
+	assert.Equal(t, "B", events[2].UUID)
+	for _, affected := range events[1:] {
+		assert.Equal(t, "A", affected.ConcordedBy)
+		assert.Equal(t, "tid_1", affected.TransactionID)
+		assert.Equal(t, event.Timestamp, affected.Timestamp)
+		assert.Equal(t, []string{"TME"}, affected.Authorities)
+		assert.Empty(t, affected.OldConcordedIds)
+		assert.Empty(t, affected.NewConcordedIds)
+	}
+}
+
+func TestFanOutSkipsChangedConcept(t *testing.T) {
+	events := FanOut(NewEvent(EventCreated, "A", "tid_1", nil, []string{"A", "B", "B"}))
+
+	assert.Len(t, events, 2, "Concept itself and duplicate ids should not be announced again")
+	assert.Equal(t, "B", events[1].UUID)
+}
+
+func TestFanOutDeleted(t *testing.T) {
+	events := FanOut(NewEvent(EventDeleted, "A", "tid_1", []string{"B", "C"}, nil))
+
+	assert.Len(t, events, 3)
+	assert.Equal(t, EventUnconcorded, events[1].Type)
+	assert.Equal(t, EventUnconcorded, events[2].Type)
+}
+
+func TestFanOutUnchanged(t *testing.T) {
+	events := FanOut(NewEvent(EventUpdated, "A", "tid_1", []string{"B"}, []string{"B"}))
+
+	assert.Len(t, events, 1)
+}
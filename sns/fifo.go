@@ -0,0 +1,37 @@
+package sns
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	fifoSuffix         = ".fifo"
+	fifoTopicAttribute = "FifoTopic"
+)
+
+// IsFIFOTopic reports whether a topic is a FIFO topic, whose name always ends with .fifo
+func IsFIFOTopic(topicArn string) bool {
+	return strings.HasSuffix(topicArn, fifoSuffix)
+}
+
+// deduplicationID identifies a message for FIFO topics, which drop messages with the same id sent within five minutes,
+// so that a message sent again for the same change, e.g. by the notification outbox, is only delivered once.
+func deduplicationID(transactionId string, message string) string {
+	hash := sha256.Sum256([]byte(transactionId + "\n" + message))
+	return hex.EncodeToString(hash[:])
+}
+
+// validateTopicType checks that the topic is the FIFO or standard topic its ARN says it is.
+func validateTopicType(topicArn string, attributes map[string]*string) error {
+	fifo := attributes[fifoTopicAttribute] != nil && *attributes[fifoTopicAttribute] == "true"
+	if fifo == IsFIFOTopic(topicArn) {
+		return nil
+	}
+	if fifo {
+		return fmt.Errorf("topic %s is a FIFO topic, but its ARN does not end with %s", topicArn, fifoSuffix)
+	}
+	return fmt.Errorf("topic %s is not a FIFO topic, but its ARN ends with %s", topicArn, fifoSuffix)
+}
@@ -0,0 +1,21 @@
+package sns
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsFIFOTopic(t *testing.T) {
+	assert.True(t, IsFIFOTopic("arn:aws:sns:eu-west-1:027104099916:concordances.fifo"))
+	assert.False(t, IsFIFOTopic("arn:aws:sns:eu-west-1:027104099916:concordances"))
+	assert.False(t, IsFIFOTopic("arn:aws:sns:eu-west-1:027104099916:concordances-fifo"))
+}
+
+func TestDeduplicationID(t *testing.T) {
+	id := deduplicationID("tid_1234", `{"uuid":"9b40e89c-e87b-3d4f-b72c-2cf7511d2146"}`)
+	assert.Equal(t, id, deduplicationID("tid_1234", `{"uuid":"9b40e89c-e87b-3d4f-b72c-2cf7511d2146"}`))
+	assert.NotEqual(t, id, deduplicationID("tid_1234", `{"uuid":"9b40e89c-e87b-3d4f-b72c-2cf7511d2147"}`), "Different messages should not be deduplicated")
+	assert.NotEqual(t, id, deduplicationID("tid_5678", `{"uuid":"9b40e89c-e87b-3d4f-b72c-2cf7511d2146"}`), "Messages of different transactions should not be deduplicated")
+	assert.True(t, len(id) <= 128, "Deduplication ids are at most 128 characters long")
+}
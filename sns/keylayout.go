@@ -0,0 +1,66 @@
+package sns
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	DefaultKeySeparator = "/"
+	// maxKeyLength is the longest S3 object key.
+	maxKeyLength = 1024
+	// maxShardChars is the length of the first group of a UUID.
+	maxShardChars = 8
+	longestUUID   = "00000000-0000-0000-0000-000000000000"
+)
+
+// keyCharsRegex matches the characters S3 recommends for object keys.
+var keyCharsRegex = regexp.MustCompile(`^[A-Za-z0-9!_.*'()/-]*$`)
+
+// KeyLayout describes the object key legacy messages carry for a concept, e.g. the default layout turns
+// 4f50b156-6c50-4693-b835-02f70d3f3bc0 into 4f50b156/6c50/4693/b835/02f70d3f3bc0, and a layout with prefix concordances/,
+// separator -, suffix .json and 2 shard characters into concordances/4f/4f50b156-6c50-4693-b835-02f70d3f3bc0.json
+type KeyLayout struct {
+	Prefix string `json:"prefix,omitempty"`
+	// Separator replaces the dashes of the UUID, / when empty, so - keeps the UUID as it is.
+	Separator string `json:"separator,omitempty"`
+	Suffix    string `json:"suffix,omitempty"`
+	// ShardChars is the number of leading characters of the UUID the key is sharded by, in a directory of their own.
+	ShardChars int `json:"shardChars,omitempty"`
+}
+
+// Key returns the object key of a concept.
+func (l KeyLayout) Key(uuid string) string {
+	separator := l.Separator
+	if separator == "" {
+		separator = DefaultKeySeparator
+	}
+	key := l.Prefix
+	if l.ShardChars > 0 && len(uuid) >= l.ShardChars {
+		key += uuid[:l.ShardChars] + "/"
+	}
+	return key + strings.Replace(uuid, "-", separator, -1) + l.Suffix
+}
+
+// Validate checks that the layout makes valid, unambiguous S3 object keys.
+func (l KeyLayout) Validate() error {
+	for name, value := range map[string]string{"prefix": l.Prefix, "separator": l.Separator, "suffix": l.Suffix} {
+		if !keyCharsRegex.MatchString(value) {
+			return fmt.Errorf("key %s %q may only contain letters, digits and any of !_.*'()/-", name, value)
+		}
+		if strings.Contains(value, "//") {
+			return fmt.Errorf("key %s %q must not contain empty directories", name, value)
+		}
+	}
+	if strings.HasPrefix(l.Prefix, "/") {
+		return fmt.Errorf("key prefix %q must not start with /", l.Prefix)
+	}
+	if l.ShardChars < 0 || l.ShardChars > maxShardChars {
+		return fmt.Errorf("key shard characters (%d) must be between 0 and %d", l.ShardChars, maxShardChars)
+	}
+	if len(l.Key(longestUUID)) > maxKeyLength {
+		return fmt.Errorf("keys would be longer than %d characters", maxKeyLength)
+	}
+	return nil
+}
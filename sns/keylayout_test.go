@@ -0,0 +1,61 @@
+package sns
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyLayout(t *testing.T) {
+	tests := map[string]struct {
+		layout KeyLayout
+		key    string
+	}{
+		"Default":     {KeyLayout{}, "9b40e89c/e87b/3d4f/b72c/2cf7511d2146"},
+		"Slashes":     {KeyLayout{Separator: "/"}, "9b40e89c/e87b/3d4f/b72c/2cf7511d2146"},
+		"Dashes kept": {KeyLayout{Separator: "-"}, "9b40e89c-e87b-3d4f-b72c-2cf7511d2146"},
+		"Prefix":      {KeyLayout{Prefix: "concordances/"}, "concordances/9b40e89c/e87b/3d4f/b72c/2cf7511d2146"},
+		"Suffix":      {KeyLayout{Separator: "-", Suffix: ".json"}, "9b40e89c-e87b-3d4f-b72c-2cf7511d2146.json"},
+		"Sharded":     {KeyLayout{Separator: "_", ShardChars: 2}, "9b/9b40e89c_e87b_3d4f_b72c_2cf7511d2146"},
+		"Everything":  {KeyLayout{Prefix: "concordances/", Separator: "-", Suffix: ".json", ShardChars: 3}, "concordances/9b4/9b40e89c-e87b-3d4f-b72c-2cf7511d2146.json"},
+	}
+
+	for desc, test := range tests {
+		t.Run(desc, func(t *testing.T) {
+			assert.NoError(t, test.layout.Validate())
+			assert.Equal(t, test.key, test.layout.Key(UUID))
+		})
+	}
+}
+
+func TestKeyLayoutValidate(t *testing.T) {
+	invalid := map[string]KeyLayout{
+		"Invalid prefix":       {Prefix: "concordances?/"},
+		"Invalid separator":    {Separator: " "},
+		"Invalid suffix":       {Suffix: ".json#"},
+		"Empty directory":      {Prefix: "concordances//"},
+		"Leading slash":        {Prefix: "/concordances/"},
+		"Negative shard chars": {ShardChars: -1},
+		"Too many shard chars": {ShardChars: 9},
+		"Too long":             {Prefix: strings.Repeat("a", 1000)},
+	}
+
+	for desc, layout := range invalid {
+		t.Run(desc, func(t *testing.T) {
+			assert.Error(t, layout.Validate())
+		})
+	}
+}
+
+func TestLegacyMessageWithKeyLayout(t *testing.T) {
+	mockSnsService := capturePublishInput{}
+	client := Client{client: &mockSnsService, topicArn: TOPIC, awsRegion: AWS_REGION, format: MessageFormatLegacy, keyLayout: KeyLayout{Prefix: "concordances/", Separator: "-", Suffix: ".json"}}
+
+	assert.NoError(t, client.SendMessage(NewEvent(EventCreated, UUID, "testing_transaction_id", nil, []string{"A"})))
+	assert.Equal(t, `{"Records":[{"s3":{"object":{"key":"concordances/9b40e89c-e87b-3d4f-b72c-2cf7511d2146.json"}}}]}`, *mockSnsService.input.Message)
+
+	client.format = MessageFormatV1
+	assert.NoError(t, client.SendMessage(NewEvent(EventCreated, UUID, "testing_transaction_id", nil, []string{"A"})))
+	assert.NotContains(t, *mockSnsService.input.Message, ".json", "Key layout should only apply to legacy messages")
+}
@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	SignatureHeader = "X-Concordances-Signature"
+	RequestIdHeader = "X-Request-Id"
+
+	DefaultTimeout      = 5 * time.Second
+	DefaultRetries      = 3
+	DefaultMaxRetryTime = 10 * time.Second
+)
+
+// Config describes the HTTP endpoint concordance events are posted to.
+type Config struct {
+	URL     string
+	Headers map[string]string
+	Timeout time.Duration
+	// Retries is the number of times a failed delivery is retried before giving up.
+	Retries int
+	// MaxRetryTime caps the time spent delivering an event, attempts and waits between them included.
+	MaxRetryTime time.Duration
+	// Secret signs the body of every event with HMAC-SHA256 when set, see SignatureHeader.
+	Secret string
+}
+
+// Client posts concordance events, in the v1 event format, to an HTTP webhook.
+type Client struct {
+	conf       Config
+	client     *http.Client
+	retryDelay time.Duration
+
+	sync.Mutex
+	lastErr error
+}
+
+func NewWebhookClient(conf Config) *Client {
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultTimeout
+	}
+	if conf.MaxRetryTime <= 0 {
+		conf.MaxRetryTime = DefaultMaxRetryTime
+	}
+	return &Client{conf: conf, client: &http.Client{Timeout: conf.Timeout}, retryDelay: time.Second}
+}
+
+// ParseHeaders reads the headers sent with every event, given as a JSON object, e.g. {"Authorization":"Bearer ..."}
+func ParseHeaders(headers string) (map[string]string, error) {
+	parsed := map[string]string{}
+	if strings.TrimSpace(headers) == "" {
+		return parsed, nil
+	}
+	if err := json.Unmarshal([]byte(headers), &parsed); err != nil {
+		return nil, fmt.Errorf("webhook headers are not a valid JSON object: %v", err)
+	}
+	return parsed, nil
+}
+
+// Sign returns the signature of a body, sent in the SignatureHeader for receivers to verify events with the shared secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *Client) SendMessage(event sns.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.conf.MaxRetryTime)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	for attempt := 0; ; attempt++ {
+		retry, err := c.post(ctx, body, event.TransactionID)
+		if err == nil {
+			log.WithFields(log.Fields{"transaction_id": event.TransactionID, "UUID": event.UUID, "URL": c.conf.URL, "Event_Type": event.Type}).Info("Successfully sent concordance event to webhook")
+			c.setLastErr(nil)
+			return nil
+		}
+		delay := c.retryDelay * time.Duration(attempt+1)
+		if !retry || attempt >= c.conf.Retries || time.Now().Add(delay).After(deadline) {
+			log.WithError(err).WithFields(log.Fields{"transaction_id": event.TransactionID, "UUID": event.UUID, "URL": c.conf.URL, "attempts": attempt + 1}).Error("Error sending concordance event to webhook")
+			c.setLastErr(err)
+			return err
+		}
+		log.WithError(err).WithFields(log.Fields{"transaction_id": event.TransactionID, "UUID": event.UUID, "URL": c.conf.URL, "attempts": attempt + 1}).Warn("Error sending concordance event to webhook, retrying")
+		time.Sleep(delay)
+	}
+}
+
+// post sends an event once, and reports whether a failure is worth retrying.
+func (c *Client) post(ctx context.Context, body []byte, transactionId string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(RequestIdHeader, transactionId)
+	for name, value := range c.conf.Headers {
+		req.Header.Set(name, value)
+	}
+	if c.conf.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(c.conf.Secret, body))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	// Client errors other than rate limiting will fail again.
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// Healthcheck probes that the webhook is reachable with a HEAD request, without sending it an event.
+// Any response counts, as a webhook need not accept HEAD requests.
+func (c *Client) Healthcheck() (bool, error) {
+	req, err := http.NewRequest("HEAD", c.conf.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	for name, value := range c.conf.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// LastDeliveryError returns the error of the last delivery, nil when it succeeded.
+func (c *Client) LastDeliveryError() error {
+	c.Lock()
+	defer c.Unlock()
+	return c.lastErr
+}
+
+func (c *Client) setLastErr(err error) {
+	c.Lock()
+	c.lastErr = err
+	c.Unlock()
+}
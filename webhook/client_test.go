@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/concordances-rw-dynamodb/sns"
+	"github.com/stretchr/testify/assert"
+)
+
+const UUID = "9b40e89c-e87b-3d4f-b72c-2cf7511d2146"
+
+type receiver struct {
+	responses []int
+	requests  []*http.Request
+	bodies    [][]byte
+}
+
+func (r *receiver) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	status := http.StatusOK
+	if len(r.responses) > 0 {
+		status = r.responses[0]
+		r.responses = r.responses[1:]
+	}
+	rw.WriteHeader(status)
+}
+
+func newTestClient(url string, conf Config) *Client {
+	conf.URL = url
+	c := NewWebhookClient(conf)
+	c.retryDelay = time.Millisecond
+	return c
+}
+
+func TestSendMessage(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	client := newTestClient(server.URL, Config{Headers: map[string]string{"Authorization": "Bearer token"}, Secret: "secret"})
+	event := sns.NewEvent(sns.EventCreated, UUID, "tid_1234", nil, []string{"A"})
+
+	err := client.SendMessage(event)
+
+	assert.NoError(t, err)
+	assert.Len(t, r.requests, 1)
+	req := r.requests[0]
+	assert.Equal(t, "POST", req.Method)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", req.Header.Get("Authorization"), "Configured headers were not sent")
+	assert.Equal(t, "tid_1234", req.Header.Get(RequestIdHeader))
+	assert.Equal(t, Sign("secret", r.bodies[0]), req.Header.Get(SignatureHeader), "Body was not signed")
+
+	received := sns.Event{}
+	assert.NoError(t, json.Unmarshal(r.bodies[0], &received))
+	assert.Equal(t, sns.EventCreated, received.Type)
+	assert.Equal(t, UUID, received.UUID)
+	assert.Equal(t, []string{"A"}, received.NewConcordedIds)
+
+	assert.NoError(t, client.LastDeliveryError())
+}
+
+func TestSendMessage_Unsigned(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	client := newTestClient(server.URL, Config{})
+
+	assert.NoError(t, client.SendMessage(sns.NewEvent(sns.EventDeleted, UUID, "tid_1234", []string{"A"}, nil)))
+	assert.Empty(t, r.requests[0].Header.Get(SignatureHeader))
+}
+
+func TestSendMessage_RetriesServerErrors(t *testing.T) {
+	r := &receiver{responses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	client := newTestClient(server.URL, Config{Retries: 2})
+
+	err := client.SendMessage(sns.NewEvent(sns.EventUpdated, UUID, "tid_1234", nil, nil))
+
+	assert.NoError(t, err)
+	assert.Len(t, r.requests, 3)
+}
+
+func TestSendMessage_GivesUp(t *testing.T) {
+	r := &receiver{responses: []int{500, 500, 500}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	client := newTestClient(server.URL, Config{Retries: 1})
+
+	err := client.SendMessage(sns.NewEvent(sns.EventUpdated, UUID, "tid_1234", nil, nil))
+
+	assert.EqualError(t, err, "webhook responded with status 500")
+	assert.Len(t, r.requests, 2, "Delivery should be attempted once more than the configured retries")
+
+	assert.Error(t, client.LastDeliveryError(), "Failed delivery should be reported")
+}
+
+func TestSendMessage_GivesUpAfterMaxRetryTime(t *testing.T) {
+	r := &receiver{responses: []int{500, 500, 500, 500, 500}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	client := newTestClient(server.URL, Config{Retries: 4, MaxRetryTime: 50 * time.Millisecond})
+	client.retryDelay = 20 * time.Millisecond
+
+	err := client.SendMessage(sns.NewEvent(sns.EventUpdated, UUID, "tid_1234", nil, nil))
+
+	assert.Error(t, err)
+	assert.Len(t, r.requests, 2, "Delivery should not be retried past the max retry time")
+}
+
+func TestSendMessage_DoesNotRetryClientErrors(t *testing.T) {
+	r := &receiver{responses: []int{http.StatusBadRequest}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	client := newTestClient(server.URL, Config{Retries: 3})
+
+	err := client.SendMessage(sns.NewEvent(sns.EventUpdated, UUID, "tid_1234", nil, nil))
+
+	assert.Error(t, err)
+	assert.Len(t, r.requests, 1)
+}
+
+func TestSendMessage_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+	client := newTestClient(server.URL, Config{Timeout: 10 * time.Millisecond})
+
+	err := client.SendMessage(sns.NewEvent(sns.EventUpdated, UUID, "tid_1234", nil, nil))
+
+	assert.Error(t, err, "Slow webhook should time out")
+}
+
+func TestSendMessage_TimeoutCappedByMaxRetryTime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	client := newTestClient(server.URL, Config{Timeout: time.Second, MaxRetryTime: 20 * time.Millisecond})
+
+	start := time.Now()
+	err := client.SendMessage(sns.NewEvent(sns.EventUpdated, UUID, "tid_1234", nil, nil))
+
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 150*time.Millisecond, "Delivery should not outlast the max retry time")
+}
+
+func TestHealthcheck(t *testing.T) {
+	r := &receiver{responses: []int{http.StatusMethodNotAllowed}}
+	server := httptest.NewServer(r)
+	client := newTestClient(server.URL, Config{Headers: map[string]string{"Authorization": "Bearer token"}})
+
+	healthy, err := client.Healthcheck()
+	assert.True(t, healthy, "Webhook that responds should be healthy, whatever the status")
+	assert.NoError(t, err)
+	assert.Equal(t, "HEAD", r.requests[0].Method)
+	assert.Equal(t, "Bearer token", r.requests[0].Header.Get("Authorization"))
+
+	server.Close()
+	healthy, err = client.Healthcheck()
+	assert.False(t, healthy, "Unreachable webhook should not be healthy")
+	assert.Error(t, err)
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders(`{"Authorization":"Bearer token","X-Api-Key":"key"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer token", "X-Api-Key": "key"}, headers)
+
+	headers, err = ParseHeaders("")
+	assert.NoError(t, err)
+	assert.Empty(t, headers)
+
+	_, err = ParseHeaders("Authorization: Bearer token")
+	assert.Error(t, err)
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t, "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", Sign("key", []byte("The quick brown fox jumps over the lazy dog")))
+}